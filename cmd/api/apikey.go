@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/apikey"
+	"github.com/corradoisidoro/orders-api/internal/application"
+	"github.com/corradoisidoro/orders-api/internal/infrastructure"
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+)
+
+const apiKeyUsage = `usage:
+  apikey create --name NAME --scopes SCOPE[,SCOPE...]   create a key and print its token
+  apikey list                                           list keys and their scopes
+  apikey revoke KEY_ID                                  revoke a key
+
+scopes: orders:read, orders:write, orders:delete, webhooks:manage`
+
+// runAPIKey implements the apikey subcommand. args are the arguments that
+// follow "apikey".
+func runAPIKey(ctx context.Context, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", apiKeyUsage)
+	}
+	cmd, args := args[0], args[1:]
+
+	var key model.APIKey
+
+	switch cmd {
+	case "create":
+		fs := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		fs.SetOutput(io.Discard)
+		name := fs.String("name", "", "")
+		scopes := fs.String("scopes", "", "")
+		if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *name == "" || *scopes == "" {
+			return fmt.Errorf("%s", apiKeyUsage)
+		}
+
+		key.Name = *name
+		for _, s := range strings.Split(*scopes, ",") {
+			scope := model.Scope(strings.TrimSpace(s))
+			if !scope.Valid() {
+				return fmt.Errorf("unknown scope %q\n%s", scope, apiKeyUsage)
+			}
+			key.Scopes = append(key.Scopes, scope)
+		}
+
+	case "list":
+		if len(args) != 0 {
+			return fmt.Errorf("%s", apiKeyUsage)
+		}
+
+	case "revoke":
+		if len(args) != 1 {
+			return fmt.Errorf("%s", apiKeyUsage)
+		}
+		key.KeyID = args[0]
+
+	default:
+		return fmt.Errorf("unknown apikey command %q\n%s", cmd, apiKeyUsage)
+	}
+
+	cfg, err := application.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := infrastructure.ConnectDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	repo := repository.NewAPIKeyRepo(db)
+
+	switch cmd {
+	case "create":
+		token, keyID, hash, err := apikey.Generate()
+		if err != nil {
+			return err
+		}
+		key.KeyID, key.SecretHash = keyID, hash
+
+		if err := repo.Create(ctx, &key); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created API key %s (%s)\n", key.KeyID, key.Scopes)
+		fmt.Fprintf(out, "Token (shown only once): %s\n", token)
+
+	case "list":
+		keys, err := repo.List(ctx)
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			state := "active"
+			if k.Revoked() {
+				state = "revoked " + k.RevokedAt.UTC().Format(time.RFC3339)
+			}
+			fmt.Fprintf(out, "%-16s %-24s %-44s %s\n", k.KeyID, k.Name, k.Scopes, state)
+		}
+
+	case "revoke":
+		if err := repo.Revoke(ctx, key.KeyID, time.Now().UTC()); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Revoked API key %s\n", key.KeyID)
+	}
+
+	return nil
+}
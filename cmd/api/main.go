@@ -2,41 +2,76 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/corradoisidoro/orders-api/internal/application"
 	"github.com/corradoisidoro/orders-api/internal/infrastructure"
+	"github.com/corradoisidoro/orders-api/internal/logging"
+	"github.com/corradoisidoro/orders-api/internal/tracing"
 )
 
 func main() {
+	// JSON logs at info level until the config says otherwise.
+	level := new(slog.LevelVar)
+	slog.SetDefault(logging.New(os.Stdout, level))
+
+	// CLI command: go run ./cmd/api migrate [up|down N|status|create NAME]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(context.Background(), os.Stdout, os.Args[2:]); err != nil {
+			slog.Error("migration failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// CLI command: go run ./cmd/api apikey [create|list|revoke]
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := runAPIKey(context.Background(), os.Stdout, os.Args[2:]); err != nil {
+			slog.Error("apikey failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// CLI command: go run ./cmd/api purge [--days N]
+	if len(os.Args) > 1 && os.Args[1] == "purge" {
+		if err := runPurge(context.Background(), os.Stdout, os.Args[2:]); err != nil {
+			slog.Error("purge failed", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	cfg, err := application.LoadConfig()
 	if err != nil {
-		fmt.Println("failed to load config:", err)
+		slog.Error("failed to load config", "error", err)
 		os.Exit(1)
 	}
+	level.Set(cfg.LogLevel)
 
-	db, err := infrastructure.ConnectDatabase(cfg)
+	// The DSN's password is redacted by the logger.
+	slog.Info("config loaded", "port", cfg.ServerPort, "dsn", cfg.DatabaseDSN, "log_level", cfg.LogLevel.String())
+
+	// Install the tracer provider before the database and router use it.
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.TracingExporter)
 	if err != nil {
-		fmt.Println("failed to connect to database:", err)
+		slog.Error("failed to set up tracing", "error", err)
 		os.Exit(1)
 	}
 
-	// CLI command: go run main.go migrate
-	if len(os.Args) > 1 && os.Args[1] == "migrate" {
-		fmt.Println("Running migrations...")
-		if err := infrastructure.Migrate(db); err != nil {
-			fmt.Println("migration failed:", err)
-			os.Exit(1)
-		}
-		fmt.Println("Database migrated successfully")
-		return
+	db, err := infrastructure.ConnectDatabase(cfg)
+	if err != nil {
+		slog.Error("failed to connect to database", "error", err)
+		os.Exit(1)
 	}
 
 	// Build application with injected dependencies
 	app := application.New(cfg, db)
+	app.AddReadinessCheck("migrations", infrastructure.CheckMigrations(db))
 
 	// Graceful shutdown context (SIGINT + SIGTERM)
 	ctx, cancel := signal.NotifyContext(
@@ -47,8 +82,17 @@ func main() {
 	defer cancel()
 
 	// Start server
-	if err := app.Start(ctx); err != nil {
-		fmt.Println("failed to start app:", err)
+	err = app.Start(ctx)
+
+	// Flush pending spans
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+
+	if err != nil {
+		slog.Error("failed to start app", "error", err)
 		os.Exit(1)
 	}
 }
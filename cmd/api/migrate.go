@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/corradoisidoro/orders-api/internal/application"
+	"github.com/corradoisidoro/orders-api/internal/infrastructure"
+)
+
+const migrateUsage = `usage:
+  migrate [up]          apply all pending migrations
+  migrate down N        revert the N most recent migrations
+  migrate status        list migrations and whether they are applied
+  migrate create NAME   add empty up/down SQL files to ` + infrastructure.MigrationsDir
+
+// runMigrate implements the migrate subcommand. args are the arguments that
+// follow "migrate".
+func runMigrate(ctx context.Context, out io.Writer, args []string) error {
+	cmd := "up"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	if cmd == "create" {
+		if len(args) != 1 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+		existing, err := infrastructure.Migrations()
+		if err != nil {
+			return err
+		}
+		up, down, err := infrastructure.CreateMigration(infrastructure.MigrationsDir, args[0], existing)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created %s\nCreated %s\n", up, down)
+		return nil
+	}
+
+	switch cmd {
+	case "up", "down", "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q\n%s", cmd, migrateUsage)
+	}
+
+	cfg, err := application.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := infrastructure.ConnectDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	m, err := infrastructure.NewServiceMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch cmd {
+	case "up":
+		if len(args) != 0 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Fprintf(out, "Applied %s\n", mig)
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(out, "Database migrated successfully")
+
+	case "down":
+		if len(args) != 1 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 {
+			return fmt.Errorf("migrate down: N must be a positive integer, got %q", args[0])
+		}
+		reverted, err := m.Down(ctx, n)
+		for _, mig := range reverted {
+			fmt.Fprintf(out, "Reverted %s\n", mig)
+		}
+		if err != nil {
+			return err
+		}
+
+	case "status":
+		if len(args) != 0 {
+			return fmt.Errorf("%s", migrateUsage)
+		}
+		statuses, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.UTC().Format("2006-01-02T15:04:05Z")
+			}
+			fmt.Fprintf(out, "%-40s %s\n", s.Migration, state)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/application"
+	"github.com/corradoisidoro/orders-api/internal/infrastructure"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+)
+
+const purgeUsage = `usage:
+  purge [--days N]   permanently remove orders deleted more than N days ago (default 30)`
+
+// runPurge implements the purge subcommand. args are the arguments that
+// follow "purge".
+func runPurge(ctx context.Context, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("purge", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	days := fs.Int("days", 30, "")
+	if err := fs.Parse(args); err != nil || fs.NArg() != 0 || *days < 0 {
+		return fmt.Errorf("%s", purgeUsage)
+	}
+
+	cfg, err := application.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := infrastructure.ConnectDatabase(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	before := time.Now().UTC().AddDate(0, 0, -*days)
+	ctx = repository.WithScope(ctx, repository.Unrestricted)
+	ctx = repository.WithActor(ctx, repository.Actor{Name: "cli:purge"})
+
+	n, err := repository.NewOrderRepo(db).PurgeDeleted(ctx, before)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Purged %d orders deleted before %s\n", n, before.Format(time.RFC3339))
+	return nil
+}
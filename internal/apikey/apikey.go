@@ -0,0 +1,78 @@
+// Package apikey generates and checks API key tokens.
+//
+// A token has the form "oak_<key id>_<secret>". The key ID is public and
+// locates the stored key; the secret is random and only its SHA-256 hash is
+// stored. Secrets carry 256 bits of entropy, so a fast hash is sufficient.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const prefix = "oak_"
+
+const (
+	keyIDBytes  = 8
+	secretBytes = 32
+)
+
+var ErrMalformed = errors.New("malformed API key")
+
+// Generate returns a new token together with its key ID and secret hash.
+func Generate() (token, keyID, secretHash string, err error) {
+	id := make([]byte, keyIDBytes)
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", "", fmt.Errorf("generate API key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", "", fmt.Errorf("generate API key: %w", err)
+	}
+
+	keyID = hex.EncodeToString(id)
+	encoded := base64.RawURLEncoding.EncodeToString(secret)
+
+	return prefix + keyID + "_" + encoded, keyID, Hash(encoded), nil
+}
+
+// IsToken reports whether s looks like an API key token rather than some
+// other kind of bearer token.
+func IsToken(s string) bool {
+	return strings.HasPrefix(s, prefix)
+}
+
+// Parse splits a token into its key ID and secret.
+func Parse(token string) (keyID, secret string, err error) {
+	rest, ok := strings.CutPrefix(token, prefix)
+	if !ok {
+		return "", "", ErrMalformed
+	}
+
+	keyID, secret, ok = strings.Cut(rest, "_")
+	if !ok || len(keyID) != 2*keyIDBytes || secret == "" {
+		return "", "", ErrMalformed
+	}
+	if _, err := hex.DecodeString(keyID); err != nil {
+		return "", "", ErrMalformed
+	}
+
+	return keyID, secret, nil
+}
+
+// Hash returns the hex SHA-256 hash under which secret is stored.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// Verify reports whether secret matches the stored hash, in constant time.
+func Verify(secret, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(Hash(secret)), []byte(hash)) == 1
+}
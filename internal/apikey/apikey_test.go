@@ -0,0 +1,39 @@
+package apikey
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateParseVerify(t *testing.T) {
+	token, keyID, hash, err := Generate()
+	require.NoError(t, err)
+	assert.True(t, IsToken(token))
+
+	gotID, secret, err := Parse(token)
+	require.NoError(t, err)
+	assert.Equal(t, keyID, gotID)
+	assert.True(t, Verify(secret, hash))
+	assert.False(t, Verify(secret+"x", hash))
+
+	other, _, _, err := Generate()
+	require.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestParse_Malformed(t *testing.T) {
+	for _, token := range []string{
+		"",
+		"eyJhbGciOiJSUzI1NiJ9.payload.sig",
+		"oak_",
+		"oak_0123456789abcdef",
+		"oak_0123456789abcdef_",
+		"oak_short_secret",
+		"oak_0123456789abcdeg_secret",
+	} {
+		_, _, err := Parse(token)
+		assert.ErrorIs(t, err, ErrMalformed, token)
+	}
+}
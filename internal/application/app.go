@@ -4,12 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/corradoisidoro/orders-api/internal/handler"
+	"github.com/corradoisidoro/orders-api/internal/jwt"
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
+	"github.com/corradoisidoro/orders-api/internal/outbox"
+	"github.com/corradoisidoro/orders-api/internal/ratelimit"
 	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/corradoisidoro/orders-api/internal/stream"
+	"github.com/corradoisidoro/orders-api/internal/webhook"
 	"gorm.io/gorm"
 )
 
@@ -20,10 +28,21 @@ type HTTPServer interface {
 }
 
 type App struct {
-	router       http.Handler
-	config       Config
-	DB           *gorm.DB
-	orderHandler *handler.OrderHandler
+	router          http.Handler
+	adminRouter     http.Handler // served on config.AdminPort, if set
+	config          Config
+	DB              *gorm.DB
+	orderHandler    *handler.OrderHandler
+	healthHandler   *handler.HealthHandler
+	webhookHandler  *handler.WebhookHandler
+	streamHandler   *handler.StreamHandler
+	idempotencyRepo *repository.IdempotencyRepo
+	apiKeyRepo      *repository.APIKeyRepo
+	limiter         ratelimit.Limiter
+	relay           *outbox.Relay
+	broker          *stream.Broker
+	tailer          *stream.Tailer
+	jwtKeys         *jwt.KeySource // nil unless JWTs are accepted
 
 	// ServerFactory allows injecting a fake server in tests.
 	ServerFactory func(addr string, handler http.Handler) HTTPServer
@@ -31,13 +50,30 @@ type App struct {
 
 func New(config Config, db *gorm.DB) *App {
 	orderRepo := repository.NewOrderRepo(db)
+	webhookRepo := repository.NewWebhookRepo(db)
+	broker := stream.NewBroker(config.StreamBufferSize)
 
 	app := &App{
 		config: config,
 		DB:     db,
 		orderHandler: &handler.OrderHandler{
-			Repo: orderRepo,
+			Repo:    orderRepo,
+			Cursors: repository.NewCursorCodec([]byte(config.CursorSecret)),
+			States:  orderstate.Default(),
 		},
+		healthHandler:  &handler.HealthHandler{},
+		webhookHandler: &handler.WebhookHandler{Repo: webhookRepo},
+		streamHandler: &handler.StreamHandler{
+			Broker:    broker,
+			States:    orderstate.Default(),
+			Heartbeat: time.Duration(config.StreamHeartbeatSecs) * time.Second,
+		},
+		idempotencyRepo: repository.NewIdempotencyRepo(db),
+		apiKeyRepo:      repository.NewAPIKeyRepo(db),
+		limiter:         newLimiter(config, db),
+		relay:           newRelay(config, db),
+		broker:          broker,
+		tailer:          newTailer(config, db, broker),
 
 		ServerFactory: func(addr string, h http.Handler) HTTPServer {
 			return &http.Server{
@@ -47,27 +83,111 @@ func New(config Config, db *gorm.DB) *App {
 		},
 	}
 
+	if config.JWTJWKS != "" {
+		app.jwtKeys = jwt.NewKeySource(config.JWTJWKS)
+	}
+
+	if sweeper, ok := app.limiter.(ratelimit.Sweeper); ok {
+		metrics.ObserveRateLimiter(sweeper.Tracked)
+	}
+
+	webhooks := webhook.NewSink(webhookRepo)
+	webhooks.DisableAfter = config.WebhookDisableAfter
+	webhooks.Client.Timeout = time.Duration(config.WebhookTimeoutSecs) * time.Second
+	app.AddEventSink(webhooks)
+
+	if db != nil {
+		app.AddReadinessCheck("database", func(ctx context.Context) error {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return err
+			}
+			return sqlDB.PingContext(ctx)
+		})
+	}
+
 	app.loadRoutes()
+	app.loadAdminRoutes()
 	return app
 }
 
+// AddReadinessCheck adds a check to /readyz. It must be called before Start.
+func (a *App) AddReadinessCheck(name string, check func(ctx context.Context) error) {
+	a.healthHandler.Checks = append(a.healthHandler.Checks, handler.HealthCheck{Name: name, Check: check})
+}
+
+// AddEventSink adds a sink to which the order events of the outbox are
+// delivered. It must be called before Start.
+func (a *App) AddEventSink(sink outbox.Sink) {
+	a.relay.Sinks = append(a.relay.Sinks, sink)
+}
+
+// newRelay returns the outbox relay configured by config, delivering to a
+// LogSink until other sinks are added.
+func newRelay(config Config, db *gorm.DB) *outbox.Relay {
+	relay := outbox.NewRelay(repository.NewOutboxRepo(db), outbox.LogSink{})
+	relay.PollInterval = time.Duration(config.OutboxPollIntervalMs) * time.Millisecond
+	relay.MaxAttempts = config.OutboxMaxAttempts
+	relay.Retention = time.Duration(config.OutboxRetentionHours) * time.Hour
+	return relay
+}
+
+// newTailer returns the tailer feeding broker from the outbox.
+func newTailer(config Config, db *gorm.DB, broker *stream.Broker) *stream.Tailer {
+	tailer := stream.NewTailer(repository.NewOutboxRepo(db), broker)
+	tailer.PollInterval = time.Duration(config.OutboxPollIntervalMs) * time.Millisecond
+	return tailer
+}
+
+// newLimiter returns the rate limiter selected by config.RateLimitBackend.
+func newLimiter(config Config, db *gorm.DB) ratelimit.Limiter {
+	switch config.RateLimitBackend {
+	case RateLimitBackendSlidingWindow:
+		return ratelimit.NewSlidingWindowLog(config.RateLimitMaxClients)
+	case RateLimitBackendPostgres:
+		return ratelimit.NewPostgresLimiter(db)
+	default:
+		return ratelimit.NewTokenBucket(config.RateLimitMaxClients)
+	}
+}
+
 func (a *App) Start(ctx context.Context) error {
 	if a.ServerFactory == nil {
 		return fmt.Errorf("ServerFactory is nil")
 	}
 
-	server := a.ServerFactory(fmt.Sprintf(":%d", a.config.ServerPort), a.router)
+	// Read the JWKS up front so that a bad JWT_JWKS fails at startup.
+	if a.jwtKeys != nil {
+		if err := a.jwtKeys.Load(ctx); err != nil {
+			return err
+		}
+	}
+
+	servers := []HTTPServer{a.ServerFactory(fmt.Sprintf(":%d", a.config.ServerPort), a.router)}
+	slog.InfoContext(ctx, "server running", "port", a.config.ServerPort)
 
-	log.Printf("Server running at http://localhost:%d\n", a.config.ServerPort)
+	if a.config.AdminPort != 0 {
+		servers = append(servers, a.ServerFactory(fmt.Sprintf(":%d", a.config.AdminPort), a.adminRouter))
+		slog.InfoContext(ctx, "admin server running", "port", a.config.AdminPort)
+	}
 
-	errCh := make(chan error, 1)
+	errCh := make(chan error, len(servers))
 
-	// Run server in background and capture non-shutdown errors.
-	go func() {
-		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			errCh <- fmt.Errorf("server error: %w", err)
-		}
-	}()
+	go a.purgeIdempotencyKeys(ctx)
+	go a.sweepRateLimiter(ctx)
+	if a.DB != nil {
+		go a.relay.Run(ctx)
+		go a.tailer.Run(ctx)
+	}
+
+	// Run servers in background and capture non-shutdown errors.
+	for _, server := range servers {
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				errCh <- fmt.Errorf("server error: %w", err)
+			}
+		}()
+	}
 
 	select {
 	case err := <-errCh:
@@ -75,17 +195,105 @@ func (a *App) Start(ctx context.Context) error {
 		return err
 
 	case <-ctx.Done():
-		// Graceful shutdown on context cancellation.
+		// Graceful shutdown on context cancellation. Fail readiness first
+		// and keep serving while load balancers notice. Event streams
+		// never finish on their own, so end them now; clients reconnect
+		// elsewhere and resume.
+		a.healthHandler.Drain()
+		a.broker.Close()
+		if a.config.ShutdownDrainSecs > 0 {
+			slog.Info("draining before shutdown", "seconds", a.config.ShutdownDrainSecs)
+			time.Sleep(time.Duration(a.config.ShutdownDrainSecs) * time.Second)
+		}
+
 		timeoutCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		log.Println("Shutting down server...")
-		if err := server.Shutdown(timeoutCtx); err != nil {
-			log.Printf("shutdown error: %v", err)
-			return err
+		slog.Info("shutting down server")
+		var errs []error
+		for _, server := range servers {
+			if err := server.Shutdown(timeoutCtx); err != nil {
+				slog.Error("shutdown failed", "error", err)
+				errs = append(errs, err)
+			}
+		}
+
+		return errors.Join(errs...)
+	}
+}
+
+// purgeIdempotencyKeys periodically deletes expired idempotency keys until
+// ctx is cancelled.
+func (a *App) purgeIdempotencyKeys(ctx context.Context) {
+	if a.DB == nil || a.config.IdempotencyPurgeEverySecs < 1 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(a.config.IdempotencyPurgeEverySecs) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := a.idempotencyRepo.Purge(ctx, time.Now().UTC())
+			if err != nil {
+				slog.ErrorContext(ctx, "idempotency purge failed", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "purged expired idempotency keys", "count", n)
+			}
+		}
+	}
+}
+
+// rateLimitPolicies returns the configured rate limit policies followed by
+// the defaults.
+func (a *App) rateLimitPolicies() ratelimit.Policies {
+	return append(slices.Clone(a.config.RateLimitPolicies),
+		ratelimit.DefaultPolicies(a.config.RateLimitRequests, a.config.RateLimitWindowSecs)...)
+}
+
+// sweepRateLimiter periodically forgets rate limiter state that has expired,
+// whether the limiter keeps it in memory or in the database, until ctx is
+// cancelled.
+func (a *App) sweepRateLimiter(ctx context.Context) {
+	if a.config.RateLimitSweepEverySecs < 1 {
+		return
+	}
+
+	var sweep func(now time.Time)
+	switch l := a.limiter.(type) {
+	case ratelimit.Sweeper:
+		sweep = func(now time.Time) { l.Sweep(now) }
+	case *ratelimit.PostgresLimiter:
+		idle := a.rateLimitPolicies().MaxWindow()
+		sweep = func(now time.Time) {
+			n, err := l.Sweep(ctx, now.Add(-idle))
+			if err != nil {
+				slog.ErrorContext(ctx, "rate limit bucket sweep failed", "error", err)
+				return
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "swept idle rate limit buckets", "count", n)
+			}
 		}
+	default:
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(a.config.RateLimitSweepEverySecs) * time.Second)
+	defer ticker.Stop()
 
-		return nil
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			sweep(now)
+		}
 	}
 }
 
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -83,3 +85,116 @@ func TestAppStart_GracefulShutdown(t *testing.T) {
 
 	require.NoError(t, err)
 }
+
+func TestAppStart_InvalidJWKS(t *testing.T) {
+	cfg := application.Config{
+		ServerPort:  9997,
+		DatabaseDSN: "dsn",
+		JWTJWKS:     filepath.Join(t.TempDir(), "missing.json"),
+		JWTIssuer:   "https://sso.example.com/",
+		JWTAudience: "orders-api",
+	}
+
+	var db *gorm.DB
+	app := application.New(cfg, db)
+	app.ServerFactory = func(addr string, h http.Handler) application.HTTPServer {
+		return &fakeServer{listenErr: http.ErrServerClosed}
+	}
+
+	err := app.Start(context.Background())
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "load JWKS")
+}
+
+func TestAppStart_AdminServer(t *testing.T) {
+	cfg := application.Config{
+		ServerPort:  9996,
+		AdminPort:   9995,
+		DatabaseDSN: "dsn",
+	}
+
+	var db *gorm.DB
+	app := application.New(cfg, db)
+
+	handlers := make(map[string]http.Handler)
+	app.ServerFactory = func(addr string, h http.Handler) application.HTTPServer {
+		handlers[addr] = h
+		return &fakeServer{listenErr: http.ErrServerClosed}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.NoError(t, app.Start(ctx))
+
+	require.Len(t, handlers, 2)
+
+	rec := httptest.NewRecorder()
+	handlers[":9995"].ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "# TYPE orders_created_total counter")
+
+	rec = httptest.NewRecorder()
+	handlers[":9996"].ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code, "metrics are only served on the admin port")
+}
+
+// blockingServer serves until Shutdown is called.
+type blockingServer struct {
+	stopped chan struct{}
+}
+
+func (s *blockingServer) ListenAndServe() error {
+	<-s.stopped
+	return http.ErrServerClosed
+}
+
+func (s *blockingServer) Shutdown(ctx context.Context) error {
+	close(s.stopped)
+	return nil
+}
+
+func TestAppStart_ReadinessFailsWhileDraining(t *testing.T) {
+	cfg := application.Config{
+		ServerPort:        9994,
+		DatabaseDSN:       "dsn",
+		ShutdownDrainSecs: 1,
+	}
+
+	var db *gorm.DB
+	app := application.New(cfg, db)
+	app.AddReadinessCheck("always", func(context.Context) error { return nil })
+	app.ServerFactory = func(addr string, h http.Handler) application.HTTPServer {
+		return &blockingServer{stopped: make(chan struct{})}
+	}
+
+	ready := func() int {
+		rec := httptest.NewRecorder()
+		app.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		return rec.Code
+	}
+	live := func() int {
+		rec := httptest.NewRecorder()
+		app.Router().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return rec.Code
+	}
+
+	require.Equal(t, http.StatusOK, ready())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- app.Start(ctx) }()
+	cancel()
+
+	assert.Eventually(t, func() bool { return ready() == http.StatusServiceUnavailable },
+		500*time.Millisecond, 5*time.Millisecond, "readiness fails as soon as shutdown begins")
+	assert.Equal(t, http.StatusOK, live(), "liveness is unaffected")
+
+	select {
+	case err := <-done:
+		t.Fatalf("server stopped before the drain period: %v", err)
+	default:
+	}
+
+	require.NoError(t, <-done)
+}
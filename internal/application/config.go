@@ -2,26 +2,92 @@ package application
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 	"strconv"
 
+	"github.com/corradoisidoro/orders-api/internal/logging"
+	"github.com/corradoisidoro/orders-api/internal/ratelimit"
+	"github.com/corradoisidoro/orders-api/internal/tracing"
 	"github.com/joho/godotenv"
 )
 
+// Rate limiter backends selectable with RATE_LIMIT_BACKEND.
+const (
+	RateLimitBackendTokenBucket   = "token_bucket"   // in memory, per replica
+	RateLimitBackendSlidingWindow = "sliding_window" // in memory, per replica
+	RateLimitBackendPostgres      = "postgres"       // token buckets shared by all replicas
+)
+
 type Config struct {
-	ServerPort          uint16
-	DatabaseDSN         string
-	RateLimitRequests   int
-	RateLimitWindowSecs int
+	ServerPort              uint16
+	AdminPort               uint16 // serves /metrics apart from the API when non-zero
+	DatabaseDSN             string
+	LogLevel                slog.Level
+	RateLimitRequests       int
+	RateLimitWindowSecs     int
+	RateLimitBackend        string
+	RateLimitPolicies       ratelimit.Policies // evaluated before the defaults
+	RateLimitMaxClients     int                // in-memory limiters only; 0 means no cap
+	RateLimitSweepEverySecs int
+
+	CursorSecret string
+
+	IdempotencyTTLSecs        int
+	IdempotencyPurgeEverySecs int
+
+	TracingExporter string // tracing.ExporterNone, ExporterStdout or ExporterOTLP
+
+	OutboxPollIntervalMs int
+	OutboxMaxAttempts    int // failed deliveries before an event is dead-lettered
+	OutboxRetentionHours int // how long delivered events are kept
+
+	StreamBufferSize    int // events kept for Last-Event-ID replay
+	StreamHeartbeatSecs int
+
+	WebhookTimeoutSecs  int
+	WebhookDisableAfter int // consecutive failed deliveries before a webhook is disabled
+
+	// ShutdownDrainSecs is how long /readyz fails before the server stops
+	// accepting connections on shutdown.
+	ShutdownDrainSecs int
+
+	// JWT bearer tokens are accepted only when JWTJWKS is set.
+	JWTJWKS       string // JWKS file path or http(s) URL
+	JWTIssuer     string // required iss claim
+	JWTAudience   string // required aud claim
+	JWTLeewaySecs int    // tolerated clock skew
 }
 
 func LoadConfig() (Config, error) {
 	_ = godotenv.Load()
 
 	cfg := Config{
-		ServerPort:          3000,
-		RateLimitRequests:   10,
-		RateLimitWindowSecs: 60,
+		ServerPort:              3000,
+		RateLimitRequests:       10,
+		RateLimitWindowSecs:     60,
+		RateLimitBackend:        RateLimitBackendTokenBucket,
+		RateLimitMaxClients:     100_000,
+		RateLimitSweepEverySecs: 60,
+
+		IdempotencyTTLSecs:        24 * 60 * 60,
+		IdempotencyPurgeEverySecs: 60 * 60,
+
+		TracingExporter: tracing.ExporterNone,
+
+		OutboxPollIntervalMs: 1000,
+		OutboxMaxAttempts:    10,
+		OutboxRetentionHours: 7 * 24,
+
+		StreamBufferSize:    1000,
+		StreamHeartbeatSecs: 15,
+
+		WebhookTimeoutSecs:  10,
+		WebhookDisableAfter: 5,
+
+		ShutdownDrainSecs: 5,
+
+		JWTLeewaySecs: 30,
 	}
 
 	// SERVER_PORT
@@ -33,6 +99,18 @@ func LoadConfig() (Config, error) {
 		cfg.ServerPort = uint16(port)
 	}
 
+	// ADMIN_PORT (optional; /metrics is served on SERVER_PORT when unset)
+	if portStr := os.Getenv("ADMIN_PORT"); portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ADMIN_PORT: %w", err)
+		}
+		cfg.AdminPort = uint16(port)
+	}
+	if cfg.AdminPort != 0 && cfg.AdminPort == cfg.ServerPort {
+		return cfg, fmt.Errorf("ADMIN_PORT must differ from SERVER_PORT")
+	}
+
 	// DATABASE_DSN (required)
 	dsn := os.Getenv("DATABASE_DSN")
 	if dsn == "" {
@@ -40,6 +118,15 @@ func LoadConfig() (Config, error) {
 	}
 	cfg.DatabaseDSN = dsn
 
+	// LOG_LEVEL
+	if levelStr := os.Getenv("LOG_LEVEL"); levelStr != "" {
+		level, err := logging.ParseLevel(levelStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		}
+		cfg.LogLevel = level
+	}
+
 	// RATE_LIMIT_REQUESTS
 	if reqStr := os.Getenv("RATE_LIMIT_REQUESTS"); reqStr != "" {
 		req, err := strconv.Atoi(reqStr)
@@ -58,6 +145,164 @@ func LoadConfig() (Config, error) {
 		cfg.RateLimitWindowSecs = win
 	}
 
+	// RATE_LIMIT_BACKEND
+	if backend := os.Getenv("RATE_LIMIT_BACKEND"); backend != "" {
+		switch backend {
+		case RateLimitBackendTokenBucket, RateLimitBackendSlidingWindow, RateLimitBackendPostgres:
+			cfg.RateLimitBackend = backend
+		default:
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_BACKEND %q", backend)
+		}
+	}
+
+	// RATE_LIMIT_POLICIES (JSON array of ratelimit.Policy)
+	if policies := os.Getenv("RATE_LIMIT_POLICIES"); policies != "" {
+		ps, err := ratelimit.ParsePolicies([]byte(policies))
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_POLICIES: %w", err)
+		}
+		cfg.RateLimitPolicies = ps
+	}
+
+	// RATE_LIMIT_MAX_CLIENTS
+	if maxStr := os.Getenv("RATE_LIMIT_MAX_CLIENTS"); maxStr != "" {
+		maxClients, err := strconv.Atoi(maxStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_MAX_CLIENTS: %w", err)
+		}
+		cfg.RateLimitMaxClients = maxClients
+	}
+
+	// RATE_LIMIT_SWEEP_INTERVAL_SECONDS
+	if sweepStr := os.Getenv("RATE_LIMIT_SWEEP_INTERVAL_SECONDS"); sweepStr != "" {
+		sweep, err := strconv.Atoi(sweepStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid RATE_LIMIT_SWEEP_INTERVAL_SECONDS: %w", err)
+		}
+		cfg.RateLimitSweepEverySecs = sweep
+	}
+
+	// CURSOR_SECRET (optional; a random key is used when unset)
+	cfg.CursorSecret = os.Getenv("CURSOR_SECRET")
+
+	// IDEMPOTENCY_TTL_SECONDS
+	if ttlStr := os.Getenv("IDEMPOTENCY_TTL_SECONDS"); ttlStr != "" {
+		ttl, err := strconv.Atoi(ttlStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid IDEMPOTENCY_TTL_SECONDS: %w", err)
+		}
+		cfg.IdempotencyTTLSecs = ttl
+	}
+
+	// IDEMPOTENCY_PURGE_INTERVAL_SECONDS
+	if purgeStr := os.Getenv("IDEMPOTENCY_PURGE_INTERVAL_SECONDS"); purgeStr != "" {
+		purge, err := strconv.Atoi(purgeStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid IDEMPOTENCY_PURGE_INTERVAL_SECONDS: %w", err)
+		}
+		cfg.IdempotencyPurgeEverySecs = purge
+	}
+
+	// TRACING_EXPORTER
+	if exporter := os.Getenv("TRACING_EXPORTER"); exporter != "" {
+		switch exporter {
+		case tracing.ExporterNone, tracing.ExporterStdout, tracing.ExporterOTLP:
+			cfg.TracingExporter = exporter
+		default:
+			return cfg, fmt.Errorf("invalid TRACING_EXPORTER %q", exporter)
+		}
+	}
+
+	// OUTBOX_POLL_INTERVAL_MS
+	if pollStr := os.Getenv("OUTBOX_POLL_INTERVAL_MS"); pollStr != "" {
+		poll, err := strconv.Atoi(pollStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid OUTBOX_POLL_INTERVAL_MS: %w", err)
+		}
+		cfg.OutboxPollIntervalMs = poll
+	}
+
+	// OUTBOX_MAX_ATTEMPTS
+	if attemptsStr := os.Getenv("OUTBOX_MAX_ATTEMPTS"); attemptsStr != "" {
+		attempts, err := strconv.Atoi(attemptsStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid OUTBOX_MAX_ATTEMPTS: %w", err)
+		}
+		cfg.OutboxMaxAttempts = attempts
+	}
+
+	// OUTBOX_RETENTION_HOURS
+	if retentionStr := os.Getenv("OUTBOX_RETENTION_HOURS"); retentionStr != "" {
+		retention, err := strconv.Atoi(retentionStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid OUTBOX_RETENTION_HOURS: %w", err)
+		}
+		cfg.OutboxRetentionHours = retention
+	}
+
+	// STREAM_BUFFER_SIZE
+	if sizeStr := os.Getenv("STREAM_BUFFER_SIZE"); sizeStr != "" {
+		size, err := strconv.Atoi(sizeStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid STREAM_BUFFER_SIZE: %w", err)
+		}
+		cfg.StreamBufferSize = size
+	}
+
+	// STREAM_HEARTBEAT_SECONDS
+	if heartbeatStr := os.Getenv("STREAM_HEARTBEAT_SECONDS"); heartbeatStr != "" {
+		heartbeat, err := strconv.Atoi(heartbeatStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid STREAM_HEARTBEAT_SECONDS: %w", err)
+		}
+		cfg.StreamHeartbeatSecs = heartbeat
+	}
+
+	// WEBHOOK_TIMEOUT_SECONDS
+	if timeoutStr := os.Getenv("WEBHOOK_TIMEOUT_SECONDS"); timeoutStr != "" {
+		timeout, err := strconv.Atoi(timeoutStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid WEBHOOK_TIMEOUT_SECONDS: %w", err)
+		}
+		cfg.WebhookTimeoutSecs = timeout
+	}
+
+	// WEBHOOK_DISABLE_AFTER
+	if disableStr := os.Getenv("WEBHOOK_DISABLE_AFTER"); disableStr != "" {
+		disable, err := strconv.Atoi(disableStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid WEBHOOK_DISABLE_AFTER: %w", err)
+		}
+		cfg.WebhookDisableAfter = disable
+	}
+
+	// SHUTDOWN_DRAIN_SECONDS
+	if drainStr := os.Getenv("SHUTDOWN_DRAIN_SECONDS"); drainStr != "" {
+		drain, err := strconv.Atoi(drainStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SHUTDOWN_DRAIN_SECONDS: %w", err)
+		}
+		cfg.ShutdownDrainSecs = drain
+	}
+
+	// JWT_JWKS, JWT_ISSUER, JWT_AUDIENCE (issuer and audience are required
+	// once a JWKS is set)
+	cfg.JWTJWKS = os.Getenv("JWT_JWKS")
+	cfg.JWTIssuer = os.Getenv("JWT_ISSUER")
+	cfg.JWTAudience = os.Getenv("JWT_AUDIENCE")
+	if cfg.JWTJWKS != "" && (cfg.JWTIssuer == "" || cfg.JWTAudience == "") {
+		return cfg, fmt.Errorf("JWT_ISSUER and JWT_AUDIENCE are required when JWT_JWKS is set")
+	}
+
+	// JWT_LEEWAY_SECONDS
+	if leewayStr := os.Getenv("JWT_LEEWAY_SECONDS"); leewayStr != "" {
+		leeway, err := strconv.Atoi(leewayStr)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid JWT_LEEWAY_SECONDS: %w", err)
+		}
+		cfg.JWTLeewaySecs = leeway
+	}
+
 	// Ensure sane values
 	if cfg.RateLimitRequests < 1 {
 		cfg.RateLimitRequests = 1
@@ -65,6 +310,45 @@ func LoadConfig() (Config, error) {
 	if cfg.RateLimitWindowSecs < 1 {
 		cfg.RateLimitWindowSecs = 1
 	}
+	if cfg.RateLimitMaxClients < 0 {
+		cfg.RateLimitMaxClients = 0
+	}
+	if cfg.RateLimitSweepEverySecs < 1 {
+		cfg.RateLimitSweepEverySecs = 1
+	}
+	if cfg.IdempotencyTTLSecs < 1 {
+		cfg.IdempotencyTTLSecs = 1
+	}
+	if cfg.IdempotencyPurgeEverySecs < 1 {
+		cfg.IdempotencyPurgeEverySecs = 1
+	}
+	if cfg.JWTLeewaySecs < 0 {
+		cfg.JWTLeewaySecs = 0
+	}
+	if cfg.ShutdownDrainSecs < 0 {
+		cfg.ShutdownDrainSecs = 0
+	}
+	if cfg.OutboxPollIntervalMs < 10 {
+		cfg.OutboxPollIntervalMs = 10
+	}
+	if cfg.OutboxMaxAttempts < 1 {
+		cfg.OutboxMaxAttempts = 1
+	}
+	if cfg.OutboxRetentionHours < 1 {
+		cfg.OutboxRetentionHours = 1
+	}
+	if cfg.StreamBufferSize < 1 {
+		cfg.StreamBufferSize = 1
+	}
+	if cfg.StreamHeartbeatSecs < 1 {
+		cfg.StreamHeartbeatSecs = 1
+	}
+	if cfg.WebhookTimeoutSecs < 1 {
+		cfg.WebhookTimeoutSecs = 1
+	}
+	if cfg.WebhookDisableAfter < 1 {
+		cfg.WebhookDisableAfter = 1
+	}
 
 	return cfg, nil
 }
@@ -4,9 +4,13 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/corradoisidoro/orders-api/internal/jwt"
+	"github.com/corradoisidoro/orders-api/internal/metrics"
 	appmw "github.com/corradoisidoro/orders-api/internal/middleware"
+	"github.com/corradoisidoro/orders-api/internal/model"
 	"github.com/go-chi/chi/v5"
 	chimw "github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
 )
 
 func (a *App) loadRoutes() {
@@ -15,31 +19,106 @@ func (a *App) loadRoutes() {
 	// Core middleware
 	r.Use(chimw.RequestID)
 	r.Use(chimw.RealIP)
-	r.Use(chimw.Logger)
+	r.Use(appmw.Metrics(routePattern(r)))
+	r.Use(appmw.RequestLogger)
+	r.Use(appmw.Tracing(otel.GetTracerProvider(), routePattern(r)))
 	r.Use(chimw.Recoverer)
-	r.Use(chimw.Timeout(60 * time.Second))
 
-	// App middleware
-	r.Use(appmw.RateLimitMiddleware(
-		a.config.RateLimitRequests,
-		a.config.RateLimitWindowSecs,
-	))
+	// App middleware. Authentication runs first so that rate limit
+	// policies can tell API keys apart.
+	r.Use(appmw.APIKeyAuthMiddleware(a.apiKeyRepo))
+	if a.jwtKeys != nil {
+		r.Use(appmw.JWTAuthMiddleware(&jwt.Verifier{
+			Keys:     a.jwtKeys,
+			Issuer:   a.config.JWTIssuer,
+			Audience: a.config.JWTAudience,
+			Leeway:   time.Duration(a.config.JWTLeewaySecs) * time.Second,
+		}))
+	}
 
-	// Health check
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		w.WriteHeader(http.StatusOK)
-	})
+	r.Use(appmw.RateLimitMiddleware(a.limiter, a.rateLimitPolicies(), routePattern(r)))
+
+	// The event stream lasts as long as the client stays, so it is exempt
+	// from the request timeout below.
+	r.With(appmw.RequireScope(model.ScopeOrdersRead)).Get("/orders/stream", a.streamHandler.Stream)
+
+	r.Group(func(r chi.Router) {
+		r.Use(chimw.Timeout(60 * time.Second))
+
+		// Health checks
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		r.Get("/healthz", a.healthHandler.Live)
+		r.Get("/readyz", a.healthHandler.Ready)
+
+		// Metrics, unless they have a port of their own
+		if a.config.AdminPort == 0 {
+			r.Method(http.MethodGet, "/metrics", metrics.Handler())
+		}
 
-	// API routes
-	r.Route("/orders", a.loadOrderRoutes)
+		// API routes
+		r.Route("/orders", a.loadOrderRoutes)
+		r.Route("/webhooks", a.loadWebhookRoutes)
+	})
 
 	a.router = r
 }
 
+// loadAdminRoutes builds the router served on the admin port, which is
+// meant to be reachable only from inside the deployment.
+func (a *App) loadAdminRoutes() {
+	r := chi.NewRouter()
+	r.Use(chimw.Recoverer)
+
+	r.Method(http.MethodGet, "/metrics", metrics.Handler())
+
+	a.adminRouter = r
+}
+
 func (a *App) loadOrderRoutes(r chi.Router) {
-	r.Post("/", a.orderHandler.Create)
-	r.Get("/", a.orderHandler.List)
-	r.Get("/{id}", a.orderHandler.GetByID)
-	r.Patch("/{id}", a.orderHandler.UpdateByID)
-	r.Delete("/{id}", a.orderHandler.DeleteByID)
+	idempotent := appmw.IdempotencyMiddleware(
+		a.idempotencyRepo,
+		time.Duration(a.config.IdempotencyTTLSecs)*time.Second,
+	)
+
+	read := appmw.RequireScope(model.ScopeOrdersRead)
+	write := appmw.RequireScope(model.ScopeOrdersWrite)
+	del := appmw.RequireScope(model.ScopeOrdersDelete)
+
+	r.With(write, idempotent).Post("/", a.orderHandler.Create)
+	r.With(read).Get("/", a.orderHandler.List)
+	r.With(read).Get("/{id}", a.orderHandler.GetByID)
+	r.With(write).Patch("/{id}", a.orderHandler.UpdateByID)
+	r.With(del).Delete("/{id}", a.orderHandler.DeleteByID)
+	r.With(write).Post("/{id}/cancel", a.orderHandler.Cancel)
+	r.With(read).Get("/{id}/history", a.orderHandler.History)
+	r.With(del, appmw.RequireStaff).Post("/{id}/restore", a.orderHandler.Restore)
+
+	r.With(read).Get("/{id}/line_items", a.orderHandler.ListLineItems)
+	r.With(write).Post("/{id}/line_items", a.orderHandler.CreateLineItem)
+	r.With(write).Patch("/{id}/line_items/{item_id}", a.orderHandler.UpdateLineItem)
+	r.With(write).Delete("/{id}/line_items/{item_id}", a.orderHandler.DeleteLineItem)
+}
+
+func (a *App) loadWebhookRoutes(r chi.Router) {
+	r.Use(appmw.RequireScope(model.ScopeWebhooks), appmw.RequireStaff)
+
+	r.Post("/", a.webhookHandler.Create)
+	r.Get("/", a.webhookHandler.List)
+	r.Delete("/{id}", a.webhookHandler.Delete)
+	r.Get("/{id}/deliveries", a.webhookHandler.ListDeliveries)
+}
+
+// routePattern returns a function that reports the pattern of the route mux
+// will serve a request with, such as "/orders/{id}", or "" if none matches.
+// It lets middleware that runs before routing act on the route.
+func routePattern(mux *chi.Mux) func(*http.Request) string {
+	return func(r *http.Request) string {
+		rctx := chi.NewRouteContext()
+		if !mux.Match(rctx, r.Method, r.URL.Path) {
+			return ""
+		}
+		return rctx.RoutePattern()
+	}
 }
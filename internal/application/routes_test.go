@@ -0,0 +1,124 @@
+package application_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/apikey"
+	"github.com/corradoisidoro/orders-api/internal/application"
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/ratelimit"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// newTestRouter returns the router of an App backed by an in-memory database
+// and a function that creates API keys in it.
+func newTestRouter(t *testing.T, cfg application.Config) (http.Handler, func(scopes ...model.Scope) string) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.APIKey{}, &model.Webhook{}, &model.WebhookDelivery{},
+		&model.Order{}, &model.LineItem{}, &model.OrderHistory{}))
+
+	newKey := func(scopes ...model.Scope) string {
+		token, keyID, hash, err := apikey.Generate()
+		require.NoError(t, err)
+		require.NoError(t, repository.NewAPIKeyRepo(db).Create(context.Background(), &model.APIKey{
+			KeyID: keyID, Name: "test", SecretHash: hash, Scopes: scopes,
+		}))
+		return token
+	}
+
+	return application.New(cfg, db).Router(), newKey
+}
+
+func serve(router http.Handler, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(`{"status":"paid"}`))
+	req.RemoteAddr = "192.0.2.1:1234"
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestRoutes_RateLimitPoliciesMatchRoutePatterns(t *testing.T) {
+	router, newKey := newTestRouter(t, application.Config{
+		RateLimitRequests:   100,
+		RateLimitWindowSecs: 60,
+		RateLimitPolicies: ratelimit.Policies{
+			{Name: "order-updates", Methods: []string{http.MethodPatch}, Routes: []string{"/orders/{id}"}, Requests: 1, WindowSecs: 60},
+		},
+	})
+	token := newKey(model.ScopeOrdersWrite)
+
+	// Health checks are never limited.
+	rr := serve(router, http.MethodGet, "/", "")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+
+	// The PATCH is rejected for lacking If-Match, but still counted.
+	rr = serve(router, http.MethodPatch, "/orders/5", token)
+	assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Limit"))
+
+	rr = serve(router, http.MethodPatch, "/orders/6", token)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+
+	// Other routes fall back to the default policy.
+	rr = serve(router, http.MethodGet, "/unknown", "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "100", rr.Header().Get("RateLimit-Limit"))
+}
+
+func TestRoutes_OrderRoutesRequireScopes(t *testing.T) {
+	router, newKey := newTestRouter(t, application.Config{RateLimitRequests: 100, RateLimitWindowSecs: 60})
+	reader := newKey(model.ScopeOrdersRead)
+	writer := newKey(model.ScopeOrdersRead, model.ScopeOrdersWrite)
+
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodPatch, "/orders/5", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodPatch, "/orders/5", "oak_bogus").Code)
+	assert.Equal(t, http.StatusForbidden, serve(router, http.MethodPatch, "/orders/5", reader).Code)
+	assert.Equal(t, http.StatusPreconditionRequired, serve(router, http.MethodPatch, "/orders/5", writer).Code)
+	assert.Equal(t, http.StatusForbidden, serve(router, http.MethodDelete, "/orders/5", writer).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/orders/5/history", "").Code)
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodGet, "/orders/5/history", reader).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodPost, "/orders/5/restore", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(router, http.MethodPost, "/orders/5/restore", writer).Code)
+
+	// Listing deleted orders, like restoring them, needs the delete scope.
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/orders", reader).Code)
+	assert.Equal(t, http.StatusForbidden, serve(router, http.MethodGet, "/orders?include_deleted=true", reader).Code)
+	deleter := newKey(model.ScopeOrdersRead, model.ScopeOrdersDelete)
+	assert.Equal(t, http.StatusOK, serve(router, http.MethodGet, "/orders?include_deleted=true", deleter).Code)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/orders/stream", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(router, http.MethodGet, "/orders/stream", newKey(model.ScopeOrdersWrite)).Code)
+	assert.Equal(t, http.StatusBadRequest, serve(router, http.MethodGet, "/orders/stream?status=lost", reader).Code)
+}
+
+func TestRoutes_WebhookRoutesRequireScope(t *testing.T) {
+	router, newKey := newTestRouter(t, application.Config{RateLimitRequests: 100, RateLimitWindowSecs: 60})
+	orders := newKey(model.ScopeOrdersRead, model.ScopeOrdersWrite)
+	admin := newKey(model.ScopeWebhooks)
+
+	assert.Equal(t, http.StatusUnauthorized, serve(router, http.MethodGet, "/webhooks", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(router, http.MethodGet, "/webhooks", orders).Code)
+
+	rr := serve(router, http.MethodGet, "/webhooks", admin)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `[]`, rr.Body.String())
+	assert.Equal(t, http.StatusNotFound, serve(router, http.MethodDelete, "/webhooks/1", admin).Code)
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/logging"
+)
+
+// defaultCheckTimeout bounds a readiness probe when HealthHandler.Timeout
+// is not set.
+const defaultCheckTimeout = 2 * time.Second
+
+// HealthCheck is a named readiness dependency check. Check returns nil if
+// the dependency is usable.
+type HealthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// HealthHandler serves the liveness and readiness probes. Readiness runs
+// every check concurrently and fails as soon as Drain has been called, so
+// that load balancers stop routing requests before the server shuts down.
+type HealthHandler struct {
+	Checks  []HealthCheck
+	Timeout time.Duration // per probe; defaultCheckTimeout if zero
+
+	draining atomic.Bool
+}
+
+type checkResult struct {
+	Status     string  `json:"status"` // "ok" or "fail"
+	Error      string  `json:"error,omitempty"`
+	DurationMS float64 `json:"duration_ms"`
+}
+
+type readinessResponse struct {
+	Status string                 `json:"status"` // "ok", "fail" or "draining"
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+// Drain makes readiness fail from now on.
+func (h *HealthHandler) Drain() {
+	h.draining.Store(true)
+}
+
+// Live reports that the process is up and serving requests. It checks no
+// dependencies, so that a database outage does not get the service
+// restarted.
+func (h *HealthHandler) Live(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Ready reports whether the service can serve traffic: 200 if every check
+// passes, 503 if any fails or the service is draining. The body details the
+// result of each check.
+func (h *HealthHandler) Ready(w http.ResponseWriter, r *http.Request) {
+	if h.draining.Load() {
+		writeJSON(w, http.StatusServiceUnavailable, readinessResponse{Status: "draining"})
+		return
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = defaultCheckTimeout
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	results := make([]checkResult, len(h.Checks))
+	var wg sync.WaitGroup
+	for i, c := range h.Checks {
+		wg.Go(func() {
+			start := time.Now()
+			err := c.Check(ctx)
+
+			res := checkResult{Status: "ok", DurationMS: float64(time.Since(start).Microseconds()) / 1000}
+			if err != nil {
+				res.Status = "fail"
+				res.Error = logging.Redact(err.Error())
+				slog.WarnContext(ctx, "readiness check failed", "check", c.Name, "error", err)
+			}
+			results[i] = res
+		})
+	}
+	wg.Wait()
+
+	resp := readinessResponse{Status: "ok", Checks: make(map[string]checkResult, len(h.Checks))}
+	status := http.StatusOK
+	for i, c := range h.Checks {
+		resp.Checks[c.Name] = results[i]
+		if results[i].Status != "ok" {
+			resp.Status = "fail"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	writeJSON(w, status, resp)
+}
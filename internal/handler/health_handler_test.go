@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func okCheck(context.Context) error { return nil }
+
+func TestHealthHandler_Live(t *testing.T) {
+	h := &HealthHandler{Checks: []HealthCheck{{Name: "database", Check: func(context.Context) error {
+		return errors.New("down")
+	}}}}
+
+	rr := newRecorder()
+	h.Live(rr, newRequest(http.MethodGet, "/healthz", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code, "liveness ignores dependencies")
+	assert.JSONEq(t, `{"status":"ok"}`, rr.Body.String())
+}
+
+func TestHealthHandler_Ready_AllPass(t *testing.T) {
+	h := &HealthHandler{Checks: []HealthCheck{{Name: "database", Check: okCheck}, {Name: "migrations", Check: okCheck}}}
+
+	rr := newRecorder()
+	h.Ready(rr, newRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp readinessResponse
+	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
+	assert.Equal(t, "ok", resp.Status)
+	assert.Equal(t, "ok", resp.Checks["database"].Status)
+	assert.Equal(t, "ok", resp.Checks["migrations"].Status)
+}
+
+func TestHealthHandler_Ready_CheckFails(t *testing.T) {
+	h := &HealthHandler{Checks: []HealthCheck{
+		{Name: "database", Check: func(context.Context) error {
+			return errors.New("dial postgres://app:hunter2@db:5432/orders: refused")
+		}},
+		{Name: "migrations", Check: okCheck},
+	}}
+
+	rr := newRecorder()
+	h.Ready(rr, newRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+
+	var resp readinessResponse
+	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
+	assert.Equal(t, "fail", resp.Status)
+	assert.Equal(t, "fail", resp.Checks["database"].Status)
+	assert.NotContains(t, resp.Checks["database"].Error, "hunter2")
+	assert.Equal(t, "ok", resp.Checks["migrations"].Status)
+}
+
+func TestHealthHandler_Ready_TimesOut(t *testing.T) {
+	h := &HealthHandler{
+		Timeout: 20 * time.Millisecond,
+		Checks: []HealthCheck{{Name: "database", Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		}}},
+	}
+
+	rr := newRecorder()
+	h.Ready(rr, newRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.Contains(t, rr.Body.String(), "deadline exceeded")
+}
+
+func TestHealthHandler_Ready_Draining(t *testing.T) {
+	h := &HealthHandler{Checks: []HealthCheck{{Name: "database", Check: okCheck}}}
+	h.Drain()
+
+	rr := newRecorder()
+	h.Ready(rr, newRequest(http.MethodGet, "/readyz", nil))
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code)
+	assert.JSONEq(t, `{"status":"draining"}`, rr.Body.String())
+}
@@ -2,17 +2,25 @@ package handler
 
 import (
 	"encoding/json"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
+	"github.com/corradoisidoro/orders-api/internal/model"
 	"github.com/go-chi/chi/v5"
 )
 
 func parseID(w http.ResponseWriter, r *http.Request) (int64, bool) {
-	idStr := chi.URLParam(r, "id")
+	return parseURLParamID(w, r, "id")
+}
+
+func parseURLParamID(w http.ResponseWriter, r *http.Request, key string) (int64, bool) {
+	idStr := chi.URLParam(r, key)
 	id, err := strconv.ParseInt(idStr, 10, 64)
 	if err != nil {
-		writeError(w, http.StatusBadRequest, "invalid id")
+		writeError(w, http.StatusBadRequest, "invalid "+key)
 		return 0, false
 	}
 	return id, true
@@ -33,6 +41,56 @@ func parseQueryInt(w http.ResponseWriter, r *http.Request, key string, defaultVa
 	return val, true
 }
 
+func parseQueryBool(w http.ResponseWriter, r *http.Request, key string) (bool, bool) {
+	valStr := r.URL.Query().Get(key)
+	if valStr == "" {
+		return false, true
+	}
+
+	val, err := strconv.ParseBool(valStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid "+key)
+		return false, false
+	}
+
+	return val, true
+}
+
+func parseQueryUint(w http.ResponseWriter, r *http.Request, key string) (*uint64, bool) {
+	valStr := r.URL.Query().Get(key)
+	if valStr == "" {
+		return nil, true
+	}
+
+	val, err := strconv.ParseUint(valStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid "+key)
+		return nil, false
+	}
+
+	return &val, true
+}
+
+func parseQueryTime(w http.ResponseWriter, r *http.Request, key string) (*time.Time, bool) {
+	valStr := r.URL.Query().Get(key)
+	if valStr == "" {
+		return nil, true
+	}
+
+	val, err := time.Parse(time.RFC3339, valStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid "+key+": expected RFC 3339 timestamp")
+		return nil, false
+	}
+
+	return &val, true
+}
+
+// normalizeCurrency upper-cases a currency code supplied by a client.
+func normalizeCurrency(c model.Currency) model.Currency {
+	return model.Currency(strings.ToUpper(strings.TrimSpace(string(c))))
+}
+
 func decodeJSON(r *http.Request, v any) error {
 	return json.NewDecoder(r.Body).Decode(v)
 }
@@ -46,3 +104,49 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 func writeError(w http.ResponseWriter, status int, msg string) {
 	writeJSON(w, status, map[string]string{"error": msg})
 }
+
+// writeServerError logs err and answers 500 with msg, which unlike err is
+// safe to show the caller.
+func writeServerError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	slog.ErrorContext(r.Context(), msg, "error", err)
+	writeError(w, http.StatusInternalServerError, msg)
+}
+
+// etag formats an order version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// setETag sets the ETag header to the given order version.
+func setETag(w http.ResponseWriter, version int64) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// parseIfMatch reads the order version from the If-Match header. "*" and, if
+// required is false, a missing header yield 0, meaning any version. A missing
+// required header is answered with 428 Precondition Required.
+func parseIfMatch(w http.ResponseWriter, r *http.Request, required bool) (int64, bool) {
+	val := strings.TrimSpace(r.Header.Get("If-Match"))
+	if val == "" {
+		if required {
+			writeError(w, http.StatusPreconditionRequired, "If-Match header is required")
+			return 0, false
+		}
+		return 0, true
+	}
+	if val == "*" {
+		return 0, true
+	}
+
+	unquoted, ok := strings.CutPrefix(val, `"`)
+	if ok {
+		unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	}
+	version, err := strconv.ParseInt(unquoted, 10, 64)
+	if !ok || err != nil || version < 1 {
+		writeError(w, http.StatusBadRequest, "invalid If-Match header")
+		return 0, false
+	}
+
+	return version, true
+}
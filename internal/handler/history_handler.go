@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+)
+
+// History pages through the changes made to an order, oldest first. It
+// accepts a limit and the cursor returned as "next" by the previous page.
+func (h *OrderHandler) History(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := parseQueryInt(w, r, "limit", defaultPageSize)
+	if !ok {
+		return
+	}
+	if limit < 1 {
+		writeError(w, http.StatusBadRequest, "limit must be > 0")
+		return
+	}
+	limit = min(limit, maxPageSize)
+
+	after, ok := parseQueryInt(w, r, "cursor", 0)
+	if !ok {
+		return
+	}
+	if after < 0 {
+		writeError(w, http.StatusBadRequest, "invalid cursor")
+		return
+	}
+
+	res, err := h.Repo.History(r.Context(), id, repository.HistoryPage{Size: limit, After: after})
+	if err != nil {
+		if errors.Is(err, repository.ErrNotExist) {
+			writeError(w, http.StatusNotFound, "order not found")
+			return
+		}
+		writeServerError(w, r, err, "failed to retrieve order history")
+		return
+	}
+
+	if res.Entries == nil {
+		res.Entries = []model.OrderHistory{}
+	}
+
+	var next string
+	if res.Next != 0 {
+		next = strconv.FormatInt(res.Next, 10)
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Items []model.OrderHistory `json:"items"`
+		Next  string               `json:"next"`
+	}{
+		Items: res.Entries,
+		Next:  next,
+	})
+}
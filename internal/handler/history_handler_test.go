@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistory_Success(t *testing.T) {
+	var got repository.HistoryPage
+	mockRepo := newMockRepo()
+	mockRepo.HistoryFn = func(ctx context.Context, orderID int64, p repository.HistoryPage) (repository.HistoryResult, error) {
+		got = p
+		return repository.HistoryResult{
+			Entries: []model.OrderHistory{{
+				ID:        8,
+				OrderID:   orderID,
+				Operation: model.OperationUpdate,
+				Actor:     "api_key:abc",
+				RequestID: "req-1",
+				Changes: model.Changes{
+					"status": {From: json.RawMessage(`"pending"`), To: json.RawMessage(`"paid"`)},
+				},
+			}},
+			Next: 8,
+		}, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	req := withRouteParam(newRequest(http.MethodGet, "/orders/5/history?limit=1&cursor=7", nil), "id", "5")
+	rr := newRecorder()
+
+	h.History(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, repository.HistoryPage{Size: 1, After: 7}, got)
+	assert.JSONEq(t, `{
+		"items": [{
+			"id": 8,
+			"order_id": 5,
+			"operation": "update",
+			"actor": "api_key:abc",
+			"request_id": "req-1",
+			"changes": {"status": {"from": "pending", "to": "paid"}},
+			"created_at": "0001-01-01T00:00:00Z"
+		}],
+		"next": "8"
+	}`, rr.Body.String())
+}
+
+func TestHistory_Empty(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	req := withRouteParam(newRequest(http.MethodGet, "/orders/5/history", nil), "id", "5")
+	rr := newRecorder()
+
+	h.History(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"items": [], "next": ""}`, rr.Body.String())
+}
+
+func TestHistory_OrderNotFound(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.HistoryFn = func(ctx context.Context, orderID int64, p repository.HistoryPage) (repository.HistoryResult, error) {
+		return repository.HistoryResult{}, repository.ErrNotExist
+	}
+
+	h := newHandler(mockRepo)
+
+	req := withRouteParam(newRequest(http.MethodGet, "/orders/5/history", nil), "id", "5")
+	rr := newRecorder()
+
+	h.History(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHistory_InvalidParameters(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	for _, query := range []string{"limit=0", "limit=x", "cursor=-1", "cursor=abc"} {
+		req := withRouteParam(newRequest(http.MethodGet, "/orders/5/history?"+query, nil), "id", "5")
+		rr := newRecorder()
+
+		h.History(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
@@ -0,0 +1,215 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+)
+
+func (h *OrderHandler) ListLineItems(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	items, err := h.Repo.ListLineItems(r.Context(), orderID)
+	if err != nil {
+		writeLineItemError(w, r, err, "failed to list line items")
+		return
+	}
+
+	if items == nil {
+		items = []model.LineItem{}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"items": items})
+}
+
+// CreateLineItem adds a line item to an order and returns it, with the
+// order's new ETag. If-Match is optional here, but honoured when sent.
+func (h *OrderHandler) CreateLineItem(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SKU         string         `json:"sku"`
+		ProductName string         `json:"product_name"`
+		Currency    model.Currency `json:"currency"`
+		Quantity    uint           `json:"quantity"`
+		Price       uint           `json:"price"`
+		Discount    uint           `json:"discount"`
+		TaxRateBps  uint           `json:"tax_rate_bps"`
+	}
+
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if body.Quantity < 1 {
+		writeError(w, http.StatusBadRequest, "quantity must be > 0")
+		return
+	}
+
+	orderID, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := parseIfMatch(w, r, false)
+	if !ok {
+		return
+	}
+
+	item := model.LineItem{
+		OrderID:     orderID,
+		SKU:         body.SKU,
+		ProductName: body.ProductName,
+		Currency:    normalizeCurrency(body.Currency),
+		Quantity:    body.Quantity,
+		Price:       body.Price,
+		Discount:    body.Discount,
+		TaxRateBps:  body.TaxRateBps,
+	}
+
+	version, err := h.Repo.InsertLineItem(r.Context(), &item, version)
+	if err != nil {
+		writeLineItemError(w, r, err, "failed to create line item")
+		return
+	}
+
+	setETag(w, version)
+	writeJSON(w, http.StatusCreated, item)
+}
+
+// UpdateLineItem changes the given fields of a line item and returns it,
+// with the order's new ETag. Like UpdateByID it requires If-Match.
+func (h *OrderHandler) UpdateLineItem(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		SKU         *string         `json:"sku"`
+		ProductName *string         `json:"product_name"`
+		Currency    *model.Currency `json:"currency"`
+		Quantity    *uint           `json:"quantity"`
+		Price       *uint           `json:"price"`
+		Discount    *uint           `json:"discount"`
+		TaxRateBps  *uint           `json:"tax_rate_bps"`
+	}
+
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if body.Quantity != nil && *body.Quantity < 1 {
+		writeError(w, http.StatusBadRequest, "quantity must be > 0")
+		return
+	}
+
+	orderID, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	itemID, ok := parseURLParamID(w, r, "item_id")
+	if !ok {
+		return
+	}
+
+	version, ok := parseIfMatch(w, r, true)
+	if !ok {
+		return
+	}
+
+	items, err := h.Repo.ListLineItems(r.Context(), orderID)
+	if err != nil {
+		writeLineItemError(w, r, err, "failed to retrieve line item")
+		return
+	}
+
+	var item *model.LineItem
+	for i := range items {
+		if items[i].ItemID == itemID {
+			item = &items[i]
+			break
+		}
+	}
+	if item == nil {
+		writeError(w, http.StatusNotFound, "line item not found")
+		return
+	}
+
+	if body.SKU != nil {
+		item.SKU = *body.SKU
+	}
+	if body.ProductName != nil {
+		item.ProductName = *body.ProductName
+	}
+	if body.Currency != nil {
+		item.Currency = normalizeCurrency(*body.Currency)
+	}
+	if body.Quantity != nil {
+		item.Quantity = *body.Quantity
+	}
+	if body.Price != nil {
+		item.Price = *body.Price
+	}
+	if body.Discount != nil {
+		item.Discount = *body.Discount
+	}
+	if body.TaxRateBps != nil {
+		item.TaxRateBps = *body.TaxRateBps
+	}
+
+	version, err = h.Repo.UpdateLineItem(r.Context(), item, version)
+	if err != nil {
+		writeLineItemError(w, r, err, "failed to update line item")
+		return
+	}
+
+	setETag(w, version)
+	writeJSON(w, http.StatusOK, item)
+}
+
+// DeleteLineItem removes a line item, sending the order's new ETag. Like
+// DeleteByID it requires If-Match.
+func (h *OrderHandler) DeleteLineItem(w http.ResponseWriter, r *http.Request) {
+	orderID, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+	itemID, ok := parseURLParamID(w, r, "item_id")
+	if !ok {
+		return
+	}
+
+	version, ok := parseIfMatch(w, r, true)
+	if !ok {
+		return
+	}
+
+	version, err := h.Repo.DeleteLineItem(r.Context(), orderID, itemID, version)
+	if err != nil {
+		writeLineItemError(w, r, err, "failed to delete line item")
+		return
+	}
+
+	setETag(w, version)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeLineItemError maps repository errors from line item operations to
+// responses, falling back to a 500 with msg.
+func writeLineItemError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	switch {
+	case errors.Is(err, repository.ErrNotExist):
+		writeError(w, http.StatusNotFound, "order not found")
+	case errors.Is(err, repository.ErrLineItemNotExist):
+		writeError(w, http.StatusNotFound, "line item not found")
+	case errors.Is(err, repository.ErrVersionConflict):
+		writeError(w, http.StatusPreconditionFailed, "order has been modified")
+	case errors.Is(err, repository.ErrOrderLocked):
+		writeError(w, http.StatusConflict, "order has shipped; line items can no longer be changed")
+	case errors.Is(err, repository.ErrInvalidInput):
+		writeError(w, http.StatusBadRequest, "invalid line item: check sku, product_name, amounts and that currency matches the order")
+	default:
+		writeServerError(w, r, err, msg)
+	}
+}
@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+//
+// --- LIST ---
+//
+
+func TestLineItems_List_Success(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.ListLineItemsFn = func(ctx context.Context, orderID int64) ([]model.LineItem, error) {
+		return []model.LineItem{{ItemID: 1, OrderID: orderID, Quantity: 2, Price: 300}}, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	req := withRouteParam(newRequest(http.MethodGet, "/orders/5/line_items", nil), "id", "5")
+	rr := newRecorder()
+
+	h.ListLineItems(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp struct {
+		Items []model.LineItem `json:"items"`
+	}
+	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
+	require.Len(t, resp.Items, 1)
+	assert.Equal(t, uint(2), resp.Items[0].Quantity)
+}
+
+func TestLineItems_List_OrderNotFound(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.ListLineItemsFn = func(ctx context.Context, orderID int64) ([]model.LineItem, error) {
+		return nil, repository.ErrNotExist
+	}
+
+	h := newHandler(mockRepo)
+
+	req := withRouteParam(newRequest(http.MethodGet, "/orders/5/line_items", nil), "id", "5")
+	rr := newRecorder()
+
+	h.ListLineItems(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+//
+// --- CREATE ---
+//
+
+func TestLineItems_Create_Success(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.InsertLineItemFn = func(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+		assert.Equal(t, int64(5), item.OrderID)
+		assert.Zero(t, version)
+		item.ItemID = 9
+		return 4, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{"quantity": 3, "price": 250}
+	req := withRouteParam(newRequest(http.MethodPost, "/orders/5/line_items", body), "id", "5")
+	rr := newRecorder()
+
+	h.CreateLineItem(rr, req)
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+
+	var resp model.LineItem
+	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
+	assert.Equal(t, int64(9), resp.ItemID)
+}
+
+func TestLineItems_Create_StaleIfMatch(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.InsertLineItemFn = func(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+		assert.Equal(t, int64(3), version)
+		return 0, repository.ErrVersionConflict
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{"quantity": 1, "price": 250}
+	req := withRouteParam(newRequest(http.MethodPost, "/orders/5/line_items", body), "id", "5")
+	req.Header.Set("If-Match", `"3"`)
+	rr := newRecorder()
+
+	h.CreateLineItem(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+}
+
+func TestLineItems_Create_InvalidQuantity(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	body := map[string]any{"quantity": 0, "price": 250}
+	req := withRouteParam(newRequest(http.MethodPost, "/orders/5/line_items", body), "id", "5")
+	rr := newRecorder()
+
+	h.CreateLineItem(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLineItems_Create_OrderShipped(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.InsertLineItemFn = func(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+		return 0, repository.ErrOrderLocked
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{"quantity": 1, "price": 250}
+	req := withRouteParam(newRequest(http.MethodPost, "/orders/5/line_items", body), "id", "5")
+	rr := newRecorder()
+
+	h.CreateLineItem(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+//
+// --- UPDATE ---
+//
+
+func TestLineItems_Update_Success(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.ListLineItemsFn = func(ctx context.Context, orderID int64) ([]model.LineItem, error) {
+		return []model.LineItem{{ItemID: 7, OrderID: orderID, Quantity: 1, Price: 100}}, nil
+	}
+
+	var updated model.LineItem
+	mockRepo.UpdateLineItemFn = func(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+		assert.Equal(t, int64(3), version)
+		updated = *item
+		return 4, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{"quantity": 4}
+	req := newRequest(http.MethodPatch, "/orders/5/line_items/7", body)
+	req = withRouteParam(req, "id", "5")
+	req = withRouteParam(req, "item_id", "7")
+	req.Header.Set("If-Match", `"3"`)
+	rr := newRecorder()
+
+	h.UpdateLineItem(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+	assert.Equal(t, uint(4), updated.Quantity)
+	assert.Equal(t, uint(100), updated.Price)
+}
+
+func TestLineItems_Update_StaleIfMatch(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.ListLineItemsFn = func(ctx context.Context, orderID int64) ([]model.LineItem, error) {
+		return []model.LineItem{{ItemID: 7, OrderID: orderID, Quantity: 1, Price: 100}}, nil
+	}
+	mockRepo.UpdateLineItemFn = func(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+		return 0, repository.ErrVersionConflict
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{"quantity": 4}
+	req := newRequest(http.MethodPatch, "/orders/5/line_items/7", body)
+	req = withRouteParam(req, "id", "5")
+	req = withRouteParam(req, "item_id", "7")
+	req.Header.Set("If-Match", `"3"`)
+	rr := newRecorder()
+
+	h.UpdateLineItem(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+}
+
+func TestLineItems_Update_RequiresIfMatch(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.UpdateLineItemFn = func(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+		t.Fatal("repository must not be called without If-Match")
+		return 0, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{"quantity": 4}
+	req := newRequest(http.MethodPatch, "/orders/5/line_items/7", body)
+	req = withRouteParam(req, "id", "5")
+	req = withRouteParam(req, "item_id", "7")
+	rr := newRecorder()
+
+	h.UpdateLineItem(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+}
+
+func TestLineItems_Update_ItemNotFound(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	body := map[string]any{"quantity": 4}
+	req := newRequest(http.MethodPatch, "/orders/5/line_items/7", body)
+	req = withRouteParam(req, "id", "5")
+	req = withRouteParam(req, "item_id", "7")
+	req.Header.Set("If-Match", "*")
+	rr := newRecorder()
+
+	h.UpdateLineItem(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestLineItems_Update_InvalidItemID(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	body := map[string]any{"quantity": 4}
+	req := newRequest(http.MethodPatch, "/orders/5/line_items/x", body)
+	req = withRouteParam(req, "id", "5")
+	req = withRouteParam(req, "item_id", "x")
+	rr := newRecorder()
+
+	h.UpdateLineItem(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//
+// --- DELETE ---
+//
+
+func TestLineItems_Delete_Success(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.DeleteLineItemFn = func(ctx context.Context, orderID, itemID, version int64) (int64, error) {
+		assert.Equal(t, int64(3), version)
+		return 4, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	req := newRequest(http.MethodDelete, "/orders/5/line_items/7", nil)
+	req = withRouteParam(req, "id", "5")
+	req = withRouteParam(req, "item_id", "7")
+	req.Header.Set("If-Match", `"3"`)
+	rr := newRecorder()
+
+	h.DeleteLineItem(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+}
+
+func TestLineItems_Delete_RequiresIfMatch(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.DeleteLineItemFn = func(ctx context.Context, orderID, itemID, version int64) (int64, error) {
+		t.Fatal("repository must not be called without If-Match")
+		return 0, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	req := newRequest(http.MethodDelete, "/orders/5/line_items/7", nil)
+	req = withRouteParam(req, "id", "5")
+	req = withRouteParam(req, "item_id", "7")
+	rr := newRecorder()
+
+	h.DeleteLineItem(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+}
+
+func TestLineItems_Delete_Errors(t *testing.T) {
+	cases := map[error]int{
+		repository.ErrLineItemNotExist: http.StatusNotFound,
+		repository.ErrVersionConflict:  http.StatusPreconditionFailed,
+		repository.ErrOrderLocked:      http.StatusConflict,
+		errors.New("db error"):         http.StatusInternalServerError,
+	}
+
+	for repoErr, want := range cases {
+		mockRepo := newMockRepo()
+		mockRepo.DeleteLineItemFn = func(ctx context.Context, orderID, itemID, version int64) (int64, error) {
+			return 0, repoErr
+		}
+
+		h := newHandler(mockRepo)
+
+		req := newRequest(http.MethodDelete, "/orders/5/line_items/7", nil)
+		req = withRouteParam(req, "id", "5")
+		req = withRouteParam(req, "item_id", "7")
+		req.Header.Set("If-Match", `"3"`)
+		rr := newRecorder()
+
+		h.DeleteLineItem(rr, req)
+
+		assert.Equal(t, want, rr.Code, repoErr.Error())
+	}
+}
@@ -2,20 +2,34 @@ package handler
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/middleware"
 	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
 	"github.com/corradoisidoro/orders-api/internal/repository"
 )
 
+// Page size limits for List.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
 type OrderHandler struct {
-	Repo repository.OrderRepository
+	Repo    repository.OrderRepository
+	Cursors *repository.CursorCodec
+	States  *orderstate.Machine
 }
 
 func (h *OrderHandler) Create(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		CustomerID int64            `json:"customer_id,string"`
+		Currency   model.Currency   `json:"currency"`
 		LineItems  []model.LineItem `json:"line_items"`
 	}
 
@@ -31,39 +45,113 @@ func (h *OrderHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	now := time.Now().UTC()
 
+	for i := range body.LineItems {
+		body.LineItems[i].Currency = normalizeCurrency(body.LineItems[i].Currency)
+	}
+
 	o := model.Order{
 		CustomerID: body.CustomerID,
+		Status:     h.States.Initial(),
+		Currency:   normalizeCurrency(body.Currency),
 		LineItems:  body.LineItems,
 		CreatedAt:  &now,
 	}
 
 	if err := h.Repo.Insert(r.Context(), &o); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to create order")
+		if errors.Is(err, repository.ErrOutOfScope) {
+			writeError(w, http.StatusForbidden, "cannot create orders for another customer")
+			return
+		}
+		var invalid *repository.ValidationError
+		if errors.As(err, &invalid) {
+			writeError(w, http.StatusBadRequest, "invalid order: "+invalid.Error())
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, "invalid order")
+			return
+		}
+		writeServerError(w, r, err, "failed to create order")
 		return
 	}
+	metrics.OrdersCreated.Inc()
 
 	// Normalize line_items
 	if o.LineItems == nil {
 		o.LineItems = []model.LineItem{}
 	}
 
+	setETag(w, o.Version)
 	writeJSON(w, http.StatusCreated, o)
 }
 
+// List pages through orders. It accepts the filters customer_id, status,
+// created_from, created_to, shipped_from, shipped_to, min_total and
+// max_total, a sort such as "created_at,-order_id", a limit, and the cursor
+// returned as "next" by the previous page. Staff may add include_deleted to
+// list deleted orders too.
 func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
-	cursor, ok := parseQueryInt(w, r, "cursor", 0)
+	limit, ok := parseQueryInt(w, r, "limit", defaultPageSize)
 	if !ok {
 		return
 	}
+	if limit < 1 {
+		writeError(w, http.StatusBadRequest, "limit must be > 0")
+		return
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
 
-	const defaultPageSize = 50
+	sort, err := repository.ParseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid sort")
+		return
+	}
 
-	res, err := h.Repo.FindAll(r.Context(), repository.Page{
-		Offset: cursor,
-		Size:   defaultPageSize,
-	})
+	filter, ok := parseOrderFilter(w, r)
+	if !ok {
+		return
+	}
+	if filter.Status != "" && !h.States.Known(filter.Status) {
+		writeError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+	// Deleted orders are listed under the same rules as restoring them.
+	if filter.IncludeDeleted {
+		client := middleware.ClientFrom(r.Context())
+		if !client.Staff || !client.Scopes.Has(model.ScopeOrdersDelete) {
+			writeError(w, http.StatusForbidden, "listing deleted orders needs staff and scope "+string(model.ScopeOrdersDelete))
+			return
+		}
+	}
+
+	page := repository.Page{
+		Size:   limit,
+		Sort:   sort,
+		Filter: filter,
+	}
+
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cursor, err := h.Cursors.Decode(token)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		page.After = &cursor
+	}
+
+	res, err := h.Repo.FindAll(r.Context(), page)
 	if err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to list orders")
+		if errors.Is(err, repository.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, "invalid list parameters")
+			return
+		}
+		writeServerError(w, r, err, "failed to list orders")
 		return
 	}
 
@@ -73,17 +161,64 @@ func (h *OrderHandler) List(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	var next string
+	if res.Next != nil {
+		next, err = h.Cursors.Encode(*res.Next)
+		if err != nil {
+			writeServerError(w, r, err, "failed to list orders")
+			return
+		}
+	}
+
 	response := struct {
 		Items []model.Order `json:"items"`
-		Next  int64         `json:"next"`
+		Next  string        `json:"next"`
 	}{
 		Items: res.Orders,
-		Next:  res.Cursor,
+		Next:  next,
 	}
 
 	writeJSON(w, http.StatusOK, response)
 }
 
+// parseOrderFilter reads List's filter query parameters.
+func parseOrderFilter(w http.ResponseWriter, r *http.Request) (repository.Filter, bool) {
+	var (
+		f  repository.Filter
+		ok bool
+	)
+
+	if f.CustomerID, ok = parseQueryInt(w, r, "customer_id", 0); !ok {
+		return f, false
+	}
+
+	f.Status = model.Status(r.URL.Query().Get("status"))
+
+	if f.CreatedFrom, ok = parseQueryTime(w, r, "created_from"); !ok {
+		return f, false
+	}
+	if f.CreatedTo, ok = parseQueryTime(w, r, "created_to"); !ok {
+		return f, false
+	}
+	if f.ShippedFrom, ok = parseQueryTime(w, r, "shipped_from"); !ok {
+		return f, false
+	}
+	if f.ShippedTo, ok = parseQueryTime(w, r, "shipped_to"); !ok {
+		return f, false
+	}
+	if f.MinTotal, ok = parseQueryUint(w, r, "min_total"); !ok {
+		return f, false
+	}
+	if f.MaxTotal, ok = parseQueryUint(w, r, "max_total"); !ok {
+		return f, false
+	}
+	if f.IncludeDeleted, ok = parseQueryBool(w, r, "include_deleted"); !ok {
+		return f, false
+	}
+
+	return f, true
+}
+
 func (h *OrderHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 	id, ok := parseID(w, r)
 	if !ok {
@@ -96,7 +231,7 @@ func (h *OrderHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "order not found")
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "failed to retrieve order")
+		writeServerError(w, r, err, "failed to retrieve order")
 		return
 	}
 
@@ -104,9 +239,12 @@ func (h *OrderHandler) GetByID(w http.ResponseWriter, r *http.Request) {
 		o.LineItems = []model.LineItem{}
 	}
 
+	setETag(w, o.Version)
 	writeJSON(w, http.StatusOK, o)
 }
 
+// UpdateByID changes an order's status. The request must carry the order's
+// ETag in If-Match; a stale one is answered with 412 Precondition Failed.
 func (h *OrderHandler) UpdateByID(w http.ResponseWriter, r *http.Request) {
 	var body struct {
 		Status string `json:"status"`
@@ -117,70 +255,202 @@ func (h *OrderHandler) UpdateByID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Cancellation needs a reason, so it has its own endpoint.
+	if model.Status(body.Status) == model.StatusCancelled {
+		writeError(w, http.StatusBadRequest, "use POST /orders/{id}/cancel to cancel an order")
+		return
+	}
+
 	id, ok := parseID(w, r)
 	if !ok {
 		return
 	}
 
+	version, ok := parseIfMatch(w, r, true)
+	if !ok {
+		return
+	}
+
+	o, ok := h.transition(w, r, id, version, model.Status(body.Status), nil)
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, o)
+}
+
+// Cancel cancels an order, recording a reason code, an optional note and the
+// caller as who cancelled it. Orders that have shipped or completed cannot
+// be cancelled.
+// If-Match is optional here, but honoured when sent.
+func (h *OrderHandler) Cancel(w http.ResponseWriter, r *http.Request) {
+	const maxNoteLength = 1000
+
+	var body struct {
+		Reason model.CancelReason `json:"reason"`
+		Note   string             `json:"note"`
+	}
+
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if !body.Reason.Valid() {
+		writeError(w, http.StatusBadRequest, "invalid reason")
+		return
+	}
+	if body.Reason == model.CancelReasonOther && strings.TrimSpace(body.Note) == "" {
+		writeError(w, http.StatusBadRequest, "note is required when reason is other")
+		return
+	}
+	if len(body.Note) > maxNoteLength {
+		writeError(w, http.StatusBadRequest, "note is too long")
+		return
+	}
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	version, ok := parseIfMatch(w, r, false)
+	if !ok {
+		return
+	}
+
+	o, ok := h.transition(w, r, id, version, model.StatusCancelled, func(o *model.Order) {
+		o.CancelReason = body.Reason
+		o.CancelNote = body.Note
+		o.CancelledBy = repository.ActorFrom(r.Context()).Name
+	})
+	if !ok {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, o)
+}
+
+// transition loads order id, moves it to status to and persists it. If
+// version is non-zero the order must still be at that version. mutate, if
+// non-nil, may set extra fields once the transition has been allowed. On
+// success the ETag header is set; on failure the error response has been
+// written and ok is false.
+func (h *OrderHandler) transition(w http.ResponseWriter, r *http.Request, id, version int64, to model.Status, mutate func(*model.Order)) (model.Order, bool) {
 	o, err := h.Repo.FindByID(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotExist) {
 			writeError(w, http.StatusNotFound, "order not found")
-			return
+			return model.Order{}, false
 		}
-		writeError(w, http.StatusInternalServerError, "failed to retrieve order")
-		return
+		writeServerError(w, r, err, "failed to retrieve order")
+		return model.Order{}, false
 	}
 
-	now := time.Now().UTC()
+	if version != 0 && o.Version != version {
+		writeError(w, http.StatusPreconditionFailed, "order has been modified")
+		return model.Order{}, false
+	}
 
-	switch body.Status {
-	case "shipped":
-		if o.ShippedAt != nil {
-			writeError(w, http.StatusBadRequest, "order already shipped")
-			return
+	if err := h.States.Apply(&o, to, time.Now().UTC()); err != nil {
+		if errors.Is(err, orderstate.ErrUnknownStatus) {
+			writeError(w, http.StatusBadRequest, "invalid status")
+			return model.Order{}, false
 		}
-		o.ShippedAt = &now
+		writeError(w, http.StatusConflict, fmt.Sprintf("order cannot move from %s to %s", o.Status, to))
+		return model.Order{}, false
+	}
 
-	case "completed":
-		if o.ShippedAt == nil {
-			writeError(w, http.StatusBadRequest, "order must be shipped before completion")
-			return
+	if mutate != nil {
+		mutate(&o)
+	}
+
+	if err := h.Repo.UpdateByID(r.Context(), &o); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			writeError(w, http.StatusPreconditionFailed, "order has been modified")
+			return model.Order{}, false
 		}
-		if o.CompletedAt != nil {
-			writeError(w, http.StatusBadRequest, "order already completed")
-			return
+		if errors.Is(err, orderstate.ErrInvalidTransition) {
+			writeError(w, http.StatusConflict, "order status changed concurrently")
+			return model.Order{}, false
 		}
-		o.CompletedAt = &now
+		if errors.Is(err, repository.ErrOutOfScope) {
+			writeError(w, http.StatusForbidden, "order belongs to another customer")
+			return model.Order{}, false
+		}
+		writeServerError(w, r, err, "failed to update order")
+		return model.Order{}, false
+	}
 
-	default:
-		writeError(w, http.StatusBadRequest, "invalid status")
-		return
+	switch to {
+	case model.StatusShipped:
+		metrics.OrdersShipped.Inc()
+	case model.StatusCompleted:
+		metrics.OrdersCompleted.Inc()
 	}
 
-	if err := h.Repo.UpdateByID(r.Context(), &o); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to update order")
-		return
+	if o.LineItems == nil {
+		o.LineItems = []model.LineItem{}
 	}
 
-	writeJSON(w, http.StatusOK, o)
+	setETag(w, o.Version)
+	return o, true
 }
 
+// DeleteByID deletes an order, which can be restored until it is purged.
+// Like UpdateByID it requires If-Match.
 func (h *OrderHandler) DeleteByID(w http.ResponseWriter, r *http.Request) {
 	id, ok := parseID(w, r)
 	if !ok {
 		return
 	}
 
-	err := h.Repo.DeleteByID(r.Context(), id)
+	version, ok := parseIfMatch(w, r, true)
+	if !ok {
+		return
+	}
+
+	err := h.Repo.DeleteByID(r.Context(), id, version)
 	if err != nil {
 		if errors.Is(err, repository.ErrNotExist) {
 			writeError(w, http.StatusNotFound, "order not found")
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "failed to delete order")
+		if errors.Is(err, repository.ErrVersionConflict) {
+			writeError(w, http.StatusPreconditionFailed, "order has been modified")
+			return
+		}
+		writeServerError(w, r, err, "failed to delete order")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// Restore undeletes an order and returns it.
+func (h *OrderHandler) Restore(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	o, err := h.Repo.Restore(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotExist) {
+			writeError(w, http.StatusNotFound, "order not found")
+			return
+		}
+		if errors.Is(err, repository.ErrNotDeleted) {
+			writeError(w, http.StatusConflict, "order is not deleted")
+			return
+		}
+		writeServerError(w, r, err, "failed to restore order")
+		return
+	}
+
+	if o.LineItems == nil {
+		o.LineItems = []model.LineItem{}
+	}
+
+	setETag(w, o.Version)
+	writeJSON(w, http.StatusOK, o)
+}
@@ -5,15 +5,21 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/middleware"
 	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
 	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -27,7 +33,14 @@ type mockOrderRepo struct {
 	FindAllFn    func(ctx context.Context, p repository.Page) (repository.Result, error)
 	FindByIDFn   func(ctx context.Context, id int64) (model.Order, error)
 	UpdateByIDFn func(ctx context.Context, o *model.Order) error
-	DeleteByIDFn func(ctx context.Context, id int64) error
+	DeleteByIDFn func(ctx context.Context, id, version int64) error
+	HistoryFn    func(ctx context.Context, orderID int64, p repository.HistoryPage) (repository.HistoryResult, error)
+	RestoreFn    func(ctx context.Context, id int64) (model.Order, error)
+
+	ListLineItemsFn  func(ctx context.Context, orderID int64) ([]model.LineItem, error)
+	InsertLineItemFn func(ctx context.Context, item *model.LineItem, version int64) (int64, error)
+	UpdateLineItemFn func(ctx context.Context, item *model.LineItem, version int64) (int64, error)
+	DeleteLineItemFn func(ctx context.Context, orderID, itemID, version int64) (int64, error)
 }
 
 func newMockRepo() *mockOrderRepo {
@@ -38,7 +51,16 @@ func newMockRepo() *mockOrderRepo {
 		},
 		FindByIDFn:   func(ctx context.Context, id int64) (model.Order, error) { return model.Order{}, nil },
 		UpdateByIDFn: func(ctx context.Context, o *model.Order) error { return nil },
-		DeleteByIDFn: func(ctx context.Context, id int64) error { return nil },
+		DeleteByIDFn: func(ctx context.Context, id, version int64) error { return nil },
+		HistoryFn: func(ctx context.Context, orderID int64, p repository.HistoryPage) (repository.HistoryResult, error) {
+			return repository.HistoryResult{}, nil
+		},
+		RestoreFn: func(ctx context.Context, id int64) (model.Order, error) { return model.Order{}, nil },
+
+		ListLineItemsFn:  func(ctx context.Context, orderID int64) ([]model.LineItem, error) { return nil, nil },
+		InsertLineItemFn: func(ctx context.Context, item *model.LineItem, version int64) (int64, error) { return version + 1, nil },
+		UpdateLineItemFn: func(ctx context.Context, item *model.LineItem, version int64) (int64, error) { return version + 1, nil },
+		DeleteLineItemFn: func(ctx context.Context, orderID, itemID, version int64) (int64, error) { return version + 1, nil },
 	}
 }
 
@@ -54,8 +76,29 @@ func (m *mockOrderRepo) FindByID(ctx context.Context, id int64) (model.Order, er
 func (m *mockOrderRepo) UpdateByID(ctx context.Context, o *model.Order) error {
 	return m.UpdateByIDFn(ctx, o)
 }
-func (m *mockOrderRepo) DeleteByID(ctx context.Context, id int64) error {
-	return m.DeleteByIDFn(ctx, id)
+func (m *mockOrderRepo) DeleteByID(ctx context.Context, id, version int64) error {
+	return m.DeleteByIDFn(ctx, id, version)
+}
+func (m *mockOrderRepo) History(ctx context.Context, orderID int64, p repository.HistoryPage) (repository.HistoryResult, error) {
+	return m.HistoryFn(ctx, orderID, p)
+}
+func (m *mockOrderRepo) Restore(ctx context.Context, id int64) (model.Order, error) {
+	return m.RestoreFn(ctx, id)
+}
+func (m *mockOrderRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+func (m *mockOrderRepo) ListLineItems(ctx context.Context, orderID int64) ([]model.LineItem, error) {
+	return m.ListLineItemsFn(ctx, orderID)
+}
+func (m *mockOrderRepo) InsertLineItem(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+	return m.InsertLineItemFn(ctx, item, version)
+}
+func (m *mockOrderRepo) UpdateLineItem(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+	return m.UpdateLineItemFn(ctx, item, version)
+}
+func (m *mockOrderRepo) DeleteLineItem(ctx context.Context, orderID, itemID, version int64) (int64, error) {
+	return m.DeleteLineItemFn(ctx, orderID, itemID, version)
 }
 
 //
@@ -70,14 +113,26 @@ func newRequest(method, path string, body any) *http.Request {
 	return httptest.NewRequest(method, path, &buf)
 }
 
+func newHandler(repo repository.OrderRepository) *OrderHandler {
+	return &OrderHandler{
+		Repo:    repo,
+		Cursors: repository.NewCursorCodec(nil),
+		States:  orderstate.Default(),
+	}
+}
+
 func newRecorder() *httptest.ResponseRecorder {
 	return httptest.NewRecorder()
 }
 
 func withRouteParam(req *http.Request, key, value string) *http.Request {
-	rctx := chi.NewRouteContext()
+	rctx, ok := req.Context().Value(chi.RouteCtxKey).(*chi.Context)
+	if !ok {
+		rctx = chi.NewRouteContext()
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	}
 	rctx.URLParams.Add(key, value)
-	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	return req
 }
 
 func decodeResponseJSON(t *testing.T, body []byte, v any) {
@@ -96,7 +151,7 @@ func TestOrderHandler_Create_Success(t *testing.T) {
 		return nil
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	body := map[string]any{
 		"customer_id": "1",
@@ -105,18 +160,72 @@ func TestOrderHandler_Create_Success(t *testing.T) {
 
 	req := newRequest(http.MethodPost, "/orders", body)
 	rr := newRecorder()
+	created := testutil.ToFloat64(metrics.OrdersCreated)
 
 	h.Create(rr, req)
 
 	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, created+1, testutil.ToFloat64(metrics.OrdersCreated))
 
 	var resp model.Order
 	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
 	assert.Equal(t, int64(123), resp.OrderID)
 }
 
+func TestOrderHandler_Create_NormalizesCurrency(t *testing.T) {
+	var inserted model.Order
+	mockRepo := newMockRepo()
+	mockRepo.InsertFn = func(ctx context.Context, o *model.Order) error {
+		inserted = *o
+		return nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{
+		"customer_id": "1",
+		"currency":    "eur",
+		"line_items": []map[string]any{
+			{"sku": "SKU-1", "product_name": "Widget", "currency": "eur", "quantity": 1, "price": 100},
+		},
+	}
+
+	rr := newRecorder()
+	h.Create(rr, newRequest(http.MethodPost, "/orders", body))
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, model.Currency("EUR"), inserted.Currency)
+	require.Len(t, inserted.LineItems, 1)
+	assert.Equal(t, model.Currency("EUR"), inserted.LineItems[0].Currency)
+	assert.Equal(t, "SKU-1", inserted.LineItems[0].SKU)
+	assert.Equal(t, "Widget", inserted.LineItems[0].ProductName)
+}
+
+func TestOrderHandler_Create_InvalidOrder(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.InsertFn = func(ctx context.Context, o *model.Order) error {
+		return fmt.Errorf("validate order: %w", &repository.ValidationError{Field: "line_items[1].currency", Reason: "must match the order's currency"})
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{
+		"customer_id": "1",
+		"line_items": []map[string]any{
+			{"currency": "EUR", "quantity": 1},
+			{"currency": "USD", "quantity": 1},
+		},
+	}
+
+	rr := newRecorder()
+	h.Create(rr, newRequest(http.MethodPost, "/orders", body))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.JSONEq(t, `{"error":"invalid order: line_items[1].currency must match the order's currency"}`, rr.Body.String())
+}
+
 func TestOrderHandler_Create_InvalidJSON(t *testing.T) {
-	h := OrderHandler{Repo: newMockRepo()}
+	h := newHandler(newMockRepo())
 
 	req := httptest.NewRequest(http.MethodPost, "/orders", bytes.NewBufferString("{invalid"))
 	rr := newRecorder()
@@ -127,7 +236,7 @@ func TestOrderHandler_Create_InvalidJSON(t *testing.T) {
 }
 
 func TestOrderHandler_Create_InvalidCustomerID(t *testing.T) {
-	h := OrderHandler{Repo: newMockRepo()}
+	h := newHandler(newMockRepo())
 
 	body := map[string]any{"customer_id": 0}
 	req := newRequest(http.MethodPost, "/orders", body)
@@ -144,7 +253,7 @@ func TestOrderHandler_Create_InsertFails(t *testing.T) {
 		return errors.New("db error")
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	body := map[string]any{"customer_id": "1"}
 	req := newRequest(http.MethodPost, "/orders", body)
@@ -155,8 +264,25 @@ func TestOrderHandler_Create_InsertFails(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
+func TestOrderHandler_Create_OtherCustomer(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.InsertFn = func(ctx context.Context, o *model.Order) error {
+		return repository.ErrOutOfScope
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]any{"customer_id": "2"}
+	req := newRequest(http.MethodPost, "/orders", body)
+	rr := newRecorder()
+
+	h.Create(rr, req)
+
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+}
+
 func TestOrderHandler_Create_MissingCustomerID(t *testing.T) {
-	h := OrderHandler{Repo: newMockRepo()}
+	h := newHandler(newMockRepo())
 
 	body := map[string]any{}
 	req := newRequest(http.MethodPost, "/orders", body)
@@ -172,19 +298,22 @@ func TestOrderHandler_Create_MissingCustomerID(t *testing.T) {
 //
 
 func TestOrderHandler_List_Success(t *testing.T) {
+	cursors := repository.NewCursorCodec([]byte("test"))
+
 	mockRepo := newMockRepo()
 	mockRepo.FindAllFn = func(ctx context.Context, p repository.Page) (repository.Result, error) {
 		return repository.Result{
 			Orders: []model.Order{
 				{OrderID: 1, LineItems: nil},
 			},
-			Cursor: 10,
+			Next: &repository.Cursor{Sort: "order_id", OrderID: 1},
 		}, nil
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
+	h.Cursors = cursors
 
-	req := newRequest(http.MethodGet, "/orders?cursor=0", nil)
+	req := newRequest(http.MethodGet, "/orders", nil)
 	rr := newRecorder()
 
 	h.List(rr, req)
@@ -193,16 +322,162 @@ func TestOrderHandler_List_Success(t *testing.T) {
 
 	var resp struct {
 		Items []model.Order `json:"items"`
-		Next  int64         `json:"next"`
+		Next  string        `json:"next"`
 	}
 	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
 
-	assert.Equal(t, int64(10), resp.Next)
+	next, err := cursors.Decode(resp.Next)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), next.OrderID)
 	assert.Equal(t, []model.LineItem{}, resp.Items[0].LineItems)
 }
 
+func TestOrderHandler_List_PassesCursorToRepo(t *testing.T) {
+	cursors := repository.NewCursorCodec([]byte("test"))
+	token, err := cursors.Encode(repository.Cursor{Sort: "order_id", OrderID: 7})
+	require.NoError(t, err)
+
+	var got repository.Page
+	mockRepo := newMockRepo()
+	mockRepo.FindAllFn = func(ctx context.Context, p repository.Page) (repository.Result, error) {
+		got = p
+		return repository.Result{}, nil
+	}
+
+	h := newHandler(mockRepo)
+	h.Cursors = cursors
+
+	req := newRequest(http.MethodGet, "/orders?cursor="+token, nil)
+	rr := newRecorder()
+
+	h.List(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	require.NotNil(t, got.After)
+	assert.Equal(t, int64(7), got.After.OrderID)
+
+	var resp struct {
+		Next string `json:"next"`
+	}
+	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
+	assert.Empty(t, resp.Next)
+}
+
+func TestOrderHandler_List_PassesFiltersAndSort(t *testing.T) {
+	var got repository.Page
+	mockRepo := newMockRepo()
+	mockRepo.FindAllFn = func(ctx context.Context, p repository.Page) (repository.Result, error) {
+		got = p
+		return repository.Result{}, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	req := newRequest(http.MethodGet, "/orders?customer_id=9&status=shipped"+
+		"&created_from=2025-01-01T00:00:00Z&shipped_to=2025-02-01T00:00:00Z"+
+		"&min_total=100&max_total=900&include_deleted=true&sort=created_at,-order_id&limit=10", nil)
+	req = req.WithContext(middleware.WithClient(req.Context(), middleware.Client{
+		APIKeyID: "k1", Staff: true, Scopes: model.Scopes{model.ScopeOrdersRead, model.ScopeOrdersDelete},
+	}))
+	rr := newRecorder()
+
+	h.List(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(10), got.Size)
+	assert.Equal(t, "created_at,-order_id", got.Sort.String())
+	assert.Equal(t, int64(9), got.Filter.CustomerID)
+	assert.Equal(t, model.StatusShipped, got.Filter.Status)
+	require.NotNil(t, got.Filter.CreatedFrom)
+	assert.Equal(t, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), *got.Filter.CreatedFrom)
+	assert.Nil(t, got.Filter.CreatedTo)
+	require.NotNil(t, got.Filter.ShippedTo)
+	require.NotNil(t, got.Filter.MinTotal)
+	assert.Equal(t, uint64(100), *got.Filter.MinTotal)
+	require.NotNil(t, got.Filter.MaxTotal)
+	assert.Equal(t, uint64(900), *got.Filter.MaxTotal)
+	assert.True(t, got.Filter.IncludeDeleted)
+}
+
+func TestOrderHandler_List_IncludeDeletedNeedsStaffWithDeleteScope(t *testing.T) {
+	cases := map[string]middleware.Client{
+		"customer":        {Subject: "alice", CustomerID: 7, Scopes: model.Scopes{model.ScopeOrdersRead, model.ScopeOrdersDelete}},
+		"read-only staff": {APIKeyID: "k1", Staff: true, Scopes: model.Scopes{model.ScopeOrdersRead}},
+	}
+
+	for name, client := range cases {
+		mockRepo := newMockRepo()
+		mockRepo.FindAllFn = func(ctx context.Context, p repository.Page) (repository.Result, error) {
+			t.Fatal("repository must not be called")
+			return repository.Result{}, nil
+		}
+
+		h := newHandler(mockRepo)
+
+		req := newRequest(http.MethodGet, "/orders?include_deleted=true", nil)
+		req = req.WithContext(middleware.WithClient(req.Context(), client))
+		rr := newRecorder()
+
+		h.List(rr, req)
+
+		assert.Equal(t, http.StatusForbidden, rr.Code, name)
+	}
+}
+
+func TestOrderHandler_List_ClampsLimit(t *testing.T) {
+	var got repository.Page
+	mockRepo := newMockRepo()
+	mockRepo.FindAllFn = func(ctx context.Context, p repository.Page) (repository.Result, error) {
+		got = p
+		return repository.Result{}, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	rr := newRecorder()
+	h.List(rr, newRequest(http.MethodGet, "/orders?limit=100000", nil))
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(maxPageSize), got.Size)
+}
+
+func TestOrderHandler_List_InvalidParams(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	for _, query := range []string{
+		"limit=0",
+		"limit=abc",
+		"sort=line_items",
+		"status=lost",
+		"status=shipped,paid",
+		"customer_id=x",
+		"created_from=yesterday",
+		"min_total=-1",
+		"include_deleted=maybe",
+	} {
+		rr := newRecorder()
+		h.List(rr, newRequest(http.MethodGet, "/orders?"+query, nil))
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+func TestOrderHandler_List_RepoRejectsInput(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindAllFn = func(ctx context.Context, p repository.Page) (repository.Result, error) {
+		return repository.Result{}, repository.ErrInvalidInput
+	}
+
+	h := newHandler(mockRepo)
+
+	rr := newRecorder()
+	h.List(rr, newRequest(http.MethodGet, "/orders?min_total=10&max_total=1", nil))
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
 func TestOrderHandler_List_InvalidCursor(t *testing.T) {
-	h := OrderHandler{Repo: newMockRepo()}
+	h := newHandler(newMockRepo())
 
 	req := newRequest(http.MethodGet, "/orders?cursor=abc", nil)
 	rr := newRecorder()
@@ -212,15 +487,31 @@ func TestOrderHandler_List_InvalidCursor(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
+func TestOrderHandler_List_RepoRejectsCursor(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindAllFn = func(ctx context.Context, p repository.Page) (repository.Result, error) {
+		return repository.Result{}, repository.ErrInvalidCursor
+	}
+
+	h := newHandler(mockRepo)
+
+	req := newRequest(http.MethodGet, "/orders", nil)
+	rr := newRecorder()
+
+	h.List(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
 func TestOrderHandler_List_RepoError(t *testing.T) {
 	mockRepo := newMockRepo()
 	mockRepo.FindAllFn = func(ctx context.Context, p repository.Page) (repository.Result, error) {
 		return repository.Result{}, errors.New("db error")
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
-	req := newRequest(http.MethodGet, "/orders?cursor=0", nil)
+	req := newRequest(http.MethodGet, "/orders", nil)
 	rr := newRecorder()
 
 	h.List(rr, req)
@@ -235,10 +526,10 @@ func TestOrderHandler_List_RepoError(t *testing.T) {
 func TestOrderHandler_GetByID_Success(t *testing.T) {
 	mockRepo := newMockRepo()
 	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
-		return model.Order{OrderID: id, LineItems: nil}, nil
+		return model.Order{OrderID: id, LineItems: nil, Version: 3}, nil
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	req := newRequest(http.MethodGet, "/orders/5", nil)
 	req = withRouteParam(req, "id", "5")
@@ -247,10 +538,11 @@ func TestOrderHandler_GetByID_Success(t *testing.T) {
 	h.GetByID(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
 }
 
 func TestOrderHandler_GetByID_InvalidID(t *testing.T) {
-	h := OrderHandler{Repo: newMockRepo()}
+	h := newHandler(newMockRepo())
 
 	req := newRequest(http.MethodGet, "/orders/abc", nil)
 	req = withRouteParam(req, "id", "abc")
@@ -267,7 +559,7 @@ func TestOrderHandler_GetByID_NotFound(t *testing.T) {
 		return model.Order{}, repository.ErrNotExist
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	req := newRequest(http.MethodGet, "/orders/5", nil)
 	req = withRouteParam(req, "id", "5")
@@ -284,7 +576,7 @@ func TestOrderHandler_GetByID_RepoError(t *testing.T) {
 		return model.Order{}, errors.New("db error")
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	req := newRequest(http.MethodGet, "/orders/5", nil)
 	req = withRouteParam(req, "id", "5")
@@ -299,54 +591,89 @@ func TestOrderHandler_GetByID_RepoError(t *testing.T) {
 // --- UPDATE ---
 //
 
+func TestOrderHandler_UpdateByID_Paid_Success(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{OrderID: id, Status: model.StatusPending}, nil
+	}
+
+	var updated model.Order
+	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
+		updated = *o
+		return nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"status": "paid"}
+	req := newRequest(http.MethodPatch, "/orders/5", body)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
+	rr := newRecorder()
+
+	h.UpdateByID(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, model.StatusPaid, updated.Status)
+	assert.NotNil(t, updated.PaidAt)
+}
+
 func TestOrderHandler_UpdateByID_Shipped_Success(t *testing.T) {
 	mockRepo := newMockRepo()
 	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
-		return model.Order{OrderID: id}, nil
+		now := time.Now().UTC()
+		return model.Order{OrderID: id, Status: model.StatusPaid, PaidAt: &now}, nil
 	}
 	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
 		return nil
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	body := map[string]string{"status": "shipped"}
 	req := newRequest(http.MethodPatch, "/orders/5", body)
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
+	before := testutil.ToFloat64(metrics.OrdersShipped)
 
 	h.UpdateByID(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.OrdersShipped))
 }
 
 func TestOrderHandler_UpdateByID_Completed_Success(t *testing.T) {
 	mockRepo := newMockRepo()
 	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
 		now := time.Now().UTC()
-		return model.Order{OrderID: id, ShippedAt: &now}, nil
+		return model.Order{OrderID: id, Status: model.StatusShipped, PaidAt: &now, ShippedAt: &now}, nil
 	}
 	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
 		return nil
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	body := map[string]string{"status": "completed"}
 	req := newRequest(http.MethodPatch, "/orders/5", body)
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
+	before := testutil.ToFloat64(metrics.OrdersCompleted)
 
 	h.UpdateByID(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, before+1, testutil.ToFloat64(metrics.OrdersCompleted))
 }
 
 func TestOrderHandler_UpdateByID_InvalidJSON(t *testing.T) {
-	h := OrderHandler{Repo: newMockRepo()}
+	h := newHandler(newMockRepo())
 
 	req := httptest.NewRequest(http.MethodPatch, "/orders/5", bytes.NewBufferString("{invalid"))
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
 
 	h.UpdateByID(rr, req)
@@ -360,11 +687,12 @@ func TestOrderHandler_UpdateByID_InvalidStatus(t *testing.T) {
 		return model.Order{OrderID: id}, nil
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	body := map[string]string{"status": "unknown"}
 	req := newRequest(http.MethodPatch, "/orders/5", body)
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
 
 	h.UpdateByID(rr, req)
@@ -372,17 +700,64 @@ func TestOrderHandler_UpdateByID_InvalidStatus(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code)
 }
 
+func TestOrderHandler_UpdateByID_TransitionNotAllowed(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{OrderID: id, Status: model.StatusPending}, nil
+	}
+	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
+		t.Fatal("repository must not be called for a rejected transition")
+		return nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"status": "shipped"}
+	req := newRequest(http.MethodPatch, "/orders/5", body)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
+	rr := newRecorder()
+
+	h.UpdateByID(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.JSONEq(t, `{"error":"order cannot move from pending to shipped"}`, rr.Body.String())
+}
+
+func TestOrderHandler_UpdateByID_ConcurrentTransition(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{OrderID: id, Status: model.StatusPending}, nil
+	}
+	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
+		return orderstate.ErrInvalidTransition
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"status": "paid"}
+	req := newRequest(http.MethodPatch, "/orders/5", body)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
+	rr := newRecorder()
+
+	h.UpdateByID(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
 func TestOrderHandler_UpdateByID_NotFound(t *testing.T) {
 	mockRepo := newMockRepo()
 	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
 		return model.Order{}, repository.ErrNotExist
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	body := map[string]string{"status": "shipped"}
 	req := newRequest(http.MethodPatch, "/orders/5", body)
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
 
 	h.UpdateByID(rr, req)
@@ -393,17 +768,18 @@ func TestOrderHandler_UpdateByID_NotFound(t *testing.T) {
 func TestOrderHandler_UpdateByID_RepoError(t *testing.T) {
 	mockRepo := newMockRepo()
 	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
-		return model.Order{OrderID: id}, nil
+		return model.Order{OrderID: id, Status: model.StatusPending}, nil
 	}
 	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
 		return errors.New("db error")
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
-	body := map[string]string{"status": "shipped"}
+	body := map[string]string{"status": "paid"}
 	req := newRequest(http.MethodPatch, "/orders/5", body)
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
 
 	h.UpdateByID(rr, req)
@@ -411,20 +787,233 @@ func TestOrderHandler_UpdateByID_RepoError(t *testing.T) {
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
 
+func TestOrderHandler_UpdateByID_RequiresIfMatch(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		t.Fatal("repository must not be called without If-Match")
+		return model.Order{}, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"status": "paid"}
+	req := newRequest(http.MethodPatch, "/orders/5", body)
+	req = withRouteParam(req, "id", "5")
+	rr := newRecorder()
+
+	h.UpdateByID(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+}
+
+func TestOrderHandler_UpdateByID_InvalidIfMatch(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	for _, header := range []string{"3", `W/"3"`, `"abc"`, `"0"`} {
+		body := map[string]string{"status": "paid"}
+		req := newRequest(http.MethodPatch, "/orders/5", body)
+		req = withRouteParam(req, "id", "5")
+		req.Header.Set("If-Match", header)
+		rr := newRecorder()
+
+		h.UpdateByID(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, header)
+	}
+}
+
+func TestOrderHandler_UpdateByID_MatchingIfMatch(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{OrderID: id, Status: model.StatusPending, Version: 3}, nil
+	}
+
+	var updated model.Order
+	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
+		updated = *o
+		o.Version++
+		return nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"status": "paid"}
+	req := newRequest(http.MethodPatch, "/orders/5", body)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", `"3"`)
+	rr := newRecorder()
+
+	h.UpdateByID(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, int64(3), updated.Version)
+	assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+}
+
+func TestOrderHandler_UpdateByID_StaleIfMatch(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{OrderID: id, Status: model.StatusPending, Version: 4}, nil
+	}
+	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
+		t.Fatal("repository must not be called with a stale If-Match")
+		return nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"status": "paid"}
+	req := newRequest(http.MethodPatch, "/orders/5", body)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", `"3"`)
+	rr := newRecorder()
+
+	h.UpdateByID(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+}
+
+func TestOrderHandler_UpdateByID_VersionConflict(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{OrderID: id, Status: model.StatusPending, Version: 3}, nil
+	}
+	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
+		return repository.ErrVersionConflict
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"status": "paid"}
+	req := newRequest(http.MethodPatch, "/orders/5", body)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", `"3"`)
+	rr := newRecorder()
+
+	h.UpdateByID(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+}
+
+func TestOrderHandler_UpdateByID_RejectsCancelled(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	body := map[string]string{"status": "cancelled"}
+	req := newRequest(http.MethodPatch, "/orders/5", body)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
+	rr := newRecorder()
+
+	h.UpdateByID(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+//
+// --- CANCEL ---
+//
+
+func TestOrderHandler_Cancel_Success(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{OrderID: id, Status: model.StatusPending}, nil
+	}
+
+	var updated model.Order
+	mockRepo.UpdateByIDFn = func(ctx context.Context, o *model.Order) error {
+		updated = *o
+		return nil
+	}
+
+	h := newHandler(mockRepo)
+
+	// A cancelled_by in the body cannot name someone else.
+	body := map[string]string{"reason": "out_of_stock", "note": "supplier delay", "cancelled_by": "someone@example.com"}
+	req := newRequest(http.MethodPost, "/orders/5/cancel", body)
+	req = req.WithContext(repository.WithActor(req.Context(), repository.Actor{Name: "jwt:ops"}))
+	req = withRouteParam(req, "id", "5")
+	rr := newRecorder()
+
+	h.Cancel(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, model.StatusCancelled, updated.Status)
+	assert.NotNil(t, updated.CancelledAt)
+	assert.Equal(t, model.CancelReasonOutOfStock, updated.CancelReason)
+	assert.Equal(t, "supplier delay", updated.CancelNote)
+	assert.Equal(t, "jwt:ops", updated.CancelledBy)
+}
+
+func TestOrderHandler_Cancel_Completed(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		now := time.Now().UTC()
+		return model.Order{OrderID: id, Status: model.StatusCompleted, CompletedAt: &now}, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"reason": "customer_request"}
+	req := newRequest(http.MethodPost, "/orders/5/cancel", body)
+	req = withRouteParam(req, "id", "5")
+	rr := newRecorder()
+
+	h.Cancel(rr, req)
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestOrderHandler_Cancel_InvalidBody(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	for _, body := range []map[string]string{
+		{"reason": "bored"},
+		{"reason": "other"},
+		{"reason": "customer_request", "note": strings.Repeat("x", 1001)},
+	} {
+		req := newRequest(http.MethodPost, "/orders/5/cancel", body)
+		req = withRouteParam(req, "id", "5")
+		rr := newRecorder()
+
+		h.Cancel(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+func TestOrderHandler_Cancel_NotFound(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.FindByIDFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{}, repository.ErrNotExist
+	}
+
+	h := newHandler(mockRepo)
+
+	body := map[string]string{"reason": "duplicate_order"}
+	req := newRequest(http.MethodPost, "/orders/5/cancel", body)
+	req = withRouteParam(req, "id", "5")
+	rr := newRecorder()
+
+	h.Cancel(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
 //
 // --- DELETE ---
 //
 
 func TestOrderHandler_DeleteByID_Success(t *testing.T) {
 	mockRepo := newMockRepo()
-	mockRepo.DeleteByIDFn = func(ctx context.Context, id int64) error {
+	mockRepo.DeleteByIDFn = func(ctx context.Context, id, version int64) error {
 		return nil
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	req := newRequest(http.MethodDelete, "/orders/5", nil)
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
 
 	h.DeleteByID(rr, req)
@@ -432,16 +1021,69 @@ func TestOrderHandler_DeleteByID_Success(t *testing.T) {
 	assert.Equal(t, http.StatusNoContent, rr.Code)
 }
 
+func TestOrderHandler_DeleteByID_PassesIfMatchVersion(t *testing.T) {
+	mockRepo := newMockRepo()
+
+	var got int64
+	mockRepo.DeleteByIDFn = func(ctx context.Context, id, version int64) error {
+		got = version
+		return nil
+	}
+
+	h := newHandler(mockRepo)
+
+	req := newRequest(http.MethodDelete, "/orders/5", nil)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", `"7"`)
+	rr := newRecorder()
+
+	h.DeleteByID(rr, req)
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, int64(7), got)
+}
+
+func TestOrderHandler_DeleteByID_RequiresIfMatch(t *testing.T) {
+	h := newHandler(newMockRepo())
+
+	req := newRequest(http.MethodDelete, "/orders/5", nil)
+	req = withRouteParam(req, "id", "5")
+	rr := newRecorder()
+
+	h.DeleteByID(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionRequired, rr.Code)
+}
+
+func TestOrderHandler_DeleteByID_VersionConflict(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.DeleteByIDFn = func(ctx context.Context, id, version int64) error {
+		return repository.ErrVersionConflict
+	}
+
+	h := newHandler(mockRepo)
+
+	req := newRequest(http.MethodDelete, "/orders/5", nil)
+	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", `"1"`)
+	rr := newRecorder()
+
+	h.DeleteByID(rr, req)
+
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+}
+
 func TestOrderHandler_DeleteByID_NotFound(t *testing.T) {
 	mockRepo := newMockRepo()
-	mockRepo.DeleteByIDFn = func(ctx context.Context, id int64) error {
+	mockRepo.DeleteByIDFn = func(ctx context.Context, id, version int64) error {
 		return repository.ErrNotExist
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	req := newRequest(http.MethodDelete, "/orders/5", nil)
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
 
 	h.DeleteByID(rr, req)
@@ -451,17 +1093,70 @@ func TestOrderHandler_DeleteByID_NotFound(t *testing.T) {
 
 func TestOrderHandler_DeleteByID_RepoError(t *testing.T) {
 	mockRepo := newMockRepo()
-	mockRepo.DeleteByIDFn = func(ctx context.Context, id int64) error {
+	mockRepo.DeleteByIDFn = func(ctx context.Context, id, version int64) error {
 		return errors.New("db error")
 	}
 
-	h := OrderHandler{Repo: mockRepo}
+	h := newHandler(mockRepo)
 
 	req := newRequest(http.MethodDelete, "/orders/5", nil)
 	req = withRouteParam(req, "id", "5")
+	req.Header.Set("If-Match", "*")
 	rr := newRecorder()
 
 	h.DeleteByID(rr, req)
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code)
 }
+
+//
+// --- RESTORE ---
+//
+
+func TestOrderHandler_Restore_Success(t *testing.T) {
+	mockRepo := newMockRepo()
+	mockRepo.RestoreFn = func(ctx context.Context, id int64) (model.Order, error) {
+		return model.Order{OrderID: id, CustomerID: 2, Status: model.StatusPaid, Version: 4}, nil
+	}
+
+	h := newHandler(mockRepo)
+
+	req := withRouteParam(newRequest(http.MethodPost, "/orders/5/restore", nil), "id", "5")
+	rr := newRecorder()
+
+	h.Restore(rr, req)
+
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"4"`, rr.Header().Get("ETag"))
+
+	var resp model.Order
+	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
+	assert.Equal(t, int64(5), resp.OrderID)
+	assert.NotNil(t, resp.LineItems)
+}
+
+func TestOrderHandler_Restore_Errors(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{repository.ErrNotExist, http.StatusNotFound},
+		{repository.ErrNotDeleted, http.StatusConflict},
+		{errors.New("db error"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		mockRepo := newMockRepo()
+		mockRepo.RestoreFn = func(ctx context.Context, id int64) (model.Order, error) {
+			return model.Order{}, tt.err
+		}
+
+		h := newHandler(mockRepo)
+
+		req := withRouteParam(newRequest(http.MethodPost, "/orders/5/restore", nil), "id", "5")
+		rr := newRecorder()
+
+		h.Restore(rr, req)
+
+		assert.Equal(t, tt.want, rr.Code, tt.err.Error())
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/corradoisidoro/orders-api/internal/stream"
+)
+
+// defaultHeartbeat is used when StreamHandler.Heartbeat is not set.
+const defaultHeartbeat = 15 * time.Second
+
+// StreamHandler serves order events as Server-Sent Events.
+type StreamHandler struct {
+	Broker    *stream.Broker
+	States    *orderstate.Machine
+	Heartbeat time.Duration // interval of keep-alive comments
+}
+
+// Stream sends the order events matching the optional customer_id and
+// status filters until the client goes away or the broker is closed. A
+// client that sends Last-Event-ID first receives the buffered events after
+// it. Customers only receive events of their own orders.
+func (h *StreamHandler) Stream(w http.ResponseWriter, r *http.Request) {
+	customerID, ok := parseQueryInt(w, r, "customer_id", 0)
+	if !ok {
+		return
+	}
+	filter := stream.Filter{
+		CustomerID: customerID,
+		Status:     model.Status(r.URL.Query().Get("status")),
+	}
+	if filter.Status != "" && !h.States.Known(filter.Status) {
+		writeError(w, http.StatusBadRequest, "invalid status")
+		return
+	}
+
+	if scope := repository.ScopeFrom(r.Context()); scope.Restricted() {
+		if scope.CustomerID == 0 || (filter.CustomerID != 0 && filter.CustomerID != scope.CustomerID) {
+			writeError(w, http.StatusForbidden, "cannot stream orders of another customer")
+			return
+		}
+		filter.CustomerID = scope.CustomerID
+	}
+
+	var after int64
+	if v := strings.TrimSpace(r.Header.Get("Last-Event-ID")); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 0 {
+			writeError(w, http.StatusBadRequest, "invalid Last-Event-ID header")
+			return
+		}
+		after = id
+	}
+
+	sub, err := h.Broker.Subscribe(filter, after)
+	if err != nil {
+		if errors.Is(err, stream.ErrClosed) {
+			writeError(w, http.StatusServiceUnavailable, "server is shutting down")
+			return
+		}
+		writeServerError(w, r, err, "failed to subscribe")
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+
+	for _, e := range sub.Replay {
+		if writeEvent(w, e) != nil {
+			return
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	interval := h.Heartbeat
+	if interval <= 0 {
+		interval = defaultHeartbeat
+	}
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+
+		case e, ok := <-sub.Events():
+			if !ok {
+				// Closed by the broker; the client reconnects and resumes.
+				return
+			}
+			if writeEvent(w, e) != nil {
+				return
+			}
+
+		case <-heartbeat.C:
+			if _, err := io.WriteString(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		}
+
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes e in the text/event-stream format.
+func writeEvent(w io.Writer, e stream.Event) error {
+	_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, e.Data)
+	return err
+}
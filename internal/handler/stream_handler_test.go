@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/corradoisidoro/orders-api/internal/stream"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func streamEvent(id, customerID int64, status model.Status) stream.Event {
+	return stream.Event{
+		ID:         id,
+		Type:       model.StatusEvent(status),
+		OrderID:    id,
+		CustomerID: customerID,
+		Status:     status,
+		Data:       []byte(`{}`),
+	}
+}
+
+// streamServer serves h, with requests restricted to scope.
+func streamServer(t *testing.T, h *StreamHandler, scope repository.Scope) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.Stream(w, r.WithContext(repository.WithScope(r.Context(), scope)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// openStream starts a stream request and returns the response and a reader
+// of its body.
+func openStream(t *testing.T, url string, header http.Header) (*http.Response, *bufio.Reader) {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	require.NoError(t, err)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readFrame reads one event or comment, without its trailing blank line.
+func readFrame(t *testing.T, r *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, line)
+	}
+}
+
+func TestStreamHandler_StreamsMatchingEvents(t *testing.T) {
+	broker := stream.NewBroker(10)
+	h := &StreamHandler{Broker: broker, States: orderstate.Default(), Heartbeat: time.Hour}
+	srv := streamServer(t, h, repository.Unrestricted)
+
+	resp, body := openStream(t, srv.URL+"?customer_id=7&status=shipped", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, 5*time.Millisecond)
+	broker.Publish(
+		streamEvent(1, 7, model.StatusPaid),
+		streamEvent(2, 8, model.StatusShipped),
+		streamEvent(3, 7, model.StatusShipped),
+	)
+
+	assert.Equal(t, "id: 3\nevent: order.shipped\ndata: {}", readFrame(t, body))
+}
+
+func TestStreamHandler_ResumesFromLastEventID(t *testing.T) {
+	broker := stream.NewBroker(10)
+	broker.Publish(streamEvent(1, 7, model.StatusPaid), streamEvent(2, 7, model.StatusPaid))
+	h := &StreamHandler{Broker: broker, States: orderstate.Default(), Heartbeat: time.Hour}
+	srv := streamServer(t, h, repository.Unrestricted)
+
+	resp, body := openStream(t, srv.URL, http.Header{"Last-Event-ID": {"1"}})
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "id: 2\nevent: order.paid\ndata: {}", readFrame(t, body))
+
+	require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, 5*time.Millisecond)
+	broker.Publish(streamEvent(3, 7, model.StatusPaid))
+	assert.Equal(t, "id: 3\nevent: order.paid\ndata: {}", readFrame(t, body))
+}
+
+func TestStreamHandler_RestrictsCustomers(t *testing.T) {
+	broker := stream.NewBroker(10)
+	h := &StreamHandler{Broker: broker, States: orderstate.Default(), Heartbeat: time.Hour}
+	srv := streamServer(t, h, repository.Scope{CustomerID: 7})
+
+	resp, _ := openStream(t, srv.URL+"?customer_id=8", nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	resp, body := openStream(t, srv.URL, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, 5*time.Millisecond)
+	broker.Publish(streamEvent(1, 8, model.StatusPaid), streamEvent(2, 7, model.StatusPaid))
+	assert.Equal(t, "id: 2\nevent: order.paid\ndata: {}", readFrame(t, body))
+
+	// A caller that is neither staff nor a customer receives nothing.
+	resp, _ = openStream(t, streamServer(t, h, repository.Scope{}).URL, nil)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+}
+
+func TestStreamHandler_Heartbeat(t *testing.T) {
+	h := &StreamHandler{Broker: stream.NewBroker(10), States: orderstate.Default(), Heartbeat: 10 * time.Millisecond}
+	srv := streamServer(t, h, repository.Unrestricted)
+
+	resp, body := openStream(t, srv.URL, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, ": heartbeat", readFrame(t, body))
+}
+
+func TestStreamHandler_EndsWhenBrokerCloses(t *testing.T) {
+	broker := stream.NewBroker(10)
+	h := &StreamHandler{Broker: broker, States: orderstate.Default(), Heartbeat: time.Hour}
+	srv := streamServer(t, h, repository.Unrestricted)
+
+	resp, body := openStream(t, srv.URL, nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Eventually(t, func() bool { return broker.Subscribers() == 1 }, time.Second, 5*time.Millisecond)
+
+	broker.Close()
+	_, err := body.ReadString('\n')
+	assert.Error(t, err, "the response ends")
+
+	resp, _ = openStream(t, srv.URL, nil)
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestStreamHandler_InvalidRequest(t *testing.T) {
+	h := &StreamHandler{Broker: stream.NewBroker(10), States: orderstate.Default()}
+
+	tests := []struct {
+		name   string
+		target string
+		header string
+	}{
+		{"unknown status", "/orders/stream?status=lost", ""},
+		{"bad customer", "/orders/stream?customer_id=abc", ""},
+		{"bad last event ID", "/orders/stream", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req = req.WithContext(repository.WithScope(req.Context(), repository.Unrestricted))
+			if tt.header != "" {
+				req.Header.Set("Last-Event-ID", tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			h.Stream(rec, req)
+
+			assert.Equal(t, http.StatusBadRequest, rec.Code)
+		})
+	}
+}
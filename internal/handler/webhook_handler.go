@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/corradoisidoro/orders-api/internal/webhook"
+)
+
+type WebhookHandler struct {
+	Repo repository.WebhookRepository
+}
+
+// Create subscribes a URL to the events matching a filter such as
+// ["order.shipped", "order.cancelled"] or ["order.*"]; no filter means every
+// event. Without a secret one is generated. The secret is returned only
+// here.
+func (h *WebhookHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+		Secret string   `json:"secret"`
+	}
+
+	if err := decodeJSON(r, &body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	hook := model.Webhook{
+		URL:    strings.TrimSpace(body.URL),
+		Events: model.EventFilter(body.Events),
+		Secret: body.Secret,
+	}
+	if hook.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			writeServerError(w, r, err, "failed to create webhook")
+			return
+		}
+		hook.Secret = secret
+	}
+
+	if err := h.Repo.Create(r.Context(), &hook); err != nil {
+		if errors.Is(err, repository.ErrInvalidInput) {
+			writeError(w, http.StatusBadRequest, "invalid webhook: url must be an absolute http(s) URL and events must not contain spaces")
+			return
+		}
+		writeServerError(w, r, err, "failed to create webhook")
+		return
+	}
+
+	if hook.Events == nil {
+		hook.Events = model.EventFilter{}
+	}
+
+	writeJSON(w, http.StatusCreated, struct {
+		model.Webhook
+		Secret string `json:"secret"`
+	}{hook, hook.Secret})
+}
+
+func (h *WebhookHandler) List(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.Repo.List(r.Context())
+	if err != nil {
+		writeServerError(w, r, err, "failed to list webhooks")
+		return
+	}
+
+	for i := range hooks {
+		if hooks[i].Events == nil {
+			hooks[i].Events = model.EventFilter{}
+		}
+	}
+	if hooks == nil {
+		hooks = []model.Webhook{}
+	}
+
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+func (h *WebhookHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Repo.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrWebhookNotExist) {
+			writeError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		writeServerError(w, r, err, "failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries returns the latest delivery attempts to a webhook, newest
+// first, up to limit.
+func (h *WebhookHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseID(w, r)
+	if !ok {
+		return
+	}
+
+	limit, ok := parseQueryInt(w, r, "limit", defaultPageSize)
+	if !ok {
+		return
+	}
+	if limit < 1 {
+		writeError(w, http.StatusBadRequest, "limit must be > 0")
+		return
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	if _, err := h.Repo.FindByID(r.Context(), id); err != nil {
+		if errors.Is(err, repository.ErrWebhookNotExist) {
+			writeError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		writeServerError(w, r, err, "failed to find webhook")
+		return
+	}
+
+	deliveries, err := h.Repo.ListDeliveries(r.Context(), id, int(limit))
+	if err != nil {
+		writeServerError(w, r, err, "failed to list deliveries")
+		return
+	}
+	if deliveries == nil {
+		deliveries = []model.WebhookDelivery{}
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
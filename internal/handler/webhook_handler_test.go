@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockWebhookRepo keeps webhooks in memory.
+type mockWebhookRepo struct {
+	hooks      []model.Webhook
+	deliveries []model.WebhookDelivery
+}
+
+func (m *mockWebhookRepo) Create(ctx context.Context, hook *model.Webhook) error {
+	if !strings.HasPrefix(hook.URL, "https://") {
+		return fmt.Errorf("bad URL: %w", repository.ErrInvalidInput)
+	}
+	hook.ID = int64(len(m.hooks) + 1)
+	m.hooks = append(m.hooks, *hook)
+	return nil
+}
+
+func (m *mockWebhookRepo) List(ctx context.Context) ([]model.Webhook, error) {
+	return m.hooks, nil
+}
+
+func (m *mockWebhookRepo) FindByID(ctx context.Context, id int64) (model.Webhook, error) {
+	for _, h := range m.hooks {
+		if h.ID == id {
+			return h, nil
+		}
+	}
+	return model.Webhook{}, repository.ErrWebhookNotExist
+}
+
+func (m *mockWebhookRepo) Delete(ctx context.Context, id int64) error {
+	for i, h := range m.hooks {
+		if h.ID == id {
+			m.hooks = append(m.hooks[:i], m.hooks[i+1:]...)
+			return nil
+		}
+	}
+	return repository.ErrWebhookNotExist
+}
+
+func (m *mockWebhookRepo) ListDeliveries(ctx context.Context, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	return m.deliveries, nil
+}
+
+func TestWebhookHandler_Create(t *testing.T) {
+	repo := &mockWebhookRepo{}
+	h := &WebhookHandler{Repo: repo}
+
+	rr := newRecorder()
+	h.Create(rr, newRequest(http.MethodPost, "/webhooks", map[string]any{
+		"url":    "https://partner.example/hooks",
+		"events": []string{"order.shipped"},
+	}))
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	var resp map[string]any
+	decodeResponseJSON(t, rr.Body.Bytes(), &resp)
+	assert.Equal(t, "https://partner.example/hooks", resp["url"])
+	assert.Equal(t, []any{"order.shipped"}, resp["events"])
+	assert.True(t, strings.HasPrefix(resp["secret"].(string), "whsec_"), "a secret is generated")
+	assert.Equal(t, resp["secret"], repo.hooks[0].Secret)
+
+	// The secret is not shown again.
+	rr = newRecorder()
+	h.List(rr, newRequest(http.MethodGet, "/webhooks", nil))
+	require.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "whsec_")
+	assert.Contains(t, rr.Body.String(), "partner.example")
+}
+
+func TestWebhookHandler_Create_KeepsGivenSecret(t *testing.T) {
+	repo := &mockWebhookRepo{}
+	h := &WebhookHandler{Repo: repo}
+
+	rr := newRecorder()
+	h.Create(rr, newRequest(http.MethodPost, "/webhooks", map[string]any{
+		"url":    "https://partner.example/hooks",
+		"secret": "shared",
+	}))
+
+	require.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "shared", repo.hooks[0].Secret)
+	assert.Contains(t, rr.Body.String(), `"events":[]`)
+}
+
+func TestWebhookHandler_Create_Invalid(t *testing.T) {
+	h := &WebhookHandler{Repo: &mockWebhookRepo{}}
+
+	rr := newRecorder()
+	h.Create(rr, newRequest(http.MethodPost, "/webhooks", map[string]any{"url": "ftp://x"}))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	rr = newRecorder()
+	h.Create(rr, newRequest(http.MethodPost, "/webhooks", "{"))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestWebhookHandler_Delete(t *testing.T) {
+	repo := &mockWebhookRepo{hooks: []model.Webhook{{ID: 1, URL: "https://a.example"}}}
+	h := &WebhookHandler{Repo: repo}
+
+	rr := newRecorder()
+	h.Delete(rr, withRouteParam(newRequest(http.MethodDelete, "/webhooks/1", nil), "id", "1"))
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Empty(t, repo.hooks)
+
+	rr = newRecorder()
+	h.Delete(rr, withRouteParam(newRequest(http.MethodDelete, "/webhooks/1", nil), "id", "1"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestWebhookHandler_ListDeliveries(t *testing.T) {
+	repo := &mockWebhookRepo{
+		hooks:      []model.Webhook{{ID: 1, URL: "https://a.example"}},
+		deliveries: []model.WebhookDelivery{{ID: 9, WebhookID: 1, EventID: 3, StatusCode: 503, Error: "unexpected status 503"}},
+	}
+	h := &WebhookHandler{Repo: repo}
+
+	rr := newRecorder()
+	h.ListDeliveries(rr, withRouteParam(newRequest(http.MethodGet, "/webhooks/1/deliveries", nil), "id", "1"))
+	require.Equal(t, http.StatusOK, rr.Code)
+	var deliveries []model.WebhookDelivery
+	decodeResponseJSON(t, rr.Body.Bytes(), &deliveries)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, 503, deliveries[0].StatusCode)
+
+	rr = newRecorder()
+	h.ListDeliveries(rr, withRouteParam(newRequest(http.MethodGet, "/webhooks/2/deliveries", nil), "id", "2"))
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
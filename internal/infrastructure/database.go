@@ -7,23 +7,38 @@ import (
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
 
 	"github.com/corradoisidoro/orders-api/internal/application"
+	"github.com/corradoisidoro/orders-api/internal/logging"
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/tracing"
 )
 
+// slowQueryThreshold is the duration above which queries are logged as slow.
+const slowQueryThreshold = 200 * time.Millisecond
+
 func ConnectDatabase(cfg application.Config) (*gorm.DB, error) {
 	if strings.TrimSpace(cfg.DatabaseDSN) == "" {
 		return nil, fmt.Errorf("database: missing DSN")
 	}
 
 	db, err := gorm.Open(postgres.Open(cfg.DatabaseDSN), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Warn),
+		Logger: logging.NewGormLogger(slowQueryThreshold),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("database: connect failed: %w", err)
 	}
 
+	// Record query durations in the /metrics endpoint
+	if err := db.Use(&metrics.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("database: metrics plugin failed: %w", err)
+	}
+
+	// Trace every query as a child of the request's span
+	if err := db.Use(&tracing.GormPlugin{}); err != nil {
+		return nil, fmt.Errorf("database: tracing plugin failed: %w", err)
+	}
+
 	// Configure connection pool
 	sqlDB, err := db.DB()
 	if err != nil {
@@ -36,6 +51,8 @@ func ConnectDatabase(cfg application.Config) (*gorm.DB, error) {
 	sqlDB.SetConnMaxLifetime(30 * time.Minute)
 	sqlDB.SetConnMaxIdleTime(10 * time.Minute)
 
+	metrics.ObserveDB(sqlDB)
+
 	// Ping to ensure DB is reachable
 	if err := sqlDB.Ping(); err != nil {
 		return nil, fmt.Errorf("database: ping failed: %w", err)
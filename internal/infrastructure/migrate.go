@@ -1,22 +1,350 @@
 package infrastructure
 
 import (
+	"context"
+	"embed"
 	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+	"time"
 
-	"github.com/corradoisidoro/orders-api/internal/model"
 	"gorm.io/gorm"
 )
 
-// Migrate runs all database schema migrations for the Order domain.
+// MigrationsDir is where `migrate create` writes new SQL migrations, relative
+// to the repository root. Its files are embedded into the binary.
+const MigrationsDir = "internal/infrastructure/migrations"
+
+//go:embed migrations/*.sql
+var sqlMigrationFiles embed.FS
+
+// goMigrations are the migrations written in Go, for changes that SQL alone
+// cannot express portably.
+var goMigrations = []Migration{
+	{Version: 1, Name: "baseline", Up: baselineUp, Down: baselineDown},
+	{Version: 5, Name: "create_outbox", Up: outboxUp, Down: outboxDown},
+	{Version: 6, Name: "create_webhooks", Up: webhooksUp, Down: webhooksDown},
+	{Version: 7, Name: "create_order_history", Up: orderHistoryUp, Down: orderHistoryDown},
+	{Version: 8, Name: "add_orders_deleted_at", Up: softDeleteUp, Down: softDeleteDown},
+	{Version: 9, Name: "add_idempotency_keys_etag", Up: idempotencyETagUp, Down: idempotencyETagDown},
+	{Version: 10, Name: "backfill_orders_paid_at", Up: paidAtBackfillUp, Down: paidAtBackfillDown},
+}
+
+// Migrations returns every migration of the service: those in goMigrations
+// and the SQL files in MigrationsDir.
+func Migrations() ([]Migration, error) {
+	fsys, err := fs.Sub(sqlMigrationFiles, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: %w", err)
+	}
+
+	sqlMigrations, err := LoadSQLMigrations(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Concat(goMigrations, sqlMigrations), nil
+}
+
+// NewServiceMigrator returns a Migrator for the service's Migrations.
+func NewServiceMigrator(db *gorm.DB) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	return NewMigrator(db, migrations)
+}
+
+// Migrate applies all pending database migrations.
 // Call this from main.go or a dedicated CLI command.
 func Migrate(db *gorm.DB) error {
-	if db == nil {
-		return fmt.Errorf("migrate: db is nil")
+	m, err := NewServiceMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	_, err = m.Up(context.Background())
+	return err
+}
+
+// CheckMigrations returns a readiness check that fails while any of the
+// service's migrations is pending, so that instances running a newer schema
+// than the database get no traffic.
+func CheckMigrations(db *gorm.DB) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		m, err := NewServiceMigrator(db)
+		if err != nil {
+			return err
+		}
+
+		pending, err := m.Pending(ctx)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			names := make([]string, len(pending))
+			for i, mig := range pending {
+				names[i] = mig.String()
+			}
+			return fmt.Errorf("%d pending migrations: %s", len(pending), strings.Join(names, ", "))
+		}
+		return nil
+	}
+}
+
+// The baseline tables, frozen as they were when versioned migrations were
+// introduced. Later changes belong in new migrations, not here.
+type (
+	baselineOrder struct {
+		OrderID    int64              `gorm:"primarykey;column:order_id;index:idx_orders_created_at_order_id,priority:2"`
+		CustomerID int64              `gorm:"index"`
+		Status     string             `gorm:"type:varchar(32);not null;default:pending;index"`
+		Currency   string             `gorm:"type:char(3)"`
+		Version    int64              `gorm:"not null;default:1"`
+		LineItems  []baselineLineItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE"`
+
+		Subtotal      uint64 `gorm:"not null;default:0"`
+		DiscountTotal uint64 `gorm:"not null;default:0"`
+		TaxTotal      uint64 `gorm:"not null;default:0"`
+		GrandTotal    uint64 `gorm:"not null;default:0;index"`
+
+		CreatedAt   *time.Time `gorm:"index:idx_orders_created_at_order_id,priority:1"`
+		PaidAt      *time.Time
+		ShippedAt   *time.Time
+		CompletedAt *time.Time
+		CancelledAt *time.Time
+		RefundedAt  *time.Time
+
+		CancelledBy  string
+		CancelReason string `gorm:"type:varchar(32)"`
+		CancelNote   string
+	}
+
+	baselineLineItem struct {
+		ItemID      int64  `gorm:"primaryKey;autoIncrement"`
+		OrderID     int64  `gorm:"column:order_id"`
+		SKU         string `gorm:"column:sku;type:varchar(64);index"`
+		ProductName string `gorm:"type:varchar(255)"`
+		Currency    string `gorm:"type:char(3)"`
+		Quantity    uint
+		Price       uint
+		Discount    uint `gorm:"not null;default:0"`
+		TaxRateBps  uint `gorm:"not null;default:0"`
+	}
+
+	baselineIdempotencyKey struct {
+		Key         string `gorm:"primaryKey;column:idempotency_key;type:varchar(255)"`
+		Method      string `gorm:"type:varchar(16);not null"`
+		Path        string `gorm:"not null"`
+		RequestHash string `gorm:"type:char(64);not null"`
+		StatusCode  int    `gorm:"not null;default:0"`
+		ContentType string `gorm:"type:varchar(255)"`
+		Body        []byte
+		CreatedAt   time.Time `gorm:"not null"`
+		ExpiresAt   time.Time `gorm:"not null;index"`
+	}
+)
+
+func (baselineOrder) TableName() string          { return "orders" }
+func (baselineLineItem) TableName() string       { return "line_items" }
+func (baselineIdempotencyKey) TableName() string { return "idempotency_keys" }
+
+// baselineUp creates the baseline tables. Databases set up before versioned
+// migrations already have them, so it only adds what is missing and then
+// backfills columns those databases may have left empty.
+func baselineUp(tx *gorm.DB) error {
+	if err := tx.AutoMigrate(&baselineOrder{}, &baselineLineItem{}, &baselineIdempotencyKey{}); err != nil {
+		return fmt.Errorf("auto-migrate failed: %w", err)
+	}
+
+	if err := backfillOrderStatus(tx); err != nil {
+		return fmt.Errorf("backfill status failed: %w", err)
+	}
+
+	if err := backfillOrderTotals(tx); err != nil {
+		return fmt.Errorf("backfill totals failed: %w", err)
+	}
+
+	return nil
+}
+
+func baselineDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&baselineIdempotencyKey{}, &baselineLineItem{}, &baselineOrder{})
+}
+
+// backfillOrderStatus derives the status column for orders written before it
+// existed, when status was implied by shipped_at and completed_at.
+func backfillOrderStatus(db *gorm.DB) error {
+	if err := db.Model(&baselineOrder{}).
+		Where("status = ? AND completed_at IS NOT NULL", "pending").
+		Update("status", "completed").Error; err != nil {
+		return err
+	}
+
+	return db.Model(&baselineOrder{}).
+		Where("status = ? AND shipped_at IS NOT NULL", "pending").
+		Update("status", "shipped").Error
+}
+
+// backfillOrderTotals computes totals for orders written before they were
+// stored. Such line items carry no discount or tax, so every total but tax
+// equals the sum of quantity * price.
+func backfillOrderTotals(db *gorm.DB) error {
+	const itemsTotal = "(SELECT COALESCE(SUM(line_items.quantity * line_items.price), 0) " +
+		"FROM line_items WHERE line_items.order_id = orders.order_id)"
+
+	return db.Model(&baselineOrder{}).
+		Where("subtotal = 0 AND EXISTS (SELECT 1 FROM line_items WHERE line_items.order_id = orders.order_id)").
+		Updates(map[string]any{
+			"subtotal":    gorm.Expr(itemsTotal),
+			"grand_total": gorm.Expr(itemsTotal),
+		}).Error
+}
+
+// outboxEvent is the outbox table as created by migration 5. Its id is an
+// auto-incrementing key, which SQL cannot declare portably.
+type outboxEvent struct {
+	ID         int64     `gorm:"primaryKey"`
+	Type       string    `gorm:"type:varchar(64);not null"`
+	OrderID    int64     `gorm:"not null;index"`
+	CustomerID int64     `gorm:"not null"`
+	Payload    []byte    `gorm:"type:jsonb;not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+
+	Attempts       int       `gorm:"not null;default:0"`
+	NextAttemptAt  time.Time `gorm:"not null;index:idx_outbox_pending,where:delivered_at IS NULL AND dead_lettered_at IS NULL"`
+	LastError      string
+	DeliveredAt    *time.Time
+	DeadLetteredAt *time.Time
+}
+
+func (outboxEvent) TableName() string { return "outbox" }
+
+func outboxUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(&outboxEvent{})
+}
+
+func outboxDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&outboxEvent{})
+}
+
+// The webhook tables as created by migration 6.
+type (
+	webhook struct {
+		ID                  int64     `gorm:"primaryKey"`
+		URL                 string    `gorm:"type:varchar(2048);not null"`
+		Events              string    `gorm:"type:varchar(1024);not null"`
+		Secret              string    `gorm:"type:varchar(255);not null"`
+		CreatedAt           time.Time `gorm:"not null"`
+		ConsecutiveFailures int       `gorm:"not null;default:0"`
+		DisabledAt          *time.Time
 	}
 
-	if err := db.AutoMigrate(&model.Order{}, &model.LineItem{}); err != nil {
-		return fmt.Errorf("migrate: auto-migrate failed: %w", err)
+	webhookDelivery struct {
+		ID         int64  `gorm:"primaryKey"`
+		WebhookID  int64  `gorm:"not null;index:idx_webhook_deliveries_event"`
+		EventID    int64  `gorm:"not null;index:idx_webhook_deliveries_event"`
+		EventType  string `gorm:"type:varchar(64);not null"`
+		StatusCode int    `gorm:"not null;default:0"`
+		Error      string
+		Success    bool      `gorm:"not null"`
+		DurationMs int64     `gorm:"not null"`
+		CreatedAt  time.Time `gorm:"not null"`
 	}
+)
+
+func (webhook) TableName() string         { return "webhooks" }
+func (webhookDelivery) TableName() string { return "webhook_deliveries" }
 
+func webhooksUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(&webhook{}, &webhookDelivery{})
+}
+
+func webhooksDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&webhookDelivery{}, &webhook{})
+}
+
+// orderHistory is the order_history table as created by migration 7.
+type orderHistory struct {
+	ID         int64     `gorm:"primaryKey;index:idx_order_history_order_id_id,priority:2"`
+	OrderID    int64     `gorm:"not null;index:idx_order_history_order_id_id,priority:1"`
+	CustomerID int64     `gorm:"not null"`
+	Operation  string    `gorm:"type:varchar(32);not null"`
+	Actor      string    `gorm:"type:varchar(255);not null"`
+	RequestID  string    `gorm:"type:varchar(255);not null"`
+	Changes    []byte    `gorm:"type:jsonb;not null"`
+	CreatedAt  time.Time `gorm:"not null"`
+}
+
+func (orderHistory) TableName() string { return "order_history" }
+
+func orderHistoryUp(tx *gorm.DB) error {
+	return tx.AutoMigrate(&orderHistory{})
+}
+
+func orderHistoryDown(tx *gorm.DB) error {
+	return tx.Migrator().DropTable(&orderHistory{})
+}
+
+// softDeletedOrder is the column of orders added by migration 8. Databases
+// created by AutoMigrate may have it already.
+type softDeletedOrder struct {
+	DeletedAt *time.Time `gorm:"index"`
+}
+
+func (softDeletedOrder) TableName() string { return "orders" }
+
+func softDeleteUp(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if !m.HasColumn(&softDeletedOrder{}, "DeletedAt") {
+		if err := m.AddColumn(&softDeletedOrder{}, "DeletedAt"); err != nil {
+			return err
+		}
+	}
+	if !m.HasIndex(&softDeletedOrder{}, "DeletedAt") {
+		return m.CreateIndex(&softDeletedOrder{}, "DeletedAt")
+	}
 	return nil
 }
+
+func softDeleteDown(tx *gorm.DB) error {
+	m := tx.Migrator()
+	if err := m.DropIndex(&softDeletedOrder{}, "DeletedAt"); err != nil {
+		return err
+	}
+	return m.DropColumn(&softDeletedOrder{}, "DeletedAt")
+}
+
+// idempotencyKeyETag is the column of idempotency_keys added by migration 9.
+// Databases created by AutoMigrate may have it already.
+type idempotencyKeyETag struct {
+	ETag string `gorm:"column:etag;type:varchar(255)"`
+}
+
+func (idempotencyKeyETag) TableName() string { return "idempotency_keys" }
+
+func idempotencyETagUp(tx *gorm.DB) error {
+	if tx.Migrator().HasColumn(&idempotencyKeyETag{}, "ETag") {
+		return nil
+	}
+	return tx.Migrator().AddColumn(&idempotencyKeyETag{}, "ETag")
+}
+
+func idempotencyETagDown(tx *gorm.DB) error {
+	return tx.Migrator().DropColumn(&idempotencyKeyETag{}, "ETag")
+}
+
+// paidAtBackfillUp sets paid_at on shipped and completed orders that lack it:
+// orders whose status the baseline derived, which were paid before they
+// shipped. It takes shipped_at, falling back to completed_at. Without paid_at
+// the lifecycle would never let them be refunded.
+func paidAtBackfillUp(tx *gorm.DB) error {
+	return tx.Model(&baselineOrder{}).
+		Where("paid_at IS NULL AND status IN ?", []string{"shipped", "completed"}).
+		Update("paid_at", gorm.Expr("COALESCE(shipped_at, completed_at)")).Error
+}
+
+// paidAtBackfillDown leaves paid_at as it is: the backfilled values cannot be
+// told apart from recorded ones, and keeping them is harmless.
+func paidAtBackfillDown(*gorm.DB) error { return nil }
@@ -1,11 +1,15 @@
 package infrastructure_test
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/corradoisidoro/orders-api/internal/infrastructure"
 	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
@@ -28,7 +32,7 @@ func TestMigrate_AutoMigrateFails(t *testing.T) {
 	err = infrastructure.Migrate(db)
 
 	assert.Error(t, err)
-	assert.Contains(t, err.Error(), "migrate: auto-migrate failed")
+	assert.Contains(t, err.Error(), "migrate: acquire connection")
 }
 
 func TestMigrate_Success(t *testing.T) {
@@ -40,4 +44,107 @@ func TestMigrate_Success(t *testing.T) {
 
 	assert.True(t, db.Migrator().HasTable(&model.Order{}))
 	assert.True(t, db.Migrator().HasTable(&model.LineItem{}))
+	assert.True(t, db.Migrator().HasTable(&model.IdempotencyKey{}))
+	assert.True(t, db.Migrator().HasTable(&model.OrderHistory{}))
+	assert.True(t, db.Migrator().HasColumn(&model.Order{}, "DeletedAt"))
+	assert.True(t, db.Migrator().HasColumn(&model.IdempotencyKey{}, "ETag"))
+	assert.True(t, db.Migrator().HasTable("schema_migrations"))
+	assert.True(t, db.Migrator().HasIndex(&model.LineItem{}, "idx_line_items_order_id"))
+
+	// Running again is a no-op.
+	assert.NoError(t, infrastructure.Migrate(db))
+}
+
+func TestCheckMigrations(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	check := infrastructure.CheckMigrations(db)
+
+	err = check(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pending migrations: 0001_baseline")
+
+	require.NoError(t, infrastructure.Migrate(db))
+	assert.NoError(t, check(context.Background()))
+}
+
+// legacyDB returns a database laid out by the AutoMigrate-only Migrate that
+// predates versioned migrations, without a schema_migrations table.
+func legacyDB(t *testing.T) *gorm.DB {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&model.Order{}, &model.LineItem{}, &model.IdempotencyKey{}))
+	return db
+}
+
+func TestMigrate_BackfillsStatus(t *testing.T) {
+	db := legacyDB(t)
+
+	now := time.Now().UTC()
+	shipped := model.Order{CustomerID: 1, ShippedAt: &now}
+	completed := model.Order{CustomerID: 1, ShippedAt: &now, CompletedAt: &now}
+	assert.NoError(t, db.Create(&shipped).Error)
+	assert.NoError(t, db.Create(&completed).Error)
+
+	assert.NoError(t, infrastructure.Migrate(db))
+
+	var gotShipped, gotCompleted model.Order
+	assert.NoError(t, db.First(&gotShipped, shipped.OrderID).Error)
+	assert.Equal(t, model.StatusShipped, gotShipped.Status)
+	assert.NoError(t, db.First(&gotCompleted, completed.OrderID).Error)
+	assert.Equal(t, model.StatusCompleted, gotCompleted.Status)
+}
+
+func TestMigrate_BackfillsPaidAt(t *testing.T) {
+	db := legacyDB(t)
+
+	// Bring the database up to the migration before the backfill, as one
+	// deployed before it would be.
+	all, err := infrastructure.Migrations()
+	require.NoError(t, err)
+	var before []infrastructure.Migration
+	for _, mig := range all {
+		if mig.Version < 10 {
+			before = append(before, mig)
+		}
+	}
+	m, err := infrastructure.NewMigrator(db, before)
+	require.NoError(t, err)
+	_, err = m.Up(context.Background())
+	require.NoError(t, err)
+
+	shippedAt := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	completedAt := shippedAt.Add(72 * time.Hour)
+	completed := model.Order{CustomerID: 1, Status: model.StatusCompleted, ShippedAt: &shippedAt, CompletedAt: &completedAt}
+	pending := model.Order{CustomerID: 1, Status: model.StatusPending}
+	require.NoError(t, db.Create(&completed).Error)
+	require.NoError(t, db.Create(&pending).Error)
+
+	require.NoError(t, infrastructure.Migrate(db))
+
+	var got model.Order
+	require.NoError(t, db.First(&got, completed.OrderID).Error)
+	require.NotNil(t, got.PaidAt)
+	assert.True(t, got.PaidAt.Equal(shippedAt))
+	assert.NoError(t, orderstate.Default().Apply(&got, model.StatusRefunded, time.Now()))
+
+	var gotPending model.Order
+	require.NoError(t, db.First(&gotPending, pending.OrderID).Error)
+	assert.Nil(t, gotPending.PaidAt)
+}
+
+func TestMigrate_BackfillsTotals(t *testing.T) {
+	db := legacyDB(t)
+
+	legacy := model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 3, Price: 250}}}
+	assert.NoError(t, db.Create(&legacy).Error)
+
+	assert.NoError(t, infrastructure.Migrate(db))
+
+	var got model.Order
+	assert.NoError(t, db.First(&got, legacy.OrderID).Error)
+	assert.Equal(t, uint64(750), got.Subtotal)
+	assert.Equal(t, uint64(750), got.GrandTotal)
 }
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_line_items_order_id;
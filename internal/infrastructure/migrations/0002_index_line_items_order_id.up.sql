@@ -0,0 +1,2 @@
+-- Line items are always loaded by order; index the foreign key.
+CREATE INDEX IF NOT EXISTS idx_line_items_order_id ON line_items (order_id);
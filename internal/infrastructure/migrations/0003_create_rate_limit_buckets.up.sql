@@ -0,0 +1,6 @@
+-- Token buckets shared by every replica (RATE_LIMIT_BACKEND=postgres).
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    tokens     DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
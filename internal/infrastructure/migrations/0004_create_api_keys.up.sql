@@ -0,0 +1,9 @@
+-- API keys; only the SHA-256 hash of each secret is stored.
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_id      VARCHAR(32) PRIMARY KEY,
+    name        VARCHAR(255) NOT NULL,
+    secret_hash CHAR(64) NOT NULL,
+    scopes      VARCHAR(255) NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    revoked_at  TIMESTAMPTZ
+);
@@ -0,0 +1,393 @@
+package infrastructure
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrationLockKey identifies the Postgres advisory lock held while
+// migrations run, so that concurrent runners apply them one at a time.
+const migrationLockKey int64 = 7_202_510_010
+
+// Migration is one versioned schema change. Up applies it and Down reverts
+// it. Each runs in a transaction together with its schema_migrations row, so
+// a failed migration leaves nothing behind.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error // nil if the migration cannot be reverted
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// MigrationStatus reports whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time // nil while pending
+}
+
+// schemaMigration is a row of schema_migrations, one per applied migration.
+type schemaMigration struct {
+	Version   int64     `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"type:varchar(255);not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// Migrator applies and reverts versioned migrations, recording them in the
+// schema_migrations table.
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []Migration // sorted by Version
+}
+
+// NewMigrator returns a Migrator for the given migrations. Versions must be
+// positive and unique.
+func NewMigrator(db *gorm.DB, migrations []Migration) (*Migrator, error) {
+	if db == nil {
+		return nil, fmt.Errorf("migrate: db is nil")
+	}
+
+	sorted := slices.Clone(migrations)
+	slices.SortFunc(sorted, func(a, b Migration) int {
+		return cmp.Compare(a.Version, b.Version)
+	})
+
+	for i, m := range sorted {
+		if m.Version < 1 {
+			return nil, fmt.Errorf("migrate: %s: version must be > 0", m)
+		}
+		if m.Up == nil {
+			return nil, fmt.Errorf("migrate: %s: missing up migration", m)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrate: %s and %s share version %d", sorted[i-1], m, m.Version)
+		}
+	}
+
+	return &Migrator{DB: db, Migrations: sorted}, nil
+}
+
+// Up applies all pending migrations in version order and returns them.
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.Migrations {
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+
+			if err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := mig.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&schemaMigration{
+					Version:   mig.Version,
+					Name:      mig.Name,
+					AppliedAt: time.Now().UTC(),
+				}).Error
+			}); err != nil {
+				return fmt.Errorf("migrate: up %s: %w", mig, err)
+			}
+
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Down reverts the n most recently applied migrations, newest first, and
+// returns them.
+func (m *Migrator) Down(ctx context.Context, n int) ([]Migration, error) {
+	if n < 1 {
+		return nil, fmt.Errorf("migrate: down: step count must be > 0, got %d", n)
+	}
+
+	byVersion := make(map[int64]Migration, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		byVersion[mig.Version] = mig
+	}
+
+	var done []Migration
+
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		versions := make([]int64, 0, len(applied))
+		for v := range applied {
+			versions = append(versions, v)
+		}
+		slices.SortFunc(versions, func(a, b int64) int { return cmp.Compare(b, a) })
+		if n < len(versions) {
+			versions = versions[:n]
+		}
+
+		for _, v := range versions {
+			mig, ok := byVersion[v]
+			if !ok {
+				return fmt.Errorf("migrate: down: applied migration %04d_%s is unknown to this build", v, applied[v].Name)
+			}
+			if mig.Down == nil {
+				return fmt.Errorf("migrate: down %s: migration is irreversible", mig)
+			}
+
+			if err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := mig.Down(tx); err != nil {
+					return err
+				}
+				return tx.Delete(&schemaMigration{}, v).Error
+			}); err != nil {
+				return fmt.Errorf("migrate: down %s: %w", mig, err)
+			}
+
+			done = append(done, mig)
+		}
+
+		return nil
+	})
+
+	return done, err
+}
+
+// Status lists every known migration and when it was applied.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+
+	err := m.locked(ctx, func(conn *gorm.DB) error {
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.Migrations {
+			s := MigrationStatus{Migration: mig}
+			if row, ok := applied[mig.Version]; ok {
+				at := row.AppliedAt
+				s.AppliedAt = &at
+			}
+			statuses = append(statuses, s)
+		}
+
+		return nil
+	})
+
+	return statuses, err
+}
+
+// Pending lists the migrations that have not been applied. Unlike Status it
+// takes no lock and creates nothing, so it is cheap enough for health
+// checks.
+func (m *Migrator) Pending(ctx context.Context) ([]Migration, error) {
+	db := m.DB.WithContext(ctx)
+	if !db.Migrator().HasTable(&schemaMigration{}) {
+		return slices.Clone(m.Migrations), nil
+	}
+
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; !ok {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+// locked runs fn on a single connection. On Postgres that connection holds
+// an advisory lock for the duration, so concurrent runners wait for each
+// other. schema_migrations is created on first use.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *gorm.DB) error) error {
+	sqlDB, err := m.DB.DB()
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	sqlConn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("migrate: acquire connection: %w", err)
+	}
+	defer sqlConn.Close()
+
+	conn := m.DB.Session(&gorm.Session{NewDB: true, Context: ctx})
+	conn.Statement.ConnPool = sqlConn
+
+	if conn.Dialector.Name() == "postgres" {
+		if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockKey).Error; err != nil {
+			return fmt.Errorf("migrate: acquire lock: %w", err)
+		}
+		defer conn.WithContext(context.WithoutCancel(ctx)).
+			Exec("SELECT pg_advisory_unlock(?)", migrationLockKey)
+	}
+
+	if err := conn.AutoMigrate(&schemaMigration{}); err != nil {
+		return fmt.Errorf("migrate: create schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// appliedMigrations returns the rows of schema_migrations by version.
+func appliedMigrations(db *gorm.DB) (map[int64]schemaMigration, error) {
+	var rows []schemaMigration
+	if err := db.Find(&rows).Error; err != nil {
+		return nil, fmt.Errorf("migrate: read schema_migrations: %w", err)
+	}
+
+	applied := make(map[int64]schemaMigration, len(rows))
+	for _, row := range rows {
+		applied[row.Version] = row
+	}
+	return applied, nil
+}
+
+// sqlMigrationFile matches migration file names such as
+// 0002_add_index.up.sql and 0002_add_index.down.sql.
+var sqlMigrationFile = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// nonSlugChars matches the runs of characters CreateMigration replaces with
+// an underscore in migration names.
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// LoadSQLMigrations reads migrations from the .sql files at the root of fsys.
+// Every version needs an up file; the down file is optional.
+func LoadSQLMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read migrations: %w", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	var order []int64
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+
+		match := sqlMigrationFile.FindStringSubmatch(e.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migrate: invalid migration file name %q", e.Name())
+		}
+
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: invalid migration version in %q: %w", e.Name(), err)
+		}
+
+		body, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("migrate: read %s: %w", e.Name(), err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = mig
+			order = append(order, version)
+		}
+		if mig.Name != match[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by %s and %s", version, mig.Name, match[2])
+		}
+
+		if match[3] == "up" {
+			mig.Up = execSQL(string(body))
+		} else {
+			mig.Down = execSQL(string(body))
+		}
+	}
+
+	migrations := make([]Migration, 0, len(order))
+	for _, v := range order {
+		mig := *byVersion[v]
+		if mig.Up == nil {
+			return nil, fmt.Errorf("migrate: %s: missing up file", mig)
+		}
+		migrations = append(migrations, mig)
+	}
+
+	return migrations, nil
+}
+
+// execSQL returns a migration step that executes sql, which may hold several
+// statements.
+func execSQL(sql string) func(tx *gorm.DB) error {
+	return func(tx *gorm.DB) error {
+		if strings.TrimSpace(sql) == "" {
+			return nil
+		}
+		return tx.Exec(sql).Error
+	}
+}
+
+// CreateMigration writes empty up and down SQL files for a new migration
+// named name into dir. Its version follows the highest one among existing
+// and the files already in dir. It returns the paths of both files.
+func CreateMigration(dir, name string, existing []Migration) (string, string, error) {
+	slug := strings.Trim(nonSlugChars.ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if slug == "" {
+		return "", "", fmt.Errorf("migrate: create: invalid name %q", name)
+	}
+
+	onDisk, err := LoadSQLMigrations(os.DirFS(dir))
+	if err != nil {
+		return "", "", err
+	}
+
+	var latest int64
+	for _, m := range slices.Concat(existing, onDisk) {
+		latest = max(latest, m.Version)
+	}
+
+	base := fmt.Sprintf("%04d_%s", latest+1, slug)
+	up := filepath.Join(dir, base+".up.sql")
+	down := filepath.Join(dir, base+".down.sql")
+
+	for _, f := range []struct{ path, direction string }{{up, "up"}, {down, "down"}} {
+		file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err != nil {
+			return "", "", fmt.Errorf("migrate: create: %w", err)
+		}
+		_, err = fmt.Fprintf(file, "-- %s (%s)\n", base, f.direction)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", "", fmt.Errorf("migrate: create: %w", err)
+		}
+	}
+
+	return up, down, nil
+}
@@ -0,0 +1,170 @@
+package infrastructure_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/corradoisidoro/orders-api/internal/infrastructure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newTestMigrator(t *testing.T, migrations []infrastructure.Migration) *infrastructure.Migrator {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	m, err := infrastructure.NewMigrator(db, migrations)
+	require.NoError(t, err)
+	return m
+}
+
+func testMigrations(t *testing.T) []infrastructure.Migration {
+	t.Helper()
+
+	migrations, err := infrastructure.LoadSQLMigrations(fstest.MapFS{
+		"0001_create_widgets.up.sql":   {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY);")},
+		"0001_create_widgets.down.sql": {Data: []byte("DROP TABLE widgets;")},
+		"0002_add_name.up.sql": {Data: []byte(
+			"ALTER TABLE widgets ADD COLUMN name TEXT;\nCREATE INDEX idx_widgets_name ON widgets (name);")},
+		"0002_add_name.down.sql": {Data: []byte("DROP INDEX idx_widgets_name;\nALTER TABLE widgets DROP COLUMN name;")},
+		"README.md":              {Data: []byte("not a migration")},
+	})
+	require.NoError(t, err)
+	return migrations
+}
+
+func TestMigrator_UpDownStatus(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, testMigrations(t))
+
+	pending, err := m.Pending(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2, "no schema_migrations table yet")
+
+	applied, err := m.Up(ctx)
+	require.NoError(t, err)
+	require.Len(t, applied, 2)
+	assert.Equal(t, "0001_create_widgets", applied[0].String())
+	assert.True(t, m.DB.Migrator().HasColumn("widgets", "name"))
+
+	applied, err = m.Up(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	reverted, err := m.Down(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, reverted, 1)
+	assert.Equal(t, int64(2), reverted[0].Version)
+	assert.False(t, m.DB.Migrator().HasColumn("widgets", "name"))
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, statuses, 2)
+	assert.NotNil(t, statuses[0].AppliedAt)
+	assert.Nil(t, statuses[1].AppliedAt)
+
+	pending, err = m.Pending(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, int64(2), pending[0].Version)
+
+	reverted, err = m.Down(ctx, 5)
+	require.NoError(t, err)
+	assert.Len(t, reverted, 1)
+	assert.False(t, m.DB.Migrator().HasTable("widgets"))
+}
+
+func TestMigrator_FailedMigrationIsNotRecorded(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, []infrastructure.Migration{
+		{Version: 1, Name: "broken", Up: func(tx *gorm.DB) error {
+			if err := tx.Exec("CREATE TABLE half_done (id INTEGER)").Error; err != nil {
+				return err
+			}
+			return errors.New("boom")
+		}},
+	})
+
+	_, err := m.Up(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "migrate: up 0001_broken")
+
+	statuses, err := m.Status(ctx)
+	require.NoError(t, err)
+	assert.Nil(t, statuses[0].AppliedAt)
+	assert.False(t, m.DB.Migrator().HasTable("half_done"))
+}
+
+func TestMigrator_DownRefusesIrreversible(t *testing.T) {
+	ctx := context.Background()
+	m := newTestMigrator(t, []infrastructure.Migration{
+		{Version: 1, Name: "one_way", Up: func(tx *gorm.DB) error { return nil }},
+	})
+
+	_, err := m.Up(ctx)
+	require.NoError(t, err)
+
+	_, err = m.Down(ctx, 1)
+	assert.ErrorContains(t, err, "irreversible")
+
+	_, err = m.Down(ctx, 0)
+	assert.Error(t, err)
+}
+
+func TestNewMigrator_RejectsDuplicateVersions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	noop := func(tx *gorm.DB) error { return nil }
+	_, err = infrastructure.NewMigrator(db, []infrastructure.Migration{
+		{Version: 3, Name: "a", Up: noop},
+		{Version: 3, Name: "b", Up: noop},
+	})
+	assert.ErrorContains(t, err, "share version 3")
+}
+
+func TestLoadSQLMigrations_Invalid(t *testing.T) {
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":     {"add-thing.up.sql": {}},
+		"missing up":   {"0001_thing.down.sql": {}},
+		"name clashes": {"0001_a.up.sql": {}, "0001_b.up.sql": {}},
+	} {
+		_, err := infrastructure.LoadSQLMigrations(fsys)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestMigrations_ServiceMigrationsAreValid(t *testing.T) {
+	migrations, err := infrastructure.Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+	assert.Equal(t, "0001_baseline", migrations[0].String())
+}
+
+func TestCreateMigration(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "0007_existing.up.sql"), nil, 0o644))
+
+	up, down, err := infrastructure.CreateMigration(dir, "Add Orders Note!", nil)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "0008_add_orders_note.up.sql"), up)
+	assert.Equal(t, filepath.Join(dir, "0008_add_orders_note.down.sql"), down)
+	assert.FileExists(t, up)
+	assert.FileExists(t, down)
+
+	noop := func(tx *gorm.DB) error { return nil }
+	up, _, err = infrastructure.CreateMigration(dir, "next", []infrastructure.Migration{{Version: 20, Up: noop}})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "0021_next.up.sql"), up)
+
+	_, _, err = infrastructure.CreateMigration(dir, "!!!", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,277 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// minRSABits is the smallest RSA modulus accepted from a JWKS.
+const minRSABits = 2048
+
+// maxJWKSSize bounds the size of a JWKS document.
+const maxJWKSSize = 1 << 20
+
+// KeySet holds the public keys of a JWKS, by key ID.
+type KeySet struct {
+	keys map[string]crypto.PublicKey
+}
+
+// jwk is a JSON Web Key (RFC 7517). Only the members of public RSA and EC
+// keys are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS parses a JWKS document. RSA keys (for RS256) and EC P-256 keys
+// (for ES256) are kept; keys of other types, or meant for encryption rather
+// than signatures, are skipped.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+
+	set := &KeySet{keys: make(map[string]crypto.PublicKey, len(doc.Keys))}
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		var (
+			key crypto.PublicKey
+			err error
+		)
+		switch {
+		case k.Kty == "RSA" && (k.Alg == "" || k.Alg == AlgRS256):
+			key, err = parseRSAKey(k)
+		case k.Kty == "EC" && k.Crv == "P-256" && (k.Alg == "" || k.Alg == AlgES256):
+			key, err = parseECKey(k)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse JWKS key %q: %w", k.Kid, err)
+		}
+
+		if _, dup := set.keys[k.Kid]; dup {
+			return nil, fmt.Errorf("parse JWKS: duplicate key ID %q", k.Kid)
+		}
+		set.keys[k.Kid] = key
+	}
+
+	return set, nil
+}
+
+func parseRSAKey(k jwk) (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, fmt.Errorf("invalid modulus: %w", err)
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, fmt.Errorf("invalid exponent")
+	}
+
+	key := &rsa.PublicKey{
+		N: new(big.Int).SetBytes(n),
+		E: int(new(big.Int).SetBytes(e).Int64()),
+	}
+	if key.N.BitLen() < minRSABits {
+		return nil, fmt.Errorf("RSA key has %d bits, need at least %d", key.N.BitLen(), minRSABits)
+	}
+	if key.E < 3 || key.E%2 == 0 {
+		return nil, fmt.Errorf("invalid exponent %d", key.E)
+	}
+	return key, nil
+}
+
+func parseECKey(k jwk) (*ecdsa.PublicKey, error) {
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil || len(x) != 32 {
+		return nil, fmt.Errorf("invalid x coordinate")
+	}
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil || len(y) != 32 {
+		return nil, fmt.Errorf("invalid y coordinate")
+	}
+
+	point := append(append([]byte{4}, x...), y...)
+	key, err := ecdsa.ParseUncompressedPublicKey(elliptic.P256(), point)
+	if err != nil {
+		return nil, fmt.Errorf("invalid point: %w", err)
+	}
+	return key, nil
+}
+
+// Len returns the number of keys in the set.
+func (s *KeySet) Len() int {
+	return len(s.keys)
+}
+
+// Key returns the key with the given ID. A token without a key ID matches the
+// only key of a single-key set.
+func (s *KeySet) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := s.keys[kid]; ok {
+		return key, nil
+	}
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q: %w", kid, ErrUnknownKey)
+}
+
+// KeySource serves the keys of a JWKS read from a file or an http(s) URL.
+// The JWKS is read on first use and read again when a token names a key it
+// does not hold, at most once per MinRefresh, so that rotated keys are
+// picked up without a restart.
+type KeySource struct {
+	Location   string        // file path or http(s) URL
+	Client     *http.Client  // used for URLs
+	MinRefresh time.Duration // minimum time between two reads
+
+	mu      sync.RWMutex
+	keys    *KeySet
+	fetched time.Time
+
+	refreshes singleflight.Group // coalesces concurrent reads of the JWKS
+}
+
+// NewKeySource returns a KeySource for the JWKS at location.
+func NewKeySource(location string) *KeySource {
+	return &KeySource{
+		Location:   location,
+		Client:     &http.Client{Timeout: 10 * time.Second},
+		MinRefresh: time.Minute,
+	}
+}
+
+// Load reads the JWKS, replacing the keys held so far.
+func (s *KeySource) Load(ctx context.Context) error {
+	return s.refresh(ctx, true)
+}
+
+// refresh reads the JWKS and swaps in its keys. Unless force is set, it
+// does nothing if the JWKS was read less than MinRefresh ago. Concurrent
+// callers share one read, which is made without holding s.mu, so that
+// lookups of known keys are never held up by a slow JWKS endpoint.
+func (s *KeySource) refresh(ctx context.Context, force bool) error {
+	// The read is shared, so it must not end when the first caller's
+	// request does; Client.Timeout bounds it instead.
+	ctx = context.WithoutCancel(ctx)
+
+	_, err, _ := s.refreshes.Do("jwks", func() (any, error) {
+		s.mu.Lock()
+		if !force && time.Since(s.fetched) < s.MinRefresh {
+			s.mu.Unlock()
+			return nil, nil
+		}
+		s.fetched = time.Now()
+		s.mu.Unlock()
+
+		keys, err := s.fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		s.mu.Lock()
+		s.keys = keys
+		s.mu.Unlock()
+		return nil, nil
+	})
+	return err
+}
+
+// fetch reads and parses the JWKS.
+func (s *KeySource) fetch(ctx context.Context) (*KeySet, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("load JWKS from %s: %w", s.Location, err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, fmt.Errorf("load JWKS from %s: %w", s.Location, err)
+	}
+	if keys.Len() == 0 {
+		return nil, fmt.Errorf("load JWKS from %s: no usable signing keys", s.Location)
+	}
+	return keys, nil
+}
+
+func (s *KeySource) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.Location, "http://") && !strings.HasPrefix(s.Location, "https://") {
+		return os.ReadFile(s.Location)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Location, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+// Key returns the key with the given ID, reading the JWKS again if it is
+// unknown and MinRefresh has passed since the last read.
+func (s *KeySource) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if keys := s.current(); keys != nil {
+		if key, err := keys.Key(ctx, kid); err == nil {
+			return key, nil
+		}
+	}
+
+	// A failed refresh keeps the keys read before.
+	err := s.refresh(ctx, false)
+
+	keys := s.current()
+	if keys == nil {
+		if err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("key %q: %w", kid, ErrUnknownKey)
+	}
+	return keys.Key(ctx, kid)
+}
+
+// current returns the keys read last, or nil if none were.
+func (s *KeySource) current() *KeySet {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys
+}
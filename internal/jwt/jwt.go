@@ -0,0 +1,294 @@
+// Package jwt verifies JSON Web Tokens signed with RS256 or ES256 against the
+// keys of a JWKS.
+//
+// Only what the API needs is implemented: compact JWS tokens, the two
+// asymmetric algorithms above, and the registered claims iss, sub, aud, exp,
+// nbf and iat. Tokens signed with any other algorithm, including "none" and
+// the HMAC ones, are rejected.
+package jwt
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported signature algorithms.
+const (
+	AlgRS256 = "RS256"
+	AlgES256 = "ES256"
+)
+
+var (
+	ErrMalformed            = errors.New("malformed token")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrInvalidSignature     = errors.New("invalid signature")
+	ErrExpired              = errors.New("token is expired")
+	ErrNotYetValid          = errors.New("token is not valid yet")
+	ErrInvalidClaims        = errors.New("invalid claims")
+)
+
+// Keys provides the public keys tokens are verified with.
+type Keys interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// Claims are the claims of a verified token.
+type Claims struct {
+	Issuer    string
+	Subject   string
+	Audience  []string
+	ExpiresAt time.Time
+	NotBefore time.Time // zero if absent
+	IssuedAt  time.Time // zero if absent
+
+	// Raw holds every claim as decoded from JSON; numbers are json.Number.
+	Raw map[string]any
+}
+
+// Scopes returns the scopes granted by the "scope" claim (a space-separated
+// string, RFC 8693) or, failing that, the "scp" claim (a string or a list).
+func (c Claims) Scopes() []string {
+	if s, ok := c.Raw["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	return stringList(c.Raw["scp"])
+}
+
+// Strings returns the strings in the claim name, which may be a single
+// space-separated string or a list of strings.
+func (c Claims) Strings(name string) []string {
+	return stringList(c.Raw[name])
+}
+
+// Verifier verifies tokens issued by Issuer for Audience.
+type Verifier struct {
+	Keys     Keys
+	Issuer   string
+	Audience string
+	Leeway   time.Duration    // tolerated clock skew for exp, nbf and iat
+	Now      func() time.Time // defaults to time.Now
+}
+
+// header is the JOSE header of a token.
+type header struct {
+	Alg  string   `json:"alg"`
+	Kid  string   `json:"kid"`
+	Crit []string `json:"crit"`
+}
+
+// Verify checks the signature of token and its iss, aud, exp, nbf and iat
+// claims, and returns its claims. The sub claim is required.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrMalformed
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return Claims{}, err
+	}
+	if h.Alg != AlgRS256 && h.Alg != AlgES256 {
+		return Claims{}, fmt.Errorf("%q: %w", h.Alg, ErrUnsupportedAlgorithm)
+	}
+	if len(h.Crit) > 0 {
+		return Claims{}, fmt.Errorf("critical header parameters %v: %w", h.Crit, ErrMalformed)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, ErrMalformed
+	}
+
+	key, err := v.Keys.Key(ctx, h.Kid)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := verifySignature(h.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return Claims{}, err
+	}
+
+	var raw map[string]any
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return Claims{}, err
+	}
+
+	claims, err := parseClaims(raw)
+	if err != nil {
+		return Claims{}, err
+	}
+	if err := v.validate(claims); err != nil {
+		return Claims{}, err
+	}
+
+	return claims, nil
+}
+
+// validate checks the registered claims against v.
+func (v *Verifier) validate(c Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	if c.Issuer != v.Issuer {
+		return fmt.Errorf("issuer %q: %w", c.Issuer, ErrInvalidClaims)
+	}
+	if !slices.Contains(c.Audience, v.Audience) {
+		return fmt.Errorf("audience %q: %w", c.Audience, ErrInvalidClaims)
+	}
+	if c.Subject == "" {
+		return fmt.Errorf("missing subject: %w", ErrInvalidClaims)
+	}
+	if c.ExpiresAt.IsZero() {
+		return fmt.Errorf("missing expiry: %w", ErrInvalidClaims)
+	}
+	if !now.Before(c.ExpiresAt.Add(v.Leeway)) {
+		return ErrExpired
+	}
+	if !c.NotBefore.IsZero() && now.Add(v.Leeway).Before(c.NotBefore) {
+		return ErrNotYetValid
+	}
+	if !c.IssuedAt.IsZero() && now.Add(v.Leeway).Before(c.IssuedAt) {
+		return ErrNotYetValid
+	}
+	return nil
+}
+
+// verifySignature checks sig over signingInput. The key type must match alg,
+// so a key published for one algorithm cannot verify tokens of another.
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case AlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s with %T: %w", alg, key, ErrUnsupportedAlgorithm)
+		}
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrInvalidSignature
+		}
+
+	case AlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%s with %T: %w", alg, key, ErrUnsupportedAlgorithm)
+		}
+		// JWS encodes ECDSA signatures as the fixed-size concatenation r || s.
+		if len(sig) != 64 {
+			return ErrInvalidSignature
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrInvalidSignature
+		}
+
+	default:
+		return fmt.Errorf("%q: %w", alg, ErrUnsupportedAlgorithm)
+	}
+
+	return nil
+}
+
+// parseClaims extracts the registered claims from raw.
+func parseClaims(raw map[string]any) (Claims, error) {
+	c := Claims{Raw: raw}
+
+	var ok bool
+	if v, present := raw["iss"]; present {
+		if c.Issuer, ok = v.(string); !ok {
+			return Claims{}, fmt.Errorf("iss: %w", ErrInvalidClaims)
+		}
+	}
+	if v, present := raw["sub"]; present {
+		if c.Subject, ok = v.(string); !ok {
+			return Claims{}, fmt.Errorf("sub: %w", ErrInvalidClaims)
+		}
+	}
+
+	switch aud := raw["aud"].(type) {
+	case nil:
+	case string:
+		c.Audience = []string{aud}
+	case []any:
+		c.Audience = stringList(aud)
+		if len(c.Audience) != len(aud) {
+			return Claims{}, fmt.Errorf("aud: %w", ErrInvalidClaims)
+		}
+	default:
+		return Claims{}, fmt.Errorf("aud: %w", ErrInvalidClaims)
+	}
+
+	for name, dst := range map[string]*time.Time{"exp": &c.ExpiresAt, "nbf": &c.NotBefore, "iat": &c.IssuedAt} {
+		t, err := numericDate(raw[name])
+		if err != nil {
+			return Claims{}, fmt.Errorf("%s: %w", name, err)
+		}
+		*dst = t
+	}
+
+	return c, nil
+}
+
+// numericDate converts a NumericDate claim (seconds since the epoch) to a
+// time, dropping fractions of a second. An absent claim yields the zero time.
+func numericDate(v any) (time.Time, error) {
+	if v == nil {
+		return time.Time{}, nil
+	}
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, ErrInvalidClaims
+	}
+	secs, err := n.Float64()
+	if err != nil {
+		return time.Time{}, ErrInvalidClaims
+	}
+	return time.Unix(int64(secs), 0), nil
+}
+
+// stringList returns the strings in v, which may be a string or a list.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a token into dst.
+func decodeSegment(seg string, dst any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return ErrMalformed
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(dst); err != nil {
+		return ErrMalformed
+	}
+	return nil
+}
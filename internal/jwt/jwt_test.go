@@ -0,0 +1,361 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIssuer   = "https://sso.example.com/"
+	testAudience = "orders-api"
+)
+
+// testKeys are locally generated signing keys and the JWKS publishing them.
+type testKeys struct {
+	rsa  *rsa.PrivateKey
+	ec   *ecdsa.PrivateKey
+	jwks []byte
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	return testKeys{rsa: rsaKey, ec: ecKey, jwks: jwksFor(t, map[string]crypto.PublicKey{
+		"rsa-1": &rsaKey.PublicKey,
+		"ec-1":  &ecKey.PublicKey,
+	})}
+}
+
+func jwksFor(t *testing.T, keys map[string]crypto.PublicKey) []byte {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	var doc struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for kid, key := range keys {
+		switch key := key.(type) {
+		case *rsa.PublicKey:
+			doc.Keys = append(doc.Keys, map[string]string{
+				"kty": "RSA", "kid": kid, "use": "sig", "alg": AlgRS256,
+				"n": b64(key.N.Bytes()), "e": b64(big.NewInt(int64(key.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			x, y := make([]byte, 32), make([]byte, 32)
+			key.X.FillBytes(x)
+			key.Y.FillBytes(y)
+			doc.Keys = append(doc.Keys, map[string]string{
+				"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(x), "y": b64(y),
+			})
+		}
+	}
+
+	data, err := json.Marshal(doc)
+	require.NoError(t, err)
+	return data
+}
+
+// sign returns a compact token with claims, signed with key under kid.
+func sign(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	h, err := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+
+	input := b64(h) + "." + b64(c)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	}
+
+	return input + "." + b64(sig)
+}
+
+func validClaims(now time.Time) map[string]any {
+	return map[string]any{
+		"iss":   testIssuer,
+		"sub":   "user-42",
+		"aud":   []string{testAudience, "other"},
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"scope": "orders:read orders:write",
+	}
+}
+
+func newVerifier(t *testing.T, keys testKeys, now time.Time) *Verifier {
+	t.Helper()
+
+	set, err := ParseJWKS(keys.jwks)
+	require.NoError(t, err)
+	return &Verifier{
+		Keys:     set,
+		Issuer:   testIssuer,
+		Audience: testAudience,
+		Leeway:   30 * time.Second,
+		Now:      func() time.Time { return now },
+	}
+}
+
+func TestVerify_RS256AndES256(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	v := newVerifier(t, keys, now)
+
+	for _, token := range []string{
+		sign(t, AlgRS256, "rsa-1", keys.rsa, validClaims(now)),
+		sign(t, AlgES256, "ec-1", keys.ec, validClaims(now)),
+	} {
+		claims, err := v.Verify(context.Background(), token)
+		require.NoError(t, err)
+		assert.Equal(t, "user-42", claims.Subject)
+		assert.Equal(t, testIssuer, claims.Issuer)
+		assert.Equal(t, []string{testAudience, "other"}, claims.Audience)
+		assert.Equal(t, now.Add(time.Hour).Unix(), claims.ExpiresAt.Unix())
+		assert.Equal(t, []string{"orders:read", "orders:write"}, claims.Scopes())
+	}
+}
+
+func TestVerify_RejectsInvalidTokens(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	v := newVerifier(t, keys, now)
+
+	with := func(mutate func(c map[string]any)) map[string]any {
+		c := validClaims(now)
+		mutate(c)
+		return c
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	// A valid signature over claims other than the ones sent.
+	valid := strings.Split(sign(t, AlgES256, "ec-1", keys.ec, validClaims(now)), ".")
+	forged := strings.Split(sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { c["sub"] = "admin" })), ".")
+	tampered := valid[0] + "." + forged[1] + "." + valid[2]
+
+	for name, tc := range map[string]struct {
+		token string
+		err   error
+	}{
+		"not a JWT":         {"not-a-jwt", ErrMalformed},
+		"tampered payload":  {tampered, ErrInvalidSignature},
+		"alg none":          {unsigned(t, "none", validClaims(now)), ErrUnsupportedAlgorithm},
+		"alg HS256":         {unsigned(t, "HS256", validClaims(now)), ErrUnsupportedAlgorithm},
+		"unknown kid":       {sign(t, AlgES256, "ec-2", keys.ec, validClaims(now)), ErrUnknownKey},
+		"wrong key":         {sign(t, AlgES256, "ec-1", otherKey, validClaims(now)), ErrInvalidSignature},
+		"alg/key mismatch":  {sign(t, AlgES256, "rsa-1", keys.ec, validClaims(now)), ErrUnsupportedAlgorithm},
+		"expired":           {sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { c["exp"] = now.Add(-time.Minute).Unix() })), ErrExpired},
+		"not yet valid":     {sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { c["nbf"] = now.Add(time.Minute).Unix() })), ErrNotYetValid},
+		"missing exp":       {sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { delete(c, "exp") })), ErrInvalidClaims},
+		"wrong issuer":      {sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { c["iss"] = "https://evil.example.com/" })), ErrInvalidClaims},
+		"wrong audience":    {sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { c["aud"] = "billing" })), ErrInvalidClaims},
+		"missing subject":   {sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { delete(c, "sub") })), ErrInvalidClaims},
+		"non-numeric exp":   {sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { c["exp"] = "tomorrow" })), ErrInvalidClaims},
+		"non-string issuer": {sign(t, AlgES256, "ec-1", keys.ec, with(func(c map[string]any) { c["iss"] = 7 })), ErrInvalidClaims},
+	} {
+		_, err := v.Verify(context.Background(), tc.token)
+		assert.ErrorIs(t, err, tc.err, name)
+	}
+}
+
+func TestVerify_Leeway(t *testing.T) {
+	keys := newTestKeys(t)
+	now := time.Now()
+	v := newVerifier(t, keys, now)
+
+	claims := validClaims(now)
+	claims["exp"] = now.Add(-10 * time.Second).Unix()
+	_, err := v.Verify(context.Background(), sign(t, AlgRS256, "rsa-1", keys.rsa, claims))
+	assert.NoError(t, err)
+}
+
+// unsigned returns a token with an empty signature under alg.
+func unsigned(t *testing.T, alg string, claims map[string]any) string {
+	t.Helper()
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	h, err := json.Marshal(map[string]string{"alg": alg})
+	require.NoError(t, err)
+	c, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return b64(h) + "." + b64(c) + "."
+}
+
+func TestClaims_Scopes(t *testing.T) {
+	assert.Equal(t, []string{"a", "b"}, Claims{Raw: map[string]any{"scope": "a b"}}.Scopes())
+	assert.Equal(t, []string{"a", "b"}, Claims{Raw: map[string]any{"scp": []any{"a", "b"}}}.Scopes())
+	assert.Empty(t, Claims{Raw: map[string]any{}}.Scopes())
+}
+
+func TestParseJWKS(t *testing.T) {
+	keys := newTestKeys(t)
+
+	set, err := ParseJWKS(keys.jwks)
+	require.NoError(t, err)
+	assert.Equal(t, 2, set.Len())
+
+	_, err = set.Key(context.Background(), "rsa-1")
+	assert.NoError(t, err)
+	_, err = set.Key(context.Background(), "")
+	assert.ErrorIs(t, err, ErrUnknownKey, "a token without kid is ambiguous with several keys")
+
+	// Encryption keys and unsupported key types are skipped.
+	set, err = ParseJWKS([]byte(`{"keys":[
+		{"kty":"RSA","kid":"enc","use":"enc","n":"AQAB","e":"AQAB"},
+		{"kty":"oct","kid":"hmac","k":"c2VjcmV0"},
+		{"kty":"EC","kid":"p384","crv":"P-384","x":"AA","y":"AA"}
+	]}`))
+	require.NoError(t, err)
+	assert.Equal(t, 0, set.Len())
+
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = ParseJWKS(jwksFor(t, map[string]crypto.PublicKey{"weak": &weak.PublicKey}))
+	assert.Error(t, err)
+
+	_, err = ParseJWKS([]byte(`{"keys":[{"kty":"EC","kid":"bad","crv":"P-256","x":"AA","y":"AA"}]}`))
+	assert.Error(t, err)
+
+	_, err = ParseJWKS([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestKeySource_File(t *testing.T) {
+	keys := newTestKeys(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, keys.jwks, 0o600))
+
+	src := NewKeySource(path)
+	require.NoError(t, src.Load(context.Background()))
+
+	_, err := src.Key(context.Background(), "ec-1")
+	assert.NoError(t, err)
+
+	assert.Error(t, NewKeySource(filepath.Join(t.TempDir(), "missing.json")).Load(context.Background()))
+}
+
+func TestKeySource_URLRefreshesOnUnknownKey(t *testing.T) {
+	first := newTestKeys(t)
+	rotated := newTestKeys(t)
+
+	var served atomic.Value
+	served.Store(first.jwks)
+	var fetches atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(served.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	src := NewKeySource(srv.URL)
+	src.MinRefresh = 0
+
+	_, err := src.Key(context.Background(), "ec-1")
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, fetches.Load())
+
+	// The issuer rotates to a JWKS with a new EC key under a new ID.
+	served.Store(jwksFor(t, map[string]crypto.PublicKey{"ec-2": &rotated.ec.PublicKey}))
+
+	key, err := src.Key(context.Background(), "ec-2")
+	require.NoError(t, err)
+	assert.True(t, rotated.ec.PublicKey.Equal(key))
+	assert.EqualValues(t, 2, fetches.Load())
+
+	// Refreshes are throttled.
+	src.MinRefresh = time.Hour
+	_, err = src.Key(context.Background(), "ec-3")
+	assert.ErrorIs(t, err, ErrUnknownKey)
+	assert.EqualValues(t, 2, fetches.Load())
+}
+
+func TestKeySource_RefreshDoesNotBlockKnownKeys(t *testing.T) {
+	keys := newTestKeys(t)
+
+	release := make(chan struct{})
+	var fetches atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fetches.Add(1) > 1 {
+			<-release // later reads hang until released
+		}
+		_, _ = w.Write(keys.jwks)
+	}))
+	defer srv.Close()
+
+	src := NewKeySource(srv.URL)
+	src.MinRefresh = 0
+	require.NoError(t, src.Load(context.Background()))
+
+	// Tokens naming unknown keys all wait on one read of the JWKS...
+	var started, wg sync.WaitGroup
+	for range 5 {
+		started.Add(1)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			started.Done()
+			_, _ = src.Key(context.Background(), "unknown")
+		}()
+	}
+	started.Wait()
+	require.Eventually(t, func() bool { return fetches.Load() == 2 }, time.Second, 5*time.Millisecond)
+
+	// ...while known keys are served straight away.
+	done := make(chan error, 1)
+	go func() {
+		_, err := src.Key(context.Background(), "ec-1")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("known key lookup blocked by the refresh")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.EqualValues(t, 2, fetches.Load())
+}
@@ -0,0 +1,101 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// GormLogger writes GORM's logs through slog, so that queries run for a
+// request carry that request's Fields. Failed queries are logged as errors,
+// queries slower than SlowThreshold as warnings and all others at debug
+// level. Query parameters are never logged.
+type GormLogger struct {
+	SlowThreshold time.Duration
+	Level         logger.LogLevel
+}
+
+// NewGormLogger returns a GormLogger that logs everything slog lets through.
+func NewGormLogger(slowThreshold time.Duration) *GormLogger {
+	return &GormLogger{SlowThreshold: slowThreshold, Level: logger.Info}
+}
+
+// LogMode implements logger.Interface.
+func (l *GormLogger) LogMode(level logger.LogLevel) logger.Interface {
+	clone := *l
+	clone.Level = level
+	return &clone
+}
+
+// Info implements logger.Interface.
+func (l *GormLogger) Info(ctx context.Context, msg string, args ...any) {
+	if l.Level >= logger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Warn implements logger.Interface.
+func (l *GormLogger) Warn(ctx context.Context, msg string, args ...any) {
+	if l.Level >= logger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Error implements logger.Interface.
+func (l *GormLogger) Error(ctx context.Context, msg string, args ...any) {
+	if l.Level >= logger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// Trace implements logger.Interface; GORM calls it after every query.
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.Level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+
+	level := slog.LevelDebug
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.Level >= logger.Error:
+		level = slog.LevelError
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold && l.Level >= logger.Warn:
+		level = slog.LevelWarn
+	case l.Level < logger.Info:
+		return
+	}
+
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", sql),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+
+	msg := "query"
+	switch level {
+	case slog.LevelError:
+		msg = "query failed"
+		attrs = append(attrs, slog.Any("error", err))
+	case slog.LevelWarn:
+		msg = "slow query"
+	}
+
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
+
+// ParamsFilter implements gorm's logger.ParamsFilter: it drops query
+// parameters, so customer data and credentials stay out of the logs.
+func (l *GormLogger) ParamsFilter(_ context.Context, sql string, _ ...any) (string, []any) {
+	return sql, nil
+}
@@ -0,0 +1,115 @@
+// Package logging configures the service's structured logs: JSON records
+// written with log/slog, enriched with the attributes of the request being
+// served and with secrets redacted.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// ParseLevel parses a level name: debug, info, warn or error.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q: %w", s, err)
+	}
+	return level, nil
+}
+
+// New returns a logger writing JSON records of at least level to w. Records
+// logged with a context carry that context's Fields, and sensitive
+// attributes are redacted (see Redact).
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(&contextHandler{
+		Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: redactAttr,
+		}),
+	})
+}
+
+// Fields are attributes added to every record logged with a context that
+// carries them. Values may be slog.LogValuers, which are resolved when a
+// record is written, so a field can report state that changes over time,
+// such as the latency of the request so far.
+type Fields struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+type fieldsContextKey struct{}
+
+// WithFields returns a copy of ctx carrying a new, empty Fields, or ctx
+// itself if it already carries one.
+func WithFields(ctx context.Context) (context.Context, *Fields) {
+	if f := fieldsFrom(ctx); f != nil {
+		return ctx, f
+	}
+	f := &Fields{}
+	return context.WithValue(ctx, fieldsContextKey{}, f), f
+}
+
+// AddField sets key to value in the Fields of ctx, if it carries any.
+// Because Fields are shared, the field also appears on records logged with
+// the parent contexts of ctx, such as the final access log line.
+func AddField(ctx context.Context, key string, value any) {
+	if f := fieldsFrom(ctx); f != nil {
+		f.Set(key, value)
+	}
+}
+
+// Set sets key to value, replacing an earlier value of key.
+func (f *Fields) Set(key string, value any) {
+	attr := slog.Any(key, value)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i := range f.attrs {
+		if f.attrs[i].Key == key {
+			f.attrs[i] = attr
+			return
+		}
+	}
+	f.attrs = append(f.attrs, attr)
+}
+
+func (f *Fields) snapshot() []slog.Attr {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slog.Attr(nil), f.attrs...)
+}
+
+func fieldsFrom(ctx context.Context) *Fields {
+	if ctx == nil {
+		return nil
+	}
+	f, _ := ctx.Value(fieldsContextKey{}).(*Fields)
+	return f
+}
+
+// contextHandler adds the Fields of a record's context to the record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if f := fieldsFrom(ctx); f != nil {
+		r = r.Clone()
+		r.AddAttrs(f.snapshot()...)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
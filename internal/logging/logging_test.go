@@ -0,0 +1,113 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// decodeLines decodes the JSON records written to buf.
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+
+	var records []map[string]any
+	dec := json.NewDecoder(buf)
+	for dec.More() {
+		var rec map[string]any
+		require.NoError(t, dec.Decode(&rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+type counter struct{ n *int }
+
+func (c counter) LogValue() slog.Value {
+	*c.n++
+	return slog.IntValue(*c.n)
+}
+
+func TestNew_AddsContextFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	ctx, fields := WithFields(context.Background())
+	fields.Set("request_id", "req-1")
+	var n int
+	fields.Set("calls", counter{&n})
+
+	// A derived context shares the fields, and later fields show up on
+	// records logged with the parent context.
+	child := context.WithValue(ctx, struct{}{}, 1)
+	AddField(child, "caller", "jwt:alice")
+	AddField(child, "request_id", "req-2")
+
+	logger.InfoContext(ctx, "hello")
+	logger.DebugContext(ctx, "hidden")
+	logger.Info("no context")
+
+	records := decodeLines(t, &buf)
+	require.Len(t, records, 2)
+	assert.Equal(t, "hello", records[0]["msg"])
+	assert.Equal(t, "req-2", records[0]["request_id"])
+	assert.Equal(t, "jwt:alice", records[0]["caller"])
+	assert.EqualValues(t, 1, records[0]["calls"])
+	assert.NotContains(t, records[1], "request_id")
+
+	// Without Fields in the context, AddField does nothing.
+	AddField(context.Background(), "caller", "x")
+}
+
+func TestNew_RedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelInfo)
+
+	logger.Info("connecting",
+		"dsn", "postgres://orders:s3cr3t@db:5432/orders?sslmode=disable",
+		"kv_dsn", "host=db user=orders password=s3cr3t dbname=orders",
+		"cursor_secret", "abc",
+		"Authorization", "Bearer oak_x",
+		"error", errors.New("dial postgres://orders:s3cr3t@db: refused"),
+		"customer_id", 42,
+	)
+
+	out := buf.String()
+	assert.NotContains(t, out, "s3cr3t")
+	assert.NotContains(t, out, "oak_x")
+
+	rec := decodeLines(t, &buf)[0]
+	assert.Equal(t, "postgres://orders:[REDACTED]@db:5432/orders?sslmode=disable", rec["dsn"])
+	assert.Equal(t, "host=db user=orders password=[REDACTED] dbname=orders", rec["kv_dsn"])
+	assert.Equal(t, "[REDACTED]", rec["cursor_secret"])
+	assert.Equal(t, "[REDACTED]", rec["Authorization"])
+	assert.EqualValues(t, 42, rec["customer_id"])
+}
+
+func TestRedact(t *testing.T) {
+	assert.Equal(t, "postgres://u:[REDACTED]@h/db", Redact("postgres://u:p@h/db"))
+	assert.Equal(t, "postgres://u@h/db", Redact("postgres://u@h/db"))
+	assert.Equal(t, "password=[REDACTED] host=h", Redact("password='a b' host=h"))
+	assert.Equal(t, "nothing to hide", Redact("nothing to hide"))
+}
+
+func TestParseLevel(t *testing.T) {
+	for in, want := range map[string]slog.Level{
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	} {
+		got, err := ParseLevel(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+
+	_, err := ParseLevel("verbose")
+	assert.Error(t, err)
+}
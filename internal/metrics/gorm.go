@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+// GormPlugin is a GORM plugin that records the duration of every operation
+// in Duration, labelled by operation. A nil Duration means DBQueryDuration.
+type GormPlugin struct {
+	Duration *prometheus.HistogramVec
+}
+
+// Name implements gorm.Plugin.
+func (p *GormPlugin) Name() string {
+	return "metrics"
+}
+
+const startKey = "metrics:start"
+
+// callbackRegisterer is what GORM's Before and After return.
+type callbackRegisterer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// Initialize implements gorm.Plugin: it registers callbacks that run first
+// and last around each operation.
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	duration := p.Duration
+	if duration == nil {
+		duration = DBQueryDuration
+	}
+
+	cb := db.Callback()
+	hooks := []struct {
+		operation     string
+		before, after callbackRegisterer
+	}{
+		{"create", cb.Create().Before("*"), cb.Create().After("*")},
+		{"query", cb.Query().Before("*"), cb.Query().After("*")},
+		{"update", cb.Update().Before("*"), cb.Update().After("*")},
+		{"delete", cb.Delete().Before("*"), cb.Delete().After("*")},
+		{"row", cb.Row().Before("*"), cb.Row().After("*")},
+		{"raw", cb.Raw().Before("*"), cb.Raw().After("*")},
+	}
+
+	for _, h := range hooks {
+		if err := h.before.Register("metrics:before_"+h.operation, start); err != nil {
+			return err
+		}
+		if err := h.after.Register("metrics:after_"+h.operation, observe(duration.WithLabelValues(h.operation))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func start(db *gorm.DB) {
+	db.InstanceSet(startKey, time.Now())
+}
+
+func observe(h prometheus.Observer) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		if v, ok := db.InstanceGet(startKey); ok {
+			if began, ok := v.(time.Time); ok {
+				h.Observe(time.Since(began).Seconds())
+			}
+		}
+	}
+}
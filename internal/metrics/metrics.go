@@ -0,0 +1,61 @@
+// Package metrics defines the service's Prometheus metrics and serves them
+// with the Prometheus client library.
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Registry holds the service's metrics, along with the Go runtime and
+// process metrics. It is served by Handler.
+var Registry = prometheus.NewRegistry()
+
+// factory registers the metrics of this package in Registry.
+var factory = promauto.With(Registry)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// Handler serves the metrics in Registry to a Prometheus scrape.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// dbName labels the connection pool statistics reported by ObserveDB.
+const dbName = "orders"
+
+// ObserveDB reports the sql.DBStats of db as the go_sql_* metrics, labelled
+// db_name="orders". It replaces any pool observed before.
+func ObserveDB(db *sql.DB) {
+	replaceCollector("db", collectors.NewDBStatsCollector(db, dbName))
+}
+
+var (
+	observedMu sync.Mutex
+	observed   = make(map[string]prometheus.Collector)
+)
+
+// replaceCollector registers c in Registry in place of the collector last
+// registered under name, for metrics read from an object that is only
+// known at runtime.
+func replaceCollector(name string, c prometheus.Collector) {
+	observedMu.Lock()
+	defer observedMu.Unlock()
+
+	if old, ok := observed[name]; ok {
+		Registry.Unregister(old)
+	}
+	observed[name] = c
+	Registry.MustRegister(c)
+}
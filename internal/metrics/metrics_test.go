@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// scrape returns what a Prometheus scrape of h receives.
+func scrape(t *testing.T, h http.Handler) string {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	return rec.Body.String()
+}
+
+func TestHandler(t *testing.T) {
+	OrdersCreated.Inc()
+	HTTPRequests.WithLabelValues("/orders/{id}", http.MethodGet, "200").Inc()
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain"))
+
+	out := rec.Body.String()
+	assert.Contains(t, out, "# TYPE orders_created_total counter\n")
+	assert.Contains(t, out, `http_requests_total{method="GET",route="/orders/{id}",status="200"}`)
+	assert.Contains(t, out, "# TYPE go_goroutines gauge\n")
+}
+
+func TestObserveDB(t *testing.T) {
+	open := func(maxOpen int) *sql.DB {
+		db, err := sql.Open("sqlite3", ":memory:")
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = db.Close() })
+		db.SetMaxOpenConns(maxOpen)
+		require.NoError(t, db.Ping())
+		return db
+	}
+
+	ObserveDB(open(3))
+	out := scrape(t, Handler())
+	assert.Contains(t, out, `go_sql_max_open_connections{db_name="orders"} 3`+"\n")
+	assert.Contains(t, out, `go_sql_open_connections{db_name="orders"} 1`+"\n")
+	assert.Contains(t, out, "# TYPE go_sql_wait_count_total counter\n")
+
+	// Observing another pool replaces the first.
+	ObserveDB(open(5))
+	assert.Contains(t, scrape(t, Handler()), `go_sql_max_open_connections{db_name="orders"} 5`+"\n")
+}
+
+func TestObserveRateLimiter(t *testing.T) {
+	tracked := 3
+	ObserveRateLimiter(func() int { return tracked })
+	assert.Contains(t, scrape(t, Handler()), "ratelimit_tracked_clients 3\n")
+
+	// The value is read on every scrape.
+	tracked = 5
+	assert.Contains(t, scrape(t, Handler()), "ratelimit_tracked_clients 5\n")
+
+	ObserveRateLimiter(func() int { return 1 })
+	assert.Contains(t, scrape(t, Handler()), "ratelimit_tracked_clients 1\n")
+}
+
+func TestGormPlugin(t *testing.T) {
+	r := prometheus.NewRegistry()
+	duration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "query_seconds",
+	}, []string{"operation"})
+	r.MustRegister(duration)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(&GormPlugin{Duration: duration}))
+
+	type widget struct {
+		ID   int64
+		Name string
+	}
+	require.NoError(t, db.AutoMigrate(&widget{}))
+
+	require.NoError(t, db.Create(&widget{Name: "a"}).Error)
+	require.NoError(t, db.Model(&widget{}).Where("id = ?", 1).Update("name", "b").Error)
+	var got []widget
+	require.NoError(t, db.Find(&got).Error)
+	require.NoError(t, db.Find(&got).Error)
+	require.NoError(t, db.Delete(&widget{}, 1).Error)
+
+	out := scrape(t, promhttp.HandlerFor(r, promhttp.HandlerOpts{}))
+	assert.Contains(t, out, `query_seconds_count{operation="create"} 1`+"\n")
+	assert.Contains(t, out, `query_seconds_count{operation="update"} 1`+"\n")
+	assert.Contains(t, out, `query_seconds_count{operation="query"} 2`+"\n")
+	assert.Contains(t, out, `query_seconds_count{operation="delete"} 1`+"\n")
+}
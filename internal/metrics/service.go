@@ -0,0 +1,104 @@
+package metrics
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// HTTP metrics, recorded by middleware.Metrics. route is the chi route
+// pattern, such as "/orders/{id}", or "unmatched".
+var (
+	HTTPRequests = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "HTTP requests served, by route pattern, method and status.",
+	}, []string{"route", "method", "status"})
+	HTTPRequestDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "Time taken to serve HTTP requests, by route pattern, method and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+)
+
+// Rate limiter metrics.
+var (
+	RateLimitRejections = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "ratelimit_rejections_total",
+		Help: "Requests rejected with 429 Too Many Requests, by rate limit policy.",
+	}, []string{"policy"})
+	RateLimitEvictedClients = factory.NewCounter(prometheus.CounterOpts{
+		Name: "ratelimit_evicted_clients_total",
+		Help: "Clients forgotten by the in-memory rate limiter, by sweeps or to stay under its cap.",
+	})
+)
+
+// ObserveRateLimiter reports tracked, read on every scrape, as the number
+// of clients tracked by the in-memory rate limiter. It replaces any
+// function observed before.
+func ObserveRateLimiter(tracked func() int) {
+	replaceCollector("ratelimit", prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "ratelimit_tracked_clients",
+		Help: "Clients tracked by the in-memory rate limiter.",
+	}, func() float64 { return float64(tracked()) }))
+}
+
+// DBQueryDuration is recorded by GormPlugin. operation is create, query,
+// update, delete, row or raw.
+var DBQueryDuration = factory.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "db_query_duration_seconds",
+	Help:    "Time taken by GORM operations, by operation.",
+	Buckets: []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5},
+}, []string{"operation"})
+
+// Business metrics, recorded by the order handler.
+var (
+	OrdersCreated = factory.NewCounter(prometheus.CounterOpts{
+		Name: "orders_created_total",
+		Help: "Orders created.",
+	})
+	OrdersShipped = factory.NewCounter(prometheus.CounterOpts{
+		Name: "orders_shipped_total",
+		Help: "Orders moved to shipped.",
+	})
+	OrdersCompleted = factory.NewCounter(prometheus.CounterOpts{
+		Name: "orders_completed_total",
+		Help: "Orders moved to completed.",
+	})
+)
+
+// Outbox relay metrics.
+var (
+	OutboxDelivered = factory.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_events_delivered_total",
+		Help: "Outbox events delivered to every sink.",
+	})
+	OutboxFailures = factory.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_delivery_failures_total",
+		Help: "Failed outbox event deliveries that will be retried.",
+	})
+	OutboxDeadLettered = factory.NewCounter(prometheus.CounterOpts{
+		Name: "outbox_events_dead_lettered_total",
+		Help: "Outbox events given up on after repeated delivery failures.",
+	})
+)
+
+// Webhook metrics, recorded by the webhook sink. result is success or
+// failure.
+var (
+	WebhookDeliveries = factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "webhook_deliveries_total",
+		Help: "Webhook delivery attempts, by result.",
+	}, []string{"result"})
+	WebhooksDisabled = factory.NewCounter(prometheus.CounterOpts{
+		Name: "webhooks_disabled_total",
+		Help: "Webhooks disabled after repeated delivery failures.",
+	})
+)
+
+// Event stream metrics.
+var (
+	StreamSubscribers = factory.NewGauge(prometheus.GaugeOpts{
+		Name: "stream_subscribers",
+		Help: "Clients subscribed to the order event stream.",
+	})
+	StreamLagged = factory.NewCounter(prometheus.CounterOpts{
+		Name: "stream_lagged_subscribers_total",
+		Help: "Stream subscribers dropped for falling behind.",
+	})
+)
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/corradoisidoro/orders-api/internal/apikey"
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+)
+
+// APIKeyStore looks up API keys by ID.
+type APIKeyStore interface {
+	FindAPIKey(ctx context.Context, keyID string) (model.APIKey, error)
+}
+
+// APIKeyAuthMiddleware authenticates requests carrying an API key in an
+// "Authorization: Bearer oak_..." header and stores the caller in the request
+// context (see ClientFrom). Requests without an Authorization header pass
+// through anonymously, so that RequireScope decides which routes need one,
+// and so do bearer tokens that are not API keys, which JWTAuthMiddleware
+// handles. Requests with an invalid, unknown or revoked key are rejected
+// with 401.
+func APIKeyAuthMiddleware(store APIKeyStore) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := r.Header.Get("Authorization")
+			if header == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			token, ok := bearerToken(header)
+			if !ok {
+				unauthorized(w, "invalid Authorization header")
+				return
+			}
+			if !apikey.IsToken(token) {
+				// Some other kind of bearer token, such as a JWT.
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			keyID, secret, err := apikey.Parse(token)
+			if err != nil {
+				unauthorized(w, "invalid API key")
+				return
+			}
+
+			key, err := store.FindAPIKey(r.Context(), keyID)
+			if err != nil {
+				if errors.Is(err, repository.ErrAPIKeyNotExist) {
+					unauthorized(w, "invalid API key")
+					return
+				}
+				slog.ErrorContext(r.Context(), "auth: find API key failed", "key_id", keyID, "error", err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to authenticate")
+				return
+			}
+
+			if key.Revoked() || !apikey.Verify(secret, key.SecretHash) {
+				unauthorized(w, "invalid API key")
+				return
+			}
+
+			// API keys are issued by operators and act as staff.
+			ctx := WithClient(r.Context(), Client{APIKeyID: key.KeyID, Staff: true, Scopes: key.Scopes})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// RequireScope rejects requests whose caller lacks scope: anonymous callers
+// get 401 Unauthorized and authenticated ones 403 Forbidden.
+func RequireScope(scope model.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			client := ClientFrom(r.Context())
+			if !client.Authenticated() {
+				unauthorized(w, "authentication required")
+				return
+			}
+			if !client.Scopes.Has(scope) {
+				writeJSONError(w, http.StatusForbidden, "missing scope "+string(scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireStaff rejects requests whose caller is not staff: anonymous callers
+// get 401 Unauthorized and customers 403 Forbidden. It guards routes that
+// span every customer.
+func RequireStaff(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		client := ClientFrom(r.Context())
+		if !client.Authenticated() {
+			unauthorized(w, "authentication required")
+			return
+		}
+		if !client.Staff {
+			writeJSONError(w, http.StatusForbidden, "staff only")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// bearerToken extracts the token of an "Authorization: Bearer" header.
+func bearerToken(header string) (string, bool) {
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="orders-api"`)
+	writeJSONError(w, http.StatusUnauthorized, msg)
+}
+
+// writeJSONError writes an error response in the API's {"error": msg} shape.
+func writeJSONError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/apikey"
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memAPIKeyStore map[string]model.APIKey
+
+type failingAPIKeyStore struct{}
+
+func (failingAPIKeyStore) FindAPIKey(context.Context, string) (model.APIKey, error) {
+	return model.APIKey{}, errors.New("db down")
+}
+
+func (s memAPIKeyStore) FindAPIKey(_ context.Context, keyID string) (model.APIKey, error) {
+	key, ok := s[keyID]
+	if !ok {
+		return model.APIKey{}, repository.ErrAPIKeyNotExist
+	}
+	return key, nil
+}
+
+// newAPIKey stores a new key with scopes in store and returns its token.
+func newAPIKey(t *testing.T, store memAPIKeyStore, scopes ...model.Scope) string {
+	t.Helper()
+
+	token, keyID, hash, err := apikey.Generate()
+	require.NoError(t, err)
+	store[keyID] = model.APIKey{KeyID: keyID, Name: "test", SecretHash: hash, Scopes: scopes}
+	return token
+}
+
+func authRequest(token string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req
+}
+
+func TestAPIKeyAuth_StoresClient(t *testing.T) {
+	store := memAPIKeyStore{}
+	token := newAPIKey(t, store, model.ScopeOrdersRead)
+
+	var got Client
+	handler := APIKeyAuthMiddleware(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientFrom(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, authRequest(token))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, got.Authenticated())
+	assert.Equal(t, model.Scopes{model.ScopeOrdersRead}, got.Scopes)
+}
+
+func TestAPIKeyAuth_AnonymousPassesThrough(t *testing.T) {
+	var got Client
+	handler := APIKeyAuthMiddleware(memAPIKeyStore{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientFrom(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, authRequest(""))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, got.Authenticated())
+}
+
+func TestAPIKeyAuth_RejectsBadCredentials(t *testing.T) {
+	store := memAPIKeyStore{}
+	valid := newAPIKey(t, store, model.ScopeOrdersRead)
+	revoked := newAPIKey(t, store, model.ScopeOrdersRead)
+	keyID, _, _ := apikey.Parse(revoked)
+	now := time.Now()
+	key := store[keyID]
+	key.RevokedAt = &now
+	store[keyID] = key
+
+	unknown, _, _, err := apikey.Generate()
+	require.NoError(t, err)
+
+	handler := APIKeyAuthMiddleware(store)(okHandler())
+
+	for name, header := range map[string]string{
+		"not bearer":   "Basic dXNlcjpwYXNz",
+		"empty bearer": "Bearer ",
+		"malformed":    "Bearer oak_nonsense",
+		"wrong secret": "Bearer " + valid + "x",
+		"unknown key":  "Bearer " + unknown,
+		"revoked key":  "Bearer " + revoked,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/orders", nil)
+		req.Header.Set("Authorization", header)
+		rr := httptest.NewRecorder()
+
+		handler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, name)
+		assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"), name)
+	}
+}
+
+func TestAPIKeyAuth_PassesOtherBearerTokens(t *testing.T) {
+	var got Client
+	handler := APIKeyAuthMiddleware(memAPIKeyStore{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientFrom(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, authRequest("eyJhbGciOiJFUzI1NiJ9.e30.sig"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, got.Authenticated())
+}
+
+func TestAPIKeyAuth_StoreFailure(t *testing.T) {
+	token, _, _, err := apikey.Generate()
+	require.NoError(t, err)
+
+	handler := APIKeyAuthMiddleware(failingAPIKeyStore{})(okHandler())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, authRequest(token))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
+func TestRequireScope(t *testing.T) {
+	handler := RequireScope(model.ScopeOrdersDelete)(okHandler())
+
+	serve := func(c Client) int {
+		req := httptest.NewRequest(http.MethodDelete, "/orders/1", nil)
+		req = req.WithContext(WithClient(req.Context(), c))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(Client{}))
+	assert.Equal(t, http.StatusForbidden, serve(Client{APIKeyID: "k", Scopes: model.Scopes{model.ScopeOrdersRead}}))
+	assert.Equal(t, http.StatusOK, serve(Client{APIKeyID: "k", Scopes: model.Scopes{model.ScopeOrdersDelete}}))
+}
+
+func TestRequireStaff(t *testing.T) {
+	handler := RequireStaff(okHandler())
+
+	serve := func(c Client) int {
+		req := httptest.NewRequest(http.MethodGet, "/webhooks", nil)
+		req = req.WithContext(WithClient(req.Context(), c))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, serve(Client{}))
+	assert.Equal(t, http.StatusForbidden, serve(Client{Subject: "alice", CustomerID: 7}))
+	assert.Equal(t, http.StatusOK, serve(Client{Subject: "bob", Staff: true}))
+	assert.Equal(t, http.StatusOK, serve(Client{APIKeyID: "k", Staff: true}))
+}
+
+func TestWithClient_AttributesOrderChanges(t *testing.T) {
+	ctx := context.WithValue(context.Background(), chimw.RequestIDKey, "req-1")
+	ctx = WithClient(ctx, Client{APIKeyID: "k1", Staff: true})
+
+	assert.Equal(t, repository.Actor{Name: "api_key:k1", RequestID: "req-1"}, repository.ActorFrom(ctx))
+}
+
+func TestWithClient_ScopesOrders(t *testing.T) {
+	ctx := WithClient(context.Background(), Client{APIKeyID: "k1", Staff: true})
+	assert.Equal(t, repository.Unrestricted, repository.ScopeFrom(ctx))
+
+	ctx = WithClient(context.Background(), Client{Subject: "alice", CustomerID: 7})
+	assert.Equal(t, repository.Scope{CustomerID: 7}, repository.ScopeFrom(ctx))
+
+	// Neither staff nor a customer: the scope matches no orders.
+	ctx = WithClient(context.Background(), Client{Subject: "bob"})
+	assert.Equal(t, repository.Scope{}, repository.ScopeFrom(ctx))
+	assert.True(t, repository.ScopeFrom(ctx).Restricted())
+}
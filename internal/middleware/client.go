@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/corradoisidoro/orders-api/internal/jwt"
+	"github.com/corradoisidoro/orders-api/internal/logging"
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// Client identifies the authenticated caller of a request. The zero value
+// is an anonymous caller.
+type Client struct {
+	APIKeyID   string       // the API key used, never the secret itself
+	Subject    string       // the subject of the JWT used
+	Claims     jwt.Claims   // all claims of the JWT used
+	CustomerID int64        // the customer the caller acts for, if any
+	Staff      bool         // staff may access every customer's orders
+	Scopes     model.Scopes // what the caller may do
+}
+
+// Authenticated reports whether the caller presented valid credentials.
+func (c Client) Authenticated() bool {
+	return c.APIKeyID != "" || c.Subject != ""
+}
+
+// String identifies the caller for logs and bookkeeping, such as
+// "api_key:3f9c0a1b2d4e5f60" or "jwt:alice"; it is "" for anonymous callers.
+func (c Client) String() string {
+	switch {
+	case c.APIKeyID != "":
+		return "api_key:" + c.APIKeyID
+	case c.Subject != "":
+		return "jwt:" + c.Subject
+	}
+	return ""
+}
+
+type clientContextKey struct{}
+
+// WithClient returns a copy of ctx carrying c. ctx also scopes the order
+// repository (see repository.Scope): to every order if c is staff, otherwise
+// to c's customer, and to no orders if c has none.
+// Order changes made with ctx are attributed to c and the request in the
+// order history, and records logged for the request name c as their caller.
+func WithClient(ctx context.Context, c Client) context.Context {
+	scope := repository.Scope{CustomerID: c.CustomerID}
+	if c.Staff {
+		scope = repository.Unrestricted
+	}
+	ctx = repository.WithScope(ctx, scope)
+	ctx = repository.WithActor(ctx, repository.Actor{Name: c.String(), RequestID: chimw.GetReqID(ctx)})
+	logging.AddField(ctx, "caller", c.String())
+	return context.WithValue(ctx, clientContextKey{}, c)
+}
+
+// ClientFrom returns the client stored in ctx by WithClient.
+func ClientFrom(ctx context.Context) Client {
+	c, _ := ctx.Value(clientContextKey{}).(Client)
+	return c
+}
@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// IdempotencyHeader is the request header carrying the client's key.
+const IdempotencyHeader = "Idempotency-Key"
+
+const (
+	maxIdempotencyKeyLength = 255
+	maxIdempotentBodyBytes  = 1 << 20
+)
+
+// IdempotencyStore persists idempotency keys and the responses they produced.
+type IdempotencyStore interface {
+	// Reserve claims rec.Key. If the key is already held, the existing record
+	// is returned and reserved is false.
+	Reserve(ctx context.Context, rec model.IdempotencyKey) (existing model.IdempotencyKey, reserved bool, err error)
+	// Complete stores the response produced for key, with its Content-Type
+	// and ETag headers.
+	Complete(ctx context.Context, key string, status int, contentType, etag string, body []byte) error
+	// Release forgets key so the request may be retried.
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyMiddleware makes requests carrying an Idempotency-Key header
+// safe to retry. The first request with a key runs normally and its response
+// is stored for ttl; a retry with the same body gets the stored response
+// back, with its Content-Type and ETag, and reusing the key for a different
+// request is rejected with 422. Requests without the header are passed
+// through untouched.
+func IdempotencyMiddleware(store IdempotencyStore, ttl time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				writeJSONError(w, http.StatusBadRequest, "Idempotency-Key is too long")
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxIdempotentBodyBytes))
+			if err != nil {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := fingerprint(r.Method, r.URL.Path, ClientFrom(r.Context()).String(), body)
+			now := time.Now().UTC()
+			existing, reserved, err := store.Reserve(r.Context(), model.IdempotencyKey{
+				Key:         key,
+				Method:      r.Method,
+				Path:        r.URL.Path,
+				RequestHash: hash,
+				CreatedAt:   now,
+				ExpiresAt:   now.Add(ttl),
+			})
+			if err != nil {
+				slog.ErrorContext(r.Context(), "idempotency: reserve key failed", "idempotency_key", key, "error", err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to process Idempotency-Key")
+				return
+			}
+
+			if !reserved {
+				replay(w, existing, hash)
+				return
+			}
+
+			rec := &capturingWriter{ResponseWriter: w, status: http.StatusOK}
+			completed := false
+			defer func() {
+				// Free the key if the handler panicked or failed on our side,
+				// so the client can retry.
+				if !completed {
+					if err := store.Release(context.WithoutCancel(r.Context()), key); err != nil {
+						slog.ErrorContext(r.Context(), "idempotency: release key failed", "idempotency_key", key, "error", err)
+					}
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if rec.status >= http.StatusInternalServerError {
+				return
+			}
+
+			err = store.Complete(context.WithoutCancel(r.Context()), key, rec.status,
+				rec.Header().Get("Content-Type"), rec.Header().Get("ETag"), rec.body.Bytes())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "idempotency: complete key failed", "idempotency_key", key, "error", err)
+				return
+			}
+			completed = true
+		})
+	}
+}
+
+// replay answers a request whose key is already held by existing.
+func replay(w http.ResponseWriter, existing model.IdempotencyKey, hash string) {
+	switch {
+	case existing.RequestHash != hash:
+		writeJSONError(w, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+	case existing.InFlight():
+		writeJSONError(w, http.StatusConflict, "a request with this Idempotency-Key is still in progress")
+	default:
+		if existing.ContentType != "" {
+			w.Header().Set("Content-Type", existing.ContentType)
+		}
+		if existing.ETag != "" {
+			w.Header().Set("ETag", existing.ETag)
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(existing.StatusCode)
+		_, _ = w.Write(existing.Body)
+	}
+}
+
+// fingerprint identifies a request by method, path, caller and body, so a
+// key reused by another caller is rejected rather than replaying a response
+// that caller may not see.
+func fingerprint(method, path, caller string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{0})
+	h.Write([]byte(path))
+	h.Write([]byte{0})
+	h.Write([]byte(caller))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// capturingWriter forwards a response while keeping a copy of its status and
+// body.
+type capturingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (c *capturingWriter) WriteHeader(status int) {
+	if !c.wroteHeader {
+		c.status = status
+		c.wroteHeader = true
+	}
+	c.ResponseWriter.WriteHeader(status)
+}
+
+func (c *capturingWriter) Write(b []byte) (int, error) {
+	c.wroteHeader = true
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
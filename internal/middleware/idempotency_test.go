@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type memIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[string]model.IdempotencyKey
+}
+
+func newMemIdempotencyStore() *memIdempotencyStore {
+	return &memIdempotencyStore{keys: make(map[string]model.IdempotencyKey)}
+}
+
+func (s *memIdempotencyStore) Reserve(ctx context.Context, rec model.IdempotencyKey) (model.IdempotencyKey, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, ok := s.keys[rec.Key]; ok {
+		return existing, false, nil
+	}
+	s.keys[rec.Key] = rec
+	return rec, true, nil
+}
+
+func (s *memIdempotencyStore) Complete(ctx context.Context, key string, status int, contentType, etag string, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec := s.keys[key]
+	rec.StatusCode, rec.ContentType, rec.ETag, rec.Body = status, contentType, etag, body
+	s.keys[key] = rec
+	return nil
+}
+
+func (s *memIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.keys, key)
+	return nil
+}
+
+// countingHandler answers 201 with a body naming how many times it ran.
+func countingHandler(calls *int, status int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*calls++
+		_, _ = io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", `"1"`)
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"call":` + strconv.Itoa(*calls) + `}`))
+	})
+}
+
+func newIdempotentReq(key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(IdempotencyHeader, key)
+	}
+	return req
+}
+
+func TestIdempotency_ReplaysOriginalResponse(t *testing.T) {
+	var calls int
+	handler := IdempotencyMiddleware(newMemIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	rr1 := httptest.NewRecorder()
+	handler.ServeHTTP(rr1, newIdempotentReq("k1", `{"customer_id":"1"}`))
+
+	rr2 := httptest.NewRecorder()
+	handler.ServeHTTP(rr2, newIdempotentReq("k1", `{"customer_id":"1"}`))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusCreated, rr2.Code)
+	assert.Equal(t, rr1.Body.String(), rr2.Body.String())
+	assert.Equal(t, "application/json", rr2.Header().Get("Content-Type"))
+	assert.Equal(t, `"1"`, rr2.Header().Get("ETag"))
+	assert.Equal(t, "true", rr2.Header().Get("Idempotent-Replayed"))
+}
+
+func TestIdempotency_RejectsDifferentBody(t *testing.T) {
+	var calls int
+	handler := IdempotencyMiddleware(newMemIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newIdempotentReq("k1", `{"customer_id":"1"}`))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newIdempotentReq("k1", `{"customer_id":"2"}`))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.JSONEq(t, `{"error":"Idempotency-Key was already used for a different request"}`, rr.Body.String())
+}
+
+func TestIdempotency_RejectsOtherCaller(t *testing.T) {
+	var calls int
+	handler := IdempotencyMiddleware(newMemIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	asCustomer := func(id int64) *http.Request {
+		req := newIdempotentReq("k1", `{"customer_id":"1"}`)
+		return req.WithContext(WithClient(req.Context(), Client{Subject: "user-" + strconv.FormatInt(id, 10), CustomerID: id}))
+	}
+
+	handler.ServeHTTP(httptest.NewRecorder(), asCustomer(1))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, asCustomer(2))
+
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+}
+
+func TestIdempotency_InFlightConflict(t *testing.T) {
+	store := newMemIdempotencyStore()
+	_, _, err := store.Reserve(context.Background(), model.IdempotencyKey{
+		Key:         "k1",
+		RequestHash: fingerprint(http.MethodPost, "/orders", "", []byte("{}")),
+	})
+	require.NoError(t, err)
+
+	var calls int
+	handler := IdempotencyMiddleware(store, time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newIdempotentReq("k1", "{}"))
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+}
+
+func TestIdempotency_ServerErrorReleasesKey(t *testing.T) {
+	store := newMemIdempotencyStore()
+
+	var calls int
+	handler := IdempotencyMiddleware(store, time.Hour)(countingHandler(&calls, http.StatusInternalServerError))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newIdempotentReq("k1", "{}"))
+	handler.ServeHTTP(httptest.NewRecorder(), newIdempotentReq("k1", "{}"))
+
+	assert.Equal(t, 2, calls)
+	assert.Empty(t, store.keys)
+}
+
+func TestIdempotency_PassesThroughWithoutHeader(t *testing.T) {
+	var calls int
+	handler := IdempotencyMiddleware(newMemIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	handler.ServeHTTP(httptest.NewRecorder(), newIdempotentReq("", "{}"))
+	handler.ServeHTTP(httptest.NewRecorder(), newIdempotentReq("", "{}"))
+
+	assert.Equal(t, 2, calls)
+}
+
+func TestIdempotency_KeyTooLong(t *testing.T) {
+	var calls int
+	handler := IdempotencyMiddleware(newMemIdempotencyStore(), time.Hour)(countingHandler(&calls, http.StatusCreated))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newIdempotentReq(strings.Repeat("k", 256), "{}"))
+
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+}
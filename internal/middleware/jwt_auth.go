@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+
+	"github.com/corradoisidoro/orders-api/internal/apikey"
+	"github.com/corradoisidoro/orders-api/internal/jwt"
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// TokenVerifier verifies JWTs; *jwt.Verifier implements it.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (jwt.Claims, error)
+}
+
+// JWTAuthMiddleware authenticates requests carrying a JWT in an
+// "Authorization: Bearer" header and stores the caller, with its subject,
+// claims, scopes and customer, in the request context (see ClientFrom). It
+// runs after APIKeyAuthMiddleware: requests already authenticated, without a
+// bearer token, or with an API key pass through. Requests with a token that
+// fails verification are rejected with 401.
+func JWTAuthMiddleware(verifier TokenVerifier) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, ok := bearerToken(r.Header.Get("Authorization"))
+			if !ok || apikey.IsToken(token) || ClientFrom(r.Context()).Authenticated() {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			claims, err := verifier.Verify(r.Context(), token)
+			if err != nil {
+				if isTokenError(err) {
+					unauthorized(w, "invalid token")
+					return
+				}
+				slog.ErrorContext(r.Context(), "auth: verify JWT failed", "error", err)
+				writeJSONError(w, http.StatusInternalServerError, "failed to authenticate")
+				return
+			}
+
+			ctx := WithClient(r.Context(), jwtClient(claims))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Claims that identify what a JWT caller may access.
+const (
+	rolesClaim      = "roles"       // list of roles
+	customerIDClaim = "customer_id" // the customer a non-staff user acts for
+	staffRole       = "staff"       // role granting access to every customer
+)
+
+// jwtClient returns the caller described by claims. Staff users keep full
+// access; other users act for the customer in their customer_id claim. A
+// user that is neither gets no scopes, so every order route rejects them.
+func jwtClient(claims jwt.Claims) Client {
+	c := Client{
+		Subject: claims.Subject,
+		Claims:  claims,
+		Staff:   slices.Contains(claims.Strings(rolesClaim), staffRole),
+	}
+
+	if !c.Staff {
+		c.CustomerID = customerIDFrom(claims)
+		if c.CustomerID == 0 {
+			return c
+		}
+	}
+
+	c.Scopes = scopesFrom(claims)
+	return c
+}
+
+// customerIDFrom returns the positive customer ID in claims, given as a
+// number or a numeric string, or 0.
+func customerIDFrom(claims jwt.Claims) int64 {
+	var s string
+	switch v := claims.Raw[customerIDClaim].(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	}
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id < 1 {
+		return 0
+	}
+	return id
+}
+
+// isTokenError reports whether err is the token's fault rather than, say, a
+// failure to fetch the JWKS.
+func isTokenError(err error) bool {
+	for _, target := range []error{
+		jwt.ErrMalformed,
+		jwt.ErrUnsupportedAlgorithm,
+		jwt.ErrUnknownKey,
+		jwt.ErrInvalidSignature,
+		jwt.ErrExpired,
+		jwt.ErrNotYetValid,
+		jwt.ErrInvalidClaims,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// scopesFrom returns the known scopes granted by claims; others are ignored.
+func scopesFrom(claims jwt.Claims) model.Scopes {
+	var scopes model.Scopes
+	for _, s := range claims.Scopes() {
+		if scope := model.Scope(s); scope.Valid() {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
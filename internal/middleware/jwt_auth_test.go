@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/jwt"
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestVerifier returns a verifier trusting a locally generated P-256 key
+// and a function signing ES256 tokens with it.
+func newTestVerifier(t *testing.T) (*jwt.Verifier, func(claims map[string]any) string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	b64 := base64.RawURLEncoding.EncodeToString
+	x, y := make([]byte, 32), make([]byte, 32)
+	key.X.FillBytes(x)
+	key.Y.FillBytes(y)
+
+	keys, err := jwt.ParseJWKS(fmt.Appendf(nil,
+		`{"keys":[{"kty":"EC","kid":"k1","crv":"P-256","x":%q,"y":%q}]}`, b64(x), b64(y)))
+	require.NoError(t, err)
+
+	sign := func(claims map[string]any) string {
+		payload, err := json.Marshal(claims)
+		require.NoError(t, err)
+
+		input := b64([]byte(`{"alg":"ES256","kid":"k1"}`)) + "." + b64(payload)
+		digest := sha256.Sum256([]byte(input))
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		require.NoError(t, err)
+
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return input + "." + b64(sig)
+	}
+
+	return &jwt.Verifier{Keys: keys, Issuer: "https://sso.example.com/", Audience: "orders-api"}, sign
+}
+
+func testClaims() map[string]any {
+	return map[string]any{
+		"iss":         "https://sso.example.com/",
+		"aud":         "orders-api",
+		"sub":         "alice",
+		"exp":         time.Now().Add(time.Hour).Unix(),
+		"scope":       "orders:read openid",
+		"email":       "alice@example.com",
+		"customer_id": "42",
+	}
+}
+
+func TestJWTAuth_StoresClient(t *testing.T) {
+	verifier, sign := newTestVerifier(t)
+
+	var got Client
+	handler := JWTAuthMiddleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientFrom(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, authRequest(sign(testClaims())))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.True(t, got.Authenticated())
+	assert.Equal(t, "alice", got.Subject)
+	assert.Equal(t, "alice@example.com", got.Claims.Raw["email"])
+	assert.Equal(t, model.Scopes{model.ScopeOrdersRead}, got.Scopes, "unknown scopes are dropped")
+	assert.Equal(t, int64(42), got.CustomerID)
+	assert.False(t, got.Staff)
+}
+
+func TestJWTAuth_CustomersAndStaff(t *testing.T) {
+	verifier, sign := newTestVerifier(t)
+
+	var got Client
+	var scope repository.Scope
+	handler := JWTAuthMiddleware(verifier)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ClientFrom(r.Context())
+		scope = repository.ScopeFrom(r.Context())
+	}))
+
+	serve := func(mutate func(c map[string]any)) {
+		claims := testClaims()
+		mutate(claims)
+		handler.ServeHTTP(httptest.NewRecorder(), authRequest(sign(claims)))
+	}
+
+	serve(func(c map[string]any) { c["customer_id"] = 7 })
+	assert.Equal(t, repository.Scope{CustomerID: 7}, scope)
+	assert.NotEmpty(t, got.Scopes)
+
+	serve(func(c map[string]any) { c["roles"] = []string{"staff"}; delete(c, "customer_id") })
+	assert.True(t, got.Staff)
+	assert.False(t, scope.Restricted())
+	assert.NotEmpty(t, got.Scopes)
+
+	// Neither staff nor bound to a customer: authenticated, but may do nothing.
+	serve(func(c map[string]any) { delete(c, "customer_id") })
+	assert.True(t, got.Authenticated())
+	assert.Empty(t, got.Scopes)
+}
+
+func TestJWTAuth_RejectsInvalidTokens(t *testing.T) {
+	verifier, sign := newTestVerifier(t)
+	_, otherSign := newTestVerifier(t)
+
+	expired := testClaims()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+
+	handler := JWTAuthMiddleware(verifier)(okHandler())
+
+	for name, token := range map[string]string{
+		"garbage":     "nonsense",
+		"expired":     sign(expired),
+		"foreign key": otherSign(testClaims()),
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, authRequest(token))
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, name)
+		assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"), name)
+	}
+}
+
+func TestJWTAuth_PassesThrough(t *testing.T) {
+	verifier, _ := newTestVerifier(t)
+	handler := JWTAuthMiddleware(verifier)(okHandler())
+
+	for name, req := range map[string]*http.Request{
+		"anonymous": authRequest(""),
+		"API key":   authRequest("oak_0123456789abcdef_secret"),
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, name)
+	}
+}
+
+type failingVerifier struct{}
+
+func (failingVerifier) Verify(context.Context, string) (jwt.Claims, error) {
+	return jwt.Claims{}, errors.New("JWKS unreachable")
+}
+
+func TestJWTAuth_VerifierFailure(t *testing.T) {
+	handler := JWTAuthMiddleware(failingVerifier{})(okHandler())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, authRequest("a.b.c"))
+
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
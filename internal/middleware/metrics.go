@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// unmatchedRoute labels requests that match no route, so that arbitrary
+// paths do not each create a series.
+const unmatchedRoute = "unmatched"
+
+// Metrics counts requests and records their latency by route pattern,
+// method and status. Requests answered before routing, such as rate limited
+// ones, are labelled with the pattern route reports for them; route may be
+// nil. It should run before chimw.Recoverer so that panics count as 500s.
+func Metrics(route func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+
+			defer func() {
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				pattern := matchedRoute(r, route)
+				if pattern == "" {
+					pattern = unmatchedRoute
+				}
+				labels := []string{pattern, r.Method, strconv.Itoa(status)}
+
+				metrics.HTTPRequests.WithLabelValues(labels...).Inc()
+				metrics.HTTPRequestDuration.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+			}()
+
+			next.ServeHTTP(ww, r)
+		})
+	}
+}
+
+// matchedRoute returns the pattern of the route that served r, asking route
+// if r was answered before routing, or "" if no route matches.
+func matchedRoute(r *http.Request, route func(*http.Request) string) string {
+	var pattern string
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		pattern = rctx.RoutePattern()
+	}
+	if pattern == "" && route != nil {
+		pattern = route(r)
+	}
+	return pattern
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_LabelsByRoutePattern(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(Metrics(nil))
+	r.Get("/widgets/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+	})
+	r.Get("/quiet", func(w http.ResponseWriter, r *http.Request) {})
+
+	served := metrics.HTTPRequests.WithLabelValues("/widgets/{id}", http.MethodGet, "202")
+	quiet := metrics.HTTPRequests.WithLabelValues("/quiet", http.MethodGet, "200")
+	unmatched := metrics.HTTPRequests.WithLabelValues("unmatched", http.MethodGet, "404")
+	before := []float64{testutil.ToFloat64(served), testutil.ToFloat64(quiet), testutil.ToFloat64(unmatched)}
+
+	for _, path := range []string{"/widgets/1", "/widgets/2", "/quiet", "/nope"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	assert.Equal(t, before[0]+2, testutil.ToFloat64(served))
+	assert.Equal(t, before[1]+1, testutil.ToFloat64(quiet), "no status written means 200")
+	assert.Equal(t, before[2]+1, testutil.ToFloat64(unmatched))
+}
+
+func TestMetrics_FallsBackToRouteFunc(t *testing.T) {
+	reject := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTooManyRequests)
+		})
+	}
+
+	r := chi.NewRouter()
+	r.Use(Metrics(func(*http.Request) string { return "/limited" }))
+	r.Use(reject)
+	r.Get("/limited", func(w http.ResponseWriter, r *http.Request) {})
+
+	limited := metrics.HTTPRequests.WithLabelValues("/limited", http.MethodGet, "429")
+	before := testutil.ToFloat64(limited)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/limited", nil))
+
+	assert.Equal(t, before+1, testutil.ToFloat64(limited))
+}
@@ -1,61 +1,85 @@
 package middleware
 
 import (
+	"log/slog"
+	"math"
 	"net"
 	"net/http"
-	"sync"
+	"strconv"
 	"time"
-)
-
-type clientBucket struct {
-	Requests int
-	ResetAt  time.Time
-}
 
-var (
-	buckets = make(map[string]*clientBucket)
-	mu      sync.RWMutex
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/ratelimit"
 )
 
-func RateLimitMiddleware(maxRequests int, windowSecs int) func(http.Handler) http.Handler {
-	if windowSecs < 1 {
-		windowSecs = 1
-	}
-
+// RateLimitMiddleware limits requests according to the first of policies
+// that matches them, counting them per client with limiter. route returns
+// the route pattern a request will be served by; it may be nil if policies
+// do not match on routes. The caller's API key and customer are read from
+// the request context (see WithClient).
+//
+// Every limited response carries the RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers; rejected requests get 429 Too Many Requests
+// with Retry-After and are counted in metrics.RateLimitRejections. Requests
+// no policy matches, and requests matching an exempt policy, are not
+// limited. If the limiter fails, the request is let through rather than
+// turning a limiter outage into an API outage.
+func RateLimitMiddleware(limiter ratelimit.Limiter, policies ratelimit.Policies, route func(*http.Request) string) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-
 			ip, _, err := net.SplitHostPort(r.RemoteAddr)
 			if err != nil {
 				ip = r.RemoteAddr
 			}
 
-			now := time.Now()
+			client := ClientFrom(r.Context())
+			req := ratelimit.Request{
+				Method:     r.Method,
+				IP:         ip,
+				APIKey:     client.APIKeyID,
+				CustomerID: client.CustomerID,
+			}
+			if route != nil {
+				req.Route = route(r)
+			}
 
-			mu.RLock()
-			bucket, exists := buckets[ip]
-			mu.RUnlock()
+			policy, key, ok := policies.Resolve(req)
+			if !ok || policy.Exempt {
+				next.ServeHTTP(w, r)
+				return
+			}
 
-			if !exists || now.After(bucket.ResetAt) {
-				mu.Lock()
-				bucket = &clientBucket{
-					Requests: 0,
-					ResetAt:  now.Add(time.Duration(windowSecs) * time.Second),
-				}
-				buckets[ip] = bucket
-				mu.Unlock()
+			d, err := limiter.Allow(r.Context(), key, policy.Limit())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "rate limit: limiter failed; allowing request", "error", err)
+				next.ServeHTTP(w, r)
+				return
 			}
 
-			mu.Lock()
-			if bucket.Requests >= maxRequests {
-				mu.Unlock()
-				http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			writeRateLimitHeaders(w, d, time.Now())
+
+			if !d.Allowed {
+				metrics.RateLimitRejections.WithLabelValues(policy.Name).Inc()
+				w.Header().Set("Retry-After", strconv.FormatInt(ceilSeconds(d.RetryAfter), 10))
+				writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
 				return
 			}
-			bucket.Requests++
-			mu.Unlock()
 
 			next.ServeHTTP(w, r)
 		})
 	}
 }
+
+// writeRateLimitHeaders describes d in the RateLimit-* headers of the IETF
+// "RateLimit header fields for HTTP" draft. RateLimit-Reset is in seconds.
+func writeRateLimitHeaders(w http.ResponseWriter, d ratelimit.Decision, now time.Time) {
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", strconv.FormatInt(max(0, ceilSeconds(d.ResetAt.Sub(now))), 10))
+}
+
+// ceilSeconds rounds d up to whole seconds.
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
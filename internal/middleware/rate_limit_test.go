@@ -1,21 +1,19 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/ratelimit"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 )
 
-func resetBuckets(t *testing.T) {
-	t.Helper()
-	mu.Lock()
-	buckets = make(map[string]*clientBucket)
-	mu.Unlock()
-}
-
 func newReqWithIP(ip string) *http.Request {
 	req := httptest.NewRequest("GET", "/", nil)
 	req.RemoteAddr = ip
@@ -28,22 +26,34 @@ func okHandler() http.Handler {
 	})
 }
 
-func TestRateLimit_AllowsFirstRequest(t *testing.T) {
-	resetBuckets(t)
+// ipPolicy limits every request per IP.
+func ipPolicy(requests int, window time.Duration) ratelimit.Policies {
+	return ratelimit.Policies{{Name: "test", Requests: requests, WindowSecs: int(window / time.Second)}}
+}
 
-	handler := RateLimitMiddleware(2, 10)(okHandler())
+type limiterFunc func(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error)
+
+func (f limiterFunc) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error) {
+	return f(ctx, key, limit)
+}
+
+func TestRateLimit_AllowsFirstRequest(t *testing.T) {
+	handler := RateLimitMiddleware(ratelimit.NewTokenBucket(0), ipPolicy(2, 10*time.Second), nil)(okHandler())
 	rr := httptest.NewRecorder()
 	req := newReqWithIP("1.2.3.4:1234")
 
 	handler.ServeHTTP(rr, req)
 
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", rr.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "5", rr.Header().Get("RateLimit-Reset"))
+	assert.Empty(t, rr.Header().Get("Retry-After"))
 }
 
 func TestRateLimit_BlocksAfterLimit(t *testing.T) {
-	resetBuckets(t)
-
-	handler := RateLimitMiddleware(1, 10)(okHandler())
+	handler := RateLimitMiddleware(ratelimit.NewTokenBucket(0), ipPolicy(1, 10*time.Second), nil)(okHandler())
+	rejected := testutil.ToFloat64(metrics.RateLimitRejections.WithLabelValues("test"))
 
 	rr1 := httptest.NewRecorder()
 	handler.ServeHTTP(rr1, newReqWithIP("5.6.7.8:1111"))
@@ -52,12 +62,14 @@ func TestRateLimit_BlocksAfterLimit(t *testing.T) {
 	handler.ServeHTTP(rr2, newReqWithIP("5.6.7.8:1111"))
 
 	assert.Equal(t, http.StatusTooManyRequests, rr2.Code)
+	assert.Equal(t, "0", rr2.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "10", rr2.Header().Get("Retry-After"))
+	assert.JSONEq(t, `{"error":"rate limit exceeded"}`, rr2.Body.String())
+	assert.Equal(t, rejected+1, testutil.ToFloat64(metrics.RateLimitRejections.WithLabelValues("test")))
 }
 
 func TestRateLimit_SeparateBucketsPerIP(t *testing.T) {
-	resetBuckets(t)
-
-	handler := RateLimitMiddleware(1, 10)(okHandler())
+	handler := RateLimitMiddleware(ratelimit.NewTokenBucket(0), ipPolicy(1, 10*time.Second), nil)(okHandler())
 
 	rr1 := httptest.NewRecorder()
 	handler.ServeHTTP(rr1, newReqWithIP("10.0.0.1:1111"))
@@ -69,10 +81,21 @@ func TestRateLimit_SeparateBucketsPerIP(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr2.Code)
 }
 
-func TestRateLimit_ResetsAfterWindow(t *testing.T) {
-	resetBuckets(t)
+func TestRateLimit_MiddlewaresDoNotShareState(t *testing.T) {
+	policies := ipPolicy(1, 10*time.Second)
+	first := RateLimitMiddleware(ratelimit.NewTokenBucket(0), policies, nil)(okHandler())
+	second := RateLimitMiddleware(ratelimit.NewTokenBucket(0), policies, nil)(okHandler())
+
+	first.ServeHTTP(httptest.NewRecorder(), newReqWithIP("10.0.0.3:1111"))
+
+	rr := httptest.NewRecorder()
+	second.ServeHTTP(rr, newReqWithIP("10.0.0.3:1111"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
 
-	handler := RateLimitMiddleware(1, 1)(okHandler())
+func TestRateLimit_ResetsAfterWindow(t *testing.T) {
+	handler := RateLimitMiddleware(ratelimit.NewTokenBucket(0), ipPolicy(1, time.Second), nil)(okHandler())
 
 	rr1 := httptest.NewRecorder()
 	handler.ServeHTTP(rr1, newReqWithIP("9.9.9.9:1111"))
@@ -84,3 +107,71 @@ func TestRateLimit_ResetsAfterWindow(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, rr2.Code)
 }
+
+func TestRateLimit_LetsRequestsThroughWhenLimiterFails(t *testing.T) {
+	failing := limiterFunc(func(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error) {
+		return ratelimit.Decision{}, errors.New("db down")
+	})
+	handler := RateLimitMiddleware(failing, ipPolicy(1, time.Second), nil)(okHandler())
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newReqWithIP("9.9.9.9:1111"))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimit_ResolvesPolicyPerRequest(t *testing.T) {
+	policies := append(ratelimit.Policies{
+		{Name: "partners", Client: ratelimit.ClientAPIKey, Requests: 3, WindowSecs: 60},
+		{Name: "writes", Methods: []string{http.MethodPost}, Routes: []string{"/orders/*"}, Requests: 1, WindowSecs: 60},
+	}, ratelimit.DefaultPolicies(2, 60)...)
+
+	var keys []string
+	limiter := ratelimit.NewTokenBucket(0)
+	recording := limiterFunc(func(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error) {
+		keys = append(keys, key)
+		return limiter.Allow(ctx, key, limit)
+	})
+
+	route := func(r *http.Request) string {
+		if r.URL.Path == "/" {
+			return "/"
+		}
+		return "/orders/"
+	}
+	handler := RateLimitMiddleware(recording, policies, route)(okHandler())
+
+	serve := func(method, path string, client Client) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.RemoteAddr = "7.7.7.7:1000"
+		req = req.WithContext(WithClient(req.Context(), client))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Health checks are exempt and carry no headers.
+	for range 5 {
+		rr := serve(http.MethodGet, "/", Client{})
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Empty(t, rr.Header().Get("RateLimit-Limit"))
+	}
+
+	// Anonymous writes get the write policy, reads the default one.
+	assert.Equal(t, "1", serve(http.MethodPost, "/orders/", Client{}).Header().Get("RateLimit-Limit"))
+	assert.Equal(t, http.StatusTooManyRequests, serve(http.MethodPost, "/orders/", Client{}).Code)
+	assert.Equal(t, "2", serve(http.MethodGet, "/orders/", Client{}).Header().Get("RateLimit-Limit"))
+
+	// API keys have their own, larger quota.
+	rr := serve(http.MethodPost, "/orders/", Client{APIKeyID: "key-1"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "3", rr.Header().Get("RateLimit-Limit"))
+
+	assert.Equal(t, []string{
+		"writes:ip:7.7.7.7",
+		"writes:ip:7.7.7.7",
+		"default:ip:7.7.7.7",
+		"partners:api_key:key-1",
+	}, keys)
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/logging"
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+)
+
+// RequestLogger logs one record per request once it has been served, and
+// makes every record logged with the request's context, in handlers and
+// repositories alike, carry the request ID, method, route pattern, caller,
+// latency so far and, once written, the response status. It must run after
+// chimw.RequestID.
+func RequestLogger(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+
+		ctx, fields := logging.WithFields(r.Context())
+		fields.Set("request_id", chimw.GetReqID(ctx))
+		fields.Set("method", r.Method)
+		fields.Set("route", routeValue{r})
+		fields.Set("status", statusValue{ww})
+		fields.Set("latency_ms", latencyValue(start))
+
+		defer func() {
+			level := slog.LevelInfo
+			if ww.Status() >= http.StatusInternalServerError {
+				level = slog.LevelError
+			}
+			slog.LogAttrs(ctx, level, "request completed",
+				slog.String("path", r.URL.Path),
+				slog.Int("bytes", ww.BytesWritten()),
+			)
+		}()
+
+		next.ServeHTTP(ww, r.WithContext(ctx))
+	})
+}
+
+// routeValue logs the chi route pattern of a request, which is only known
+// once routing is done.
+type routeValue struct{ r *http.Request }
+
+func (v routeValue) LogValue() slog.Value {
+	if rctx := chi.RouteContext(v.r.Context()); rctx != nil {
+		return slog.StringValue(rctx.RoutePattern())
+	}
+	return slog.StringValue("")
+}
+
+// statusValue logs the response status, or 0 while none has been written.
+type statusValue struct{ w chimw.WrapResponseWriter }
+
+func (v statusValue) LogValue() slog.Value {
+	return slog.IntValue(v.w.Status())
+}
+
+// latencyValue logs the milliseconds elapsed since it started.
+type latencyValue time.Time
+
+func (v latencyValue) LogValue() slog.Value {
+	return slog.Float64Value(float64(time.Since(time.Time(v)).Microseconds()) / 1000)
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/logging"
+	"github.com/go-chi/chi/v5"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs makes the default logger write JSON to the returned buffer for
+// the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(logging.New(&buf, slog.LevelDebug))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &buf
+}
+
+func TestRequestLogger_CorrelatesRecords(t *testing.T) {
+	logs := captureLogs(t)
+
+	r := chi.NewRouter()
+	r.Use(chimw.RequestID)
+	r.Use(RequestLogger)
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := WithClient(r.Context(), Client{APIKeyID: "k1", Staff: true})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+	r.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		slog.WarnContext(r.Context(), "from handler")
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/7", nil)
+	req.Header.Set(chimw.RequestIDHeader, "req-42")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var records []map[string]any
+	dec := json.NewDecoder(logs)
+	for dec.More() {
+		var rec map[string]any
+		require.NoError(t, dec.Decode(&rec))
+		records = append(records, rec)
+	}
+	require.Len(t, records, 2)
+
+	for _, rec := range records {
+		assert.Equal(t, "req-42", rec["request_id"])
+		assert.Equal(t, http.MethodGet, rec["method"])
+		assert.Equal(t, "/orders/{id}", rec["route"])
+		assert.Equal(t, "api_key:k1", rec["caller"])
+		assert.Contains(t, rec, "latency_ms")
+	}
+
+	assert.Equal(t, "from handler", records[0]["msg"])
+	assert.EqualValues(t, 0, records[0]["status"], "nothing written yet")
+
+	assert.Equal(t, "request completed", records[1]["msg"])
+	assert.EqualValues(t, http.StatusTeapot, records[1]["status"])
+	assert.Equal(t, "/orders/7", records[1]["path"])
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/corradoisidoro/orders-api/internal/logging"
+	"github.com/corradoisidoro/orders-api/internal/tracing"
+	chimw "github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for each request with tp, continuing the
+// trace of an incoming W3C traceparent header. Once the request is served
+// the span is named after its method and route pattern, such as
+// "GET /orders/{id}", using route for requests answered before routing;
+// route may be nil. The trace ID is added to the request's log fields, so
+// it must run after RequestLogger.
+func Tracing(tp trace.TracerProvider, route func(*http.Request) string) func(http.Handler) http.Handler {
+	tracer := tp.Tracer(tracing.TracerName)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := tracing.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+				),
+			)
+			defer span.End()
+
+			if sc := span.SpanContext(); sc.HasTraceID() {
+				logging.AddField(ctx, "trace_id", sc.TraceID().String())
+			}
+
+			ww := chimw.NewWrapResponseWriter(w, r.ProtoMajor)
+			r = r.WithContext(ctx)
+			next.ServeHTTP(ww, r)
+
+			if pattern := matchedRoute(r, route); pattern != "" {
+				span.SetName(r.Method + " " + pattern)
+				span.SetAttributes(semconv.HTTPRoute(pattern))
+			}
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCode(status))
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
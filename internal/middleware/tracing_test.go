@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTracedRouter(t *testing.T, status int) (*chi.Mux, *tracetest.InMemoryExporter) {
+	t.Helper()
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+	r := chi.NewRouter()
+	r.Use(RequestLogger)
+	r.Use(Tracing(tp, nil))
+	r.Get("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		slog.InfoContext(r.Context(), "in handler")
+		w.WriteHeader(status)
+	})
+	return r, exp
+}
+
+func TestTracing_ContinuesIncomingTrace(t *testing.T) {
+	logs := captureLogs(t)
+	r, exp := newTracedRouter(t, http.StatusOK)
+
+	req := httptest.NewRequest(http.MethodGet, "/orders/7", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 1)
+	span := spans[0]
+
+	assert.Equal(t, "GET /orders/{id}", span.Name)
+	assert.Equal(t, trace.SpanKindServer, span.SpanKind)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", span.SpanContext.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", span.Parent.SpanID().String())
+	assert.True(t, span.Parent.IsRemote())
+	assert.Contains(t, span.Attributes, attribute.String("http.route", "/orders/{id}"))
+	assert.Contains(t, span.Attributes, attribute.Int("http.response.status_code", http.StatusOK))
+	assert.Equal(t, codes.Unset, span.Status.Code)
+
+	assert.Contains(t, logs.String(), `"trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"`)
+}
+
+func TestTracing_StartsNewTraceAndFlagsServerErrors(t *testing.T) {
+	r, exp := newTracedRouter(t, http.StatusBadGateway)
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/orders/7", nil))
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 1)
+	assert.True(t, spans[0].SpanContext.HasTraceID())
+	assert.False(t, spans[0].Parent.IsValid())
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+}
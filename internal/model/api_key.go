@@ -0,0 +1,85 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Scope grants an API key access to a group of operations.
+type Scope string
+
+const (
+	ScopeOrdersRead   Scope = "orders:read"
+	ScopeOrdersWrite  Scope = "orders:write"
+	ScopeOrdersDelete Scope = "orders:delete"
+	ScopeWebhooks     Scope = "webhooks:manage"
+)
+
+// Valid reports whether s is a known scope.
+func (s Scope) Valid() bool {
+	switch s {
+	case ScopeOrdersRead, ScopeOrdersWrite, ScopeOrdersDelete, ScopeWebhooks:
+		return true
+	}
+	return false
+}
+
+// Scopes is a set of scopes, stored as a space-separated string.
+type Scopes []Scope
+
+// Has reports whether s contains scope.
+func (s Scopes) Has(scope Scope) bool {
+	return slices.Contains(s, scope)
+}
+
+func (s Scopes) String() string {
+	parts := make([]string, len(s))
+	for i, scope := range s {
+		parts[i] = string(scope)
+	}
+	return strings.Join(parts, " ")
+}
+
+// Value implements driver.Valuer.
+func (s Scopes) Value() (driver.Value, error) {
+	return s.String(), nil
+}
+
+// Scan implements sql.Scanner.
+func (s *Scopes) Scan(src any) error {
+	var str string
+	switch v := src.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("scan scopes: unsupported type %T", src)
+	}
+
+	*s = nil
+	for _, f := range strings.Fields(str) {
+		*s = append(*s, Scope(f))
+	}
+	return nil
+}
+
+// APIKey is a credential for calling the API. Only a hash of its secret is
+// stored; the secret itself is shown once, when the key is created.
+type APIKey struct {
+	KeyID      string     `gorm:"primaryKey;column:key_id;type:varchar(32)" json:"key_id"`
+	Name       string     `gorm:"type:varchar(255);not null" json:"name"`
+	SecretHash string     `gorm:"type:char(64);not null" json:"-"` // hex SHA-256 of the secret
+	Scopes     Scopes     `gorm:"type:varchar(255);not null" json:"scopes"`
+	CreatedAt  time.Time  `gorm:"not null" json:"created_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// Revoked reports whether the key has been revoked.
+func (k APIKey) Revoked() bool {
+	return k.RevokedAt != nil
+}
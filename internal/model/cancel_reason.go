@@ -0,0 +1,23 @@
+package model
+
+// CancelReason is a machine-readable code explaining why an order was cancelled.
+type CancelReason string
+
+const (
+	CancelReasonCustomerRequest CancelReason = "customer_request"
+	CancelReasonPaymentFailed   CancelReason = "payment_failed"
+	CancelReasonOutOfStock      CancelReason = "out_of_stock"
+	CancelReasonFraudSuspected  CancelReason = "fraud_suspected"
+	CancelReasonDuplicate       CancelReason = "duplicate_order"
+	CancelReasonOther           CancelReason = "other"
+)
+
+// Valid reports whether r is one of the known reason codes.
+func (r CancelReason) Valid() bool {
+	switch r {
+	case CancelReasonCustomerRequest, CancelReasonPaymentFailed, CancelReasonOutOfStock,
+		CancelReasonFraudSuspected, CancelReasonDuplicate, CancelReasonOther:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package model
+
+// Currency is an ISO 4217 alphabetic currency code such as "EUR" or "USD".
+type Currency string
+
+// Valid reports whether c is shaped like an ISO 4217 code: three upper-case
+// ASCII letters.
+func (c Currency) Valid() bool {
+	if len(c) != 3 {
+		return false
+	}
+	for i := 0; i < len(c); i++ {
+		if c[i] < 'A' || c[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"time"
+)
+
+// IdempotencyKey records the outcome of a request sent with an
+// Idempotency-Key header, so that retries can be answered with the original
+// response instead of being executed again.
+type IdempotencyKey struct {
+	Key         string    `gorm:"primaryKey;column:idempotency_key;type:varchar(255)"`
+	Method      string    `gorm:"type:varchar(16);not null"`
+	Path        string    `gorm:"not null"`
+	RequestHash string    `gorm:"type:char(64);not null"` // hex SHA-256 of method, path and body
+	StatusCode  int       `gorm:"not null;default:0"`     // 0 while the original request is in flight
+	ContentType string    `gorm:"type:varchar(255)"`
+	ETag        string    `gorm:"column:etag;type:varchar(255)"` // ETag header of the original response
+	Body        []byte    // response body of the original request
+	CreatedAt   time.Time `gorm:"not null"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+// InFlight reports whether the original request has not finished yet.
+func (k IdempotencyKey) InFlight() bool {
+	return k.StatusCode == 0
+}
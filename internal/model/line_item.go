@@ -1,8 +1,13 @@
 package model
 
 type LineItem struct {
-	ItemID   int64 `gorm:"primaryKey;autoIncrement" json:"item_id,string"`
-	OrderID  int64 `gorm:"column:order_id" json:"order_id"`
-	Quantity uint  `json:"quantity"`
-	Price    uint  `json:"price"`
+	ItemID      int64    `gorm:"primaryKey;autoIncrement" json:"item_id,string"`
+	OrderID     int64    `gorm:"column:order_id;index" json:"order_id"`
+	SKU         string   `gorm:"column:sku;type:varchar(64);index" json:"sku"`
+	ProductName string   `gorm:"type:varchar(255)" json:"product_name"`
+	Currency    Currency `gorm:"type:char(3)" json:"currency"`
+	Quantity    uint     `json:"quantity"`
+	Price       uint     `json:"price"`
+	Discount    uint     `gorm:"not null;default:0" json:"discount"`     // amount off quantity * price, in minor units
+	TaxRateBps  uint     `gorm:"not null;default:0" json:"tax_rate_bps"` // tax rate in basis points (2000 = 20%)
 }
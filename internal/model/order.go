@@ -2,13 +2,36 @@ package model
 
 import (
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type Order struct {
-	OrderID     int64      `gorm:"primarykey;column:order_id" json:"order_id"`
-	CustomerID  int64      `json:"customer_id"`
-	LineItems   []LineItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"line_items"`
-	CreatedAt   *time.Time `json:"created_at"`
+	OrderID    int64      `gorm:"primarykey;column:order_id;index:idx_orders_created_at_order_id,priority:2" json:"order_id"`
+	CustomerID int64      `gorm:"index" json:"customer_id"`
+	Status     Status     `gorm:"type:varchar(32);not null;default:pending;index" json:"status"`
+	Currency   Currency   `gorm:"type:char(3)" json:"currency"`
+	Version    int64      `gorm:"not null;default:1" json:"version"` // incremented on every change
+	LineItems  []LineItem `gorm:"foreignKey:OrderID;constraint:OnDelete:CASCADE" json:"line_items"`
+
+	// Totals are computed by the pricing package from LineItems.
+	Subtotal      uint64 `gorm:"not null;default:0" json:"subtotal"`
+	DiscountTotal uint64 `gorm:"not null;default:0" json:"discount_total"`
+	TaxTotal      uint64 `gorm:"not null;default:0" json:"tax_total"`
+	GrandTotal    uint64 `gorm:"not null;default:0;index" json:"grand_total"`
+
+	CreatedAt   *time.Time `gorm:"index:idx_orders_created_at_order_id,priority:1" json:"created_at"`
+	PaidAt      *time.Time `json:"paid_at"`
 	ShippedAt   *time.Time `json:"shipped_at"`
 	CompletedAt *time.Time `json:"completed_at"`
+	CancelledAt *time.Time `json:"cancelled_at"`
+	RefundedAt  *time.Time `json:"refunded_at"`
+
+	CancelledBy  string       `json:"cancelled_by,omitempty"`
+	CancelReason CancelReason `gorm:"type:varchar(32)" json:"cancel_reason,omitempty"`
+	CancelNote   string       `json:"cancel_note,omitempty"`
+
+	// DeletedAt is set when the order is deleted. Deleted orders are hidden
+	// from queries until restored or purged.
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Operations recorded in the order history.
+const (
+	OperationCreate  = "create"
+	OperationUpdate  = "update" // status, line items or totals changed
+	OperationDelete  = "delete"
+	OperationRestore = "restore"
+	OperationPurge   = "purge" // a deleted order was removed for good
+)
+
+// FieldChange is the change of one order field, as JSON. From is absent
+// for fields of a created order and To for those of a deleted one.
+type FieldChange struct {
+	From json.RawMessage `json:"from,omitempty"`
+	To   json.RawMessage `json:"to,omitempty"`
+}
+
+// Changes maps the JSON names of the changed fields of an order to their
+// change. It is stored as a JSON object.
+type Changes map[string]FieldChange
+
+// Value implements driver.Valuer.
+func (c Changes) Value() (driver.Value, error) {
+	if c == nil {
+		c = Changes{}
+	}
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("encode changes: %w", err)
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner.
+func (c *Changes) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	case nil:
+		*c = nil
+		return nil
+	default:
+		return fmt.Errorf("scan changes: unsupported type %T", src)
+	}
+
+	if err := json.Unmarshal(b, c); err != nil {
+		return fmt.Errorf("scan changes: %w", err)
+	}
+	return nil
+}
+
+// OrderHistory records one change to an order: who made it, in which
+// request, and how the order's fields changed. Entries are written in the
+// same transaction as the change and never modified, so they outlive the
+// order itself.
+type OrderHistory struct {
+	ID         int64     `gorm:"primaryKey;index:idx_order_history_order_id_id,priority:2" json:"id"`
+	OrderID    int64     `gorm:"not null;index:idx_order_history_order_id_id,priority:1" json:"order_id"`
+	CustomerID int64     `gorm:"not null" json:"-"` // restricts reads like the order's
+	Operation  string    `gorm:"type:varchar(32);not null" json:"operation"`
+	Actor      string    `gorm:"type:varchar(255);not null" json:"actor"`      // e.g. "api_key:3f9c0a1b2d4e5f60"; "" if unknown
+	RequestID  string    `gorm:"type:varchar(255);not null" json:"request_id"` // "" outside requests
+	Changes    Changes   `gorm:"type:jsonb;not null" json:"changes"`
+	CreatedAt  time.Time `gorm:"not null" json:"created_at"`
+}
+
+func (OrderHistory) TableName() string {
+	return "order_history"
+}
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Types of the domain events recorded for orders. A change of status is
+// recorded as the event of the new status; see StatusEvent.
+const (
+	EventOrderCreated  = "order.created"
+	EventOrderUpdated  = "order.updated" // line items or totals changed
+	EventOrderDeleted  = "order.deleted"
+	EventOrderRestored = "order.restored"
+)
+
+// StatusEvent returns the type of the event recorded when an order moves to
+// status, such as "order.shipped".
+func StatusEvent(status Status) string {
+	return "order." + string(status)
+}
+
+// OutboxEvent is a domain event. It is written to the outbox table in the
+// same transaction as the change it describes, and delivered from there to
+// the event sinks by the outbox relay, at least once.
+type OutboxEvent struct {
+	ID         int64           `gorm:"primaryKey" json:"id"`
+	Type       string          `gorm:"type:varchar(64);not null" json:"type"`
+	OrderID    int64           `gorm:"not null;index" json:"order_id"`
+	CustomerID int64           `gorm:"not null" json:"customer_id"`
+	Payload    json.RawMessage `gorm:"type:jsonb;not null" json:"data"` // the order after the change
+	CreatedAt  time.Time       `gorm:"not null" json:"created_at"`
+
+	// Delivery state, maintained by the relay. An event is pending until it
+	// is delivered or dead-lettered.
+	Attempts       int        `gorm:"not null;default:0" json:"-"`
+	NextAttemptAt  time.Time  `gorm:"not null;index:idx_outbox_pending,where:delivered_at IS NULL AND dead_lettered_at IS NULL" json:"-"`
+	LastError      string     `json:"-"`
+	DeliveredAt    *time.Time `json:"-"`
+	DeadLetteredAt *time.Time `json:"-"` // set once delivery has been given up
+}
+
+func (OutboxEvent) TableName() string {
+	return "outbox"
+}
@@ -0,0 +1,15 @@
+package model
+
+// Status is the lifecycle state of an order. The allowed transitions between
+// states are defined by the orderstate package.
+type Status string
+
+const (
+	StatusPending   Status = "pending"   // created, awaiting payment
+	StatusPaid      Status = "paid"      // paid, awaiting shipment
+	StatusShipped   Status = "shipped"   // handed to the carrier
+	StatusCompleted Status = "completed" // delivered and closed
+	StatusCancelled Status = "cancelled" // cancelled before completion
+	StatusRefunded  Status = "refunded"  // payment returned to the customer
+	StatusOnHold    Status = "on_hold"   // paused pending manual review
+)
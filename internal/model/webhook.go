@@ -0,0 +1,87 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// EventFilter selects event types by pattern, such as "order.shipped" or
+// "order.*"; a pattern ending in "*" matches every type with that prefix.
+// It is stored as a space-separated string. An empty filter matches every
+// event.
+type EventFilter []string
+
+// Matches reports whether eventType is selected by f.
+func (f EventFilter) Matches(eventType string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, pattern := range f {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(eventType, prefix) {
+				return true
+			}
+		} else if eventType == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// Value implements driver.Valuer.
+func (f EventFilter) Value() (driver.Value, error) {
+	return strings.Join(f, " "), nil
+}
+
+// Scan implements sql.Scanner.
+func (f *EventFilter) Scan(src any) error {
+	var str string
+	switch v := src.(type) {
+	case string:
+		str = v
+	case []byte:
+		str = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("scan event filter: unsupported type %T", src)
+	}
+
+	*f = strings.Fields(str)
+	return nil
+}
+
+// Webhook is a subscription to the order events selected by Events, which
+// are POSTed to URL and signed with Secret.
+type Webhook struct {
+	ID        int64       `gorm:"primaryKey" json:"id"`
+	URL       string      `gorm:"type:varchar(2048);not null" json:"url"`
+	Events    EventFilter `gorm:"type:varchar(1024);not null" json:"events"`
+	Secret    string      `gorm:"type:varchar(255);not null" json:"-"` // shown once, when created
+	CreatedAt time.Time   `gorm:"not null" json:"created_at"`
+
+	// ConsecutiveFailures counts the failed deliveries since the last
+	// successful one. Once it reaches the relay's limit the webhook is
+	// disabled and receives no more events.
+	ConsecutiveFailures int        `gorm:"not null;default:0" json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at,omitempty"`
+}
+
+// Disabled reports whether the webhook has been disabled.
+func (w Webhook) Disabled() bool {
+	return w.DisabledAt != nil
+}
+
+// WebhookDelivery records one attempt to deliver an event to a webhook.
+type WebhookDelivery struct {
+	ID         int64     `gorm:"primaryKey" json:"id"`
+	WebhookID  int64     `gorm:"not null;index:idx_webhook_deliveries_event" json:"webhook_id"`
+	EventID    int64     `gorm:"not null;index:idx_webhook_deliveries_event" json:"event_id"`
+	EventType  string    `gorm:"type:varchar(64);not null" json:"event_type"`
+	StatusCode int       `gorm:"not null;default:0" json:"status_code"` // 0 if no response was received
+	Error      string    `json:"error,omitempty"`
+	Success    bool      `gorm:"not null" json:"success"`
+	DurationMs int64     `gorm:"not null" json:"duration_ms"`
+	CreatedAt  time.Time `gorm:"not null" json:"created_at"`
+}
@@ -0,0 +1,61 @@
+package orderstate
+
+import (
+	"errors"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// Default returns the standard order lifecycle:
+//
+//	pending -> paid -> shipped -> completed
+//
+// Orders can be cancelled until they ship, refunded once paid, and put on
+// hold before shipping; a held order is released back to the state it was in.
+func Default() *Machine {
+	return New(model.StatusPending,
+		Transition{From: model.StatusPending, To: model.StatusPaid, Stamp: stampPaid},
+		Transition{From: model.StatusPaid, To: model.StatusShipped, Guard: requirePaid, Stamp: stampShipped},
+		Transition{From: model.StatusShipped, To: model.StatusCompleted, Guard: requireShipped, Stamp: stampCompleted},
+
+		Transition{From: model.StatusPending, To: model.StatusCancelled, Stamp: stampCancelled},
+		Transition{From: model.StatusPaid, To: model.StatusCancelled, Stamp: stampCancelled},
+		Transition{From: model.StatusOnHold, To: model.StatusCancelled, Stamp: stampCancelled},
+
+		Transition{From: model.StatusPaid, To: model.StatusRefunded, Guard: requirePaid, Stamp: stampRefunded},
+		Transition{From: model.StatusCompleted, To: model.StatusRefunded, Guard: requirePaid, Stamp: stampRefunded},
+
+		Transition{From: model.StatusPending, To: model.StatusOnHold},
+		Transition{From: model.StatusPaid, To: model.StatusOnHold},
+		Transition{From: model.StatusOnHold, To: model.StatusPending, Guard: requireUnpaid},
+		Transition{From: model.StatusOnHold, To: model.StatusPaid, Guard: requirePaid},
+	)
+}
+
+func requirePaid(o *model.Order) error {
+	if o.PaidAt == nil {
+		return errors.New("order has not been paid")
+	}
+	return nil
+}
+
+func requireUnpaid(o *model.Order) error {
+	if o.PaidAt != nil {
+		return errors.New("order has already been paid")
+	}
+	return nil
+}
+
+func requireShipped(o *model.Order) error {
+	if o.ShippedAt == nil {
+		return errors.New("order has not been shipped")
+	}
+	return nil
+}
+
+func stampPaid(o *model.Order, at time.Time)      { o.PaidAt = &at }
+func stampShipped(o *model.Order, at time.Time)   { o.ShippedAt = &at }
+func stampCompleted(o *model.Order, at time.Time) { o.CompletedAt = &at }
+func stampCancelled(o *model.Order, at time.Time) { o.CancelledAt = &at }
+func stampRefunded(o *model.Order, at time.Time)  { o.RefundedAt = &at }
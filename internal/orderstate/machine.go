@@ -0,0 +1,127 @@
+// Package orderstate defines the order lifecycle as a state machine.
+//
+// A Machine holds the set of allowed transitions between model.Status values.
+// Each transition may carry a guard that vetoes it for a particular order and
+// a stamp that records when it happened. Handlers and repositories only ask
+// the machine whether a change is allowed, so new states are added here.
+package orderstate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// Errors returned by Machine.
+var (
+	ErrUnknownStatus     = errors.New("unknown order status")
+	ErrInvalidTransition = errors.New("invalid status transition")
+)
+
+// Guard reports whether o may take a transition. A non-nil error vetoes it.
+type Guard func(o *model.Order) error
+
+// Stamp records on o the time at which a transition happened.
+type Stamp func(o *model.Order, at time.Time)
+
+// Transition is an allowed move between two states.
+type Transition struct {
+	From  model.Status
+	To    model.Status
+	Guard Guard // optional
+	Stamp Stamp // optional
+}
+
+// Machine is a set of allowed transitions. It is not safe to Register
+// transitions concurrently with other calls.
+type Machine struct {
+	initial     model.Status
+	states      map[model.Status]bool
+	transitions map[model.Status]map[model.Status]Transition
+}
+
+// New returns a machine whose orders start in initial, with transitions ts.
+func New(initial model.Status, ts ...Transition) *Machine {
+	m := &Machine{
+		initial:     initial,
+		states:      map[model.Status]bool{initial: true},
+		transitions: make(map[model.Status]map[model.Status]Transition),
+	}
+	for _, t := range ts {
+		m.Register(t)
+	}
+	return m
+}
+
+// Register adds t to the machine, replacing any transition between the same
+// two states.
+func (m *Machine) Register(t Transition) {
+	m.states[t.From] = true
+	m.states[t.To] = true
+
+	if m.transitions[t.From] == nil {
+		m.transitions[t.From] = make(map[model.Status]Transition)
+	}
+	m.transitions[t.From][t.To] = t
+}
+
+// Initial returns the state new orders start in.
+func (m *Machine) Initial() model.Status {
+	return m.initial
+}
+
+// Known reports whether s is a state of the machine.
+func (m *Machine) Known(s model.Status) bool {
+	return m.states[s]
+}
+
+// Can reports whether the machine has a transition from one state to another,
+// ignoring guards.
+func (m *Machine) Can(from, to model.Status) bool {
+	_, ok := m.transitions[from][to]
+	return ok
+}
+
+// Sources returns every state from which to can be reached.
+func (m *Machine) Sources(to model.Status) []model.Status {
+	var from []model.Status
+	for s, next := range m.transitions {
+		if _, ok := next[to]; ok {
+			from = append(from, s)
+		}
+	}
+	return from
+}
+
+// Apply moves o to state to, running the transition's guard and stamp.
+// o is left untouched when an error is returned.
+func (m *Machine) Apply(o *model.Order, to model.Status, at time.Time) error {
+	if !m.Known(to) {
+		return fmt.Errorf("%q: %w", to, ErrUnknownStatus)
+	}
+
+	from := o.Status
+	if from == "" {
+		from = m.initial
+	}
+
+	t, ok := m.transitions[from][to]
+	if !ok {
+		return fmt.Errorf("%s -> %s: %w", from, to, ErrInvalidTransition)
+	}
+
+	if t.Guard != nil {
+		if err := t.Guard(o); err != nil {
+			return fmt.Errorf("%s -> %s: %w: %w", from, to, ErrInvalidTransition, err)
+		}
+	}
+
+	o.Status = to
+	if t.Stamp != nil {
+		t.Stamp(o, at)
+	}
+
+	return nil
+}
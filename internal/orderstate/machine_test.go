@@ -0,0 +1,94 @@
+package orderstate_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDefault_HappyPath(t *testing.T) {
+	m := orderstate.Default()
+	o := &model.Order{}
+	now := time.Now().UTC()
+
+	for _, to := range []model.Status{model.StatusPaid, model.StatusShipped, model.StatusCompleted} {
+		require.NoError(t, m.Apply(o, to, now), to)
+	}
+
+	assert.Equal(t, model.StatusCompleted, o.Status)
+	assert.NotNil(t, o.PaidAt)
+	assert.NotNil(t, o.ShippedAt)
+	assert.NotNil(t, o.CompletedAt)
+}
+
+func TestDefault_RejectsSkippingPayment(t *testing.T) {
+	m := orderstate.Default()
+	o := &model.Order{Status: model.StatusPending}
+
+	err := m.Apply(o, model.StatusShipped, time.Now())
+
+	assert.ErrorIs(t, err, orderstate.ErrInvalidTransition)
+	assert.Equal(t, model.StatusPending, o.Status)
+	assert.Nil(t, o.ShippedAt)
+}
+
+func TestDefault_TerminalStates(t *testing.T) {
+	m := orderstate.Default()
+
+	for _, from := range []model.Status{model.StatusCancelled, model.StatusRefunded} {
+		for _, to := range []model.Status{model.StatusPending, model.StatusPaid, model.StatusShipped, model.StatusOnHold} {
+			assert.False(t, m.Can(from, to), "%s -> %s", from, to)
+		}
+	}
+}
+
+func TestDefault_HoldReleasesToPriorState(t *testing.T) {
+	m := orderstate.Default()
+	now := time.Now()
+
+	unpaid := &model.Order{Status: model.StatusPending}
+	require.NoError(t, m.Apply(unpaid, model.StatusOnHold, now))
+	assert.ErrorIs(t, m.Apply(unpaid, model.StatusPaid, now), orderstate.ErrInvalidTransition)
+	require.NoError(t, m.Apply(unpaid, model.StatusPending, now))
+
+	paid := &model.Order{Status: model.StatusPaid, PaidAt: &now}
+	require.NoError(t, m.Apply(paid, model.StatusOnHold, now))
+	assert.ErrorIs(t, m.Apply(paid, model.StatusPending, now), orderstate.ErrInvalidTransition)
+	require.NoError(t, m.Apply(paid, model.StatusPaid, now))
+}
+
+func TestApply_UnknownStatus(t *testing.T) {
+	err := orderstate.Default().Apply(&model.Order{}, "lost", time.Now())
+	assert.ErrorIs(t, err, orderstate.ErrUnknownStatus)
+}
+
+func TestApply_GuardVeto(t *testing.T) {
+	veto := errors.New("veto")
+	m := orderstate.New("draft", orderstate.Transition{
+		From:  "draft",
+		To:    "review",
+		Guard: func(*model.Order) error { return veto },
+	})
+
+	o := &model.Order{Status: "draft"}
+	err := m.Apply(o, "review", time.Now())
+
+	assert.ErrorIs(t, err, orderstate.ErrInvalidTransition)
+	assert.ErrorIs(t, err, veto)
+	assert.Equal(t, model.Status("draft"), o.Status)
+}
+
+func TestRegister_AddsState(t *testing.T) {
+	m := orderstate.Default()
+	assert.False(t, m.Known("disputed"))
+
+	m.Register(orderstate.Transition{From: model.StatusCompleted, To: "disputed"})
+
+	assert.True(t, m.Known("disputed"))
+	assert.Contains(t, m.Sources("disputed"), model.StatusCompleted)
+}
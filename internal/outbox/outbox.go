@@ -0,0 +1,54 @@
+// Package outbox delivers the domain events recorded in the outbox table to
+// event sinks.
+//
+// Events are written by the repository in the same transaction as the change
+// they describe, so an event exists exactly when its change was committed.
+// The Relay then delivers them at least once: a sink may see an event more
+// than once, for example if the process stops between delivering it and
+// marking it delivered, and should deduplicate by event ID where that
+// matters. Each order's events are delivered in the order they were
+// recorded.
+package outbox
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// Sink receives delivered events. Deliver returns an error if the event
+// should be retried.
+type Sink interface {
+	Deliver(ctx context.Context, event model.OutboxEvent) error
+}
+
+// SinkFunc adapts a function to the Sink interface.
+type SinkFunc func(ctx context.Context, event model.OutboxEvent) error
+
+func (f SinkFunc) Deliver(ctx context.Context, event model.OutboxEvent) error {
+	return f(ctx, event)
+}
+
+// LogSink logs every event at info level. It is the default sink.
+type LogSink struct{}
+
+func (LogSink) Deliver(ctx context.Context, event model.OutboxEvent) error {
+	slog.InfoContext(ctx, "domain event",
+		"type", event.Type,
+		"event_id", event.ID,
+		"order_id", event.OrderID,
+	)
+	return nil
+}
+
+// Store holds the outbox events and their delivery state.
+// repository.OutboxRepo implements it.
+type Store interface {
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.OutboxEvent, error)
+	MarkDelivered(ctx context.Context, id int64, at time.Time) error
+	MarkFailed(ctx context.Context, id int64, next time.Time, cause error) error
+	MarkDeadLettered(ctx context.Context, id int64, at time.Time, cause error) error
+	Purge(ctx context.Context, before time.Time) (int64, error)
+}
@@ -0,0 +1,189 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// Relay defaults, used by NewRelay.
+const (
+	DefaultBatchSize    = 100
+	DefaultMaxAttempts  = 10
+	DefaultPollInterval = time.Second
+	DefaultLease        = time.Minute
+	DefaultRetention    = 7 * 24 * time.Hour
+)
+
+// purgeInterval is how often Run deletes delivered events older than
+// Retention.
+const purgeInterval = time.Hour
+
+// Relay delivers the pending events of a Store to its Sinks.
+//
+// An event is delivered when every sink accepts it. If any sink fails, the
+// event is retried after Backoff(attempts), and given up on (dead-lettered)
+// once it has failed MaxAttempts times. Sinks that accepted it earlier see it
+// again on retry.
+//
+// Several relays, in several replicas, may share a Store: claimed events are
+// leased for Lease, so each is handled by one relay at a time. Lease must
+// exceed the time the sinks take to deliver a batch.
+type Relay struct {
+	Store Store
+	Sinks []Sink
+
+	BatchSize    int
+	MaxAttempts  int
+	PollInterval time.Duration
+	Lease        time.Duration
+	Retention    time.Duration // how long delivered events are kept
+
+	// Backoff returns the delay before retrying an event that has failed
+	// attempts times.
+	Backoff func(attempts int) time.Duration
+}
+
+// NewRelay returns a relay with the default settings.
+func NewRelay(store Store, sinks ...Sink) *Relay {
+	return &Relay{
+		Store:        store,
+		Sinks:        sinks,
+		BatchSize:    DefaultBatchSize,
+		MaxAttempts:  DefaultMaxAttempts,
+		PollInterval: DefaultPollInterval,
+		Lease:        DefaultLease,
+		Retention:    DefaultRetention,
+		Backoff:      ExponentialBackoff(time.Second, 5*time.Minute),
+	}
+}
+
+// ExponentialBackoff returns a Backoff that waits base after the first
+// failure and doubles the wait after each further one, up to limit.
+func ExponentialBackoff(base, limit time.Duration) func(attempts int) time.Duration {
+	return func(attempts int) time.Duration {
+		d := base
+		for i := 1; i < attempts && d < limit; i++ {
+			d *= 2
+		}
+		return min(d, limit)
+	}
+}
+
+// Run relays events until ctx is cancelled. It polls every PollInterval,
+// and immediately again after a full batch.
+func (r *Relay) Run(ctx context.Context) {
+	poll := time.NewTimer(0)
+	defer poll.Stop()
+
+	purge := time.NewTicker(purgeInterval)
+	defer purge.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-poll.C:
+			n, err := r.RelayBatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "outbox relay failed", "error", err)
+			}
+			switch {
+			case err == nil && n == r.BatchSize:
+				poll.Reset(0)
+			case r.PollInterval > 0:
+				poll.Reset(r.PollInterval)
+			default:
+				poll.Reset(DefaultPollInterval)
+			}
+
+		case now := <-purge.C:
+			n, err := r.Store.Purge(ctx, now.UTC().Add(-r.Retention))
+			if err != nil {
+				slog.ErrorContext(ctx, "outbox purge failed", "error", err)
+				continue
+			}
+			if n > 0 {
+				slog.InfoContext(ctx, "purged delivered outbox events", "count", n)
+			}
+		}
+	}
+}
+
+// RelayBatch claims up to BatchSize due events, delivers each to the sinks
+// and records the outcome. It returns the number of events claimed.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	events, err := r.Store.Claim(ctx, time.Now().UTC(), r.Lease, r.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, event := range events {
+		if err := r.relay(ctx, event); err != nil {
+			return len(events), err
+		}
+	}
+
+	return len(events), nil
+}
+
+// relay delivers one claimed event and records the outcome.
+func (r *Relay) relay(ctx context.Context, event model.OutboxEvent) error {
+	deliverErr := r.deliver(ctx, event)
+
+	// Leave the event leased if we are stopping: it is retried once the
+	// lease expires, without counting as a failure.
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	now := time.Now().UTC()
+	attempts := event.Attempts + 1
+
+	switch {
+	case deliverErr == nil:
+		metrics.OutboxDelivered.Inc()
+		return r.Store.MarkDelivered(ctx, event.ID, now)
+
+	case attempts >= r.MaxAttempts:
+		metrics.OutboxDeadLettered.Inc()
+		slog.ErrorContext(ctx, "outbox event dead-lettered",
+			"type", event.Type,
+			"event_id", event.ID,
+			"order_id", event.OrderID,
+			"attempts", attempts,
+			"error", deliverErr,
+		)
+		return r.Store.MarkDeadLettered(ctx, event.ID, now, deliverErr)
+
+	default:
+		metrics.OutboxFailures.Inc()
+		next := now.Add(r.Backoff(attempts))
+		slog.WarnContext(ctx, "outbox event delivery failed",
+			"type", event.Type,
+			"event_id", event.ID,
+			"order_id", event.OrderID,
+			"attempts", attempts,
+			"retry_at", next,
+			"error", deliverErr,
+		)
+		return r.Store.MarkFailed(ctx, event.ID, next, deliverErr)
+	}
+}
+
+// deliver passes event to every sink and joins their errors.
+func (r *Relay) deliver(ctx context.Context, event model.OutboxEvent) error {
+	var errs []error
+	for i, sink := range r.Sinks {
+		if err := sink.Deliver(ctx, event); err != nil {
+			errs = append(errs, fmt.Errorf("sink %d: %w", i, err))
+		}
+	}
+	return errors.Join(errs...)
+}
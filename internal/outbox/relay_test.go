@@ -0,0 +1,217 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/outbox"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func setupOutbox(t *testing.T) (*gorm.DB, repository.OrderRepository, *repository.OutboxRepo) {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+
+	// Every connection to :memory: opens a new database; keep to one.
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(&model.Order{}, &model.LineItem{}, &model.OutboxEvent{}, &model.OrderHistory{}))
+
+	return db, repository.NewOrderRepo(db), repository.NewOutboxRepo(db)
+}
+
+// staffCtx sees and changes every customer's orders.
+var staffCtx = repository.WithScope(context.Background(), repository.Unrestricted)
+
+// recorder is a sink that records what it is given and fails while fail is
+// set.
+type recorder struct {
+	mu     sync.Mutex
+	events []model.OutboxEvent
+	fail   error
+}
+
+func (r *recorder) Deliver(_ context.Context, e model.OutboxEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail != nil {
+		return r.fail
+	}
+	r.events = append(r.events, e)
+	return nil
+}
+
+func (r *recorder) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := make([]string, len(r.events))
+	for i, e := range r.events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+func storedEvent(t *testing.T, db *gorm.DB, id int64) model.OutboxEvent {
+	t.Helper()
+	var e model.OutboxEvent
+	require.NoError(t, db.First(&e, id).Error)
+	return e
+}
+
+func TestRelayBatch_DeliversToEverySink(t *testing.T) {
+	db, orders, store := setupOutbox(t)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, orders.Insert(ctx, o))
+
+	a, b := &recorder{}, &recorder{}
+	relay := outbox.NewRelay(store, a, b)
+
+	n, err := relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"order.created"}, a.types())
+	assert.Equal(t, []string{"order.created"}, b.types())
+
+	e := storedEvent(t, db, a.events[0].ID)
+	assert.NotNil(t, e.DeliveredAt)
+	assert.Equal(t, 1, e.Attempts)
+
+	n, err = relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n, "delivered events are not relayed again")
+}
+
+func TestRelayBatch_RetriesWithBackoff(t *testing.T) {
+	db, orders, store := setupOutbox(t)
+	ctx := staffCtx
+
+	require.NoError(t, orders.Insert(ctx, &model.Order{CustomerID: 1}))
+
+	sink := &recorder{fail: errors.New("sink down")}
+	relay := outbox.NewRelay(store, sink)
+	relay.Backoff = func(int) time.Duration { return time.Hour }
+
+	_, err := relay.RelayBatch(ctx)
+	require.NoError(t, err, "a failed delivery is not a relay error")
+
+	e := storedEvent(t, db, 1)
+	assert.Nil(t, e.DeliveredAt)
+	assert.Equal(t, 1, e.Attempts)
+	assert.Contains(t, e.LastError, "sink down")
+	assert.WithinDuration(t, time.Now().Add(time.Hour), e.NextAttemptAt, time.Minute)
+
+	// Not due again until the backoff has passed.
+	n, err := relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	require.NoError(t, db.Model(&e).Update("next_attempt_at", time.Now().UTC().Add(-time.Second)).Error)
+	sink.fail = nil
+	n, err = relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"order.created"}, sink.types())
+	assert.NotNil(t, storedEvent(t, db, 1).DeliveredAt)
+}
+
+func TestRelayBatch_DeadLettersAfterMaxAttempts(t *testing.T) {
+	db, orders, store := setupOutbox(t)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, orders.Insert(ctx, o))
+	o.Status = model.StatusPaid
+	require.NoError(t, orders.UpdateByID(ctx, o))
+
+	sink := &recorder{fail: errors.New("rejected")}
+	relay := outbox.NewRelay(store, sink)
+	relay.MaxAttempts = 3
+	relay.Backoff = func(int) time.Duration { return 0 }
+
+	for range 3 {
+		_, err := relay.RelayBatch(ctx)
+		require.NoError(t, err)
+	}
+
+	created := storedEvent(t, db, 1)
+	assert.NotNil(t, created.DeadLetteredAt)
+	assert.Nil(t, created.DeliveredAt)
+	assert.Equal(t, 3, created.Attempts)
+
+	// Dead-lettering releases the order's later events.
+	sink.fail = nil
+	_, err := relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order.paid"}, sink.types())
+}
+
+func TestRelayBatch_LeavesEventLeasedWhenStopping(t *testing.T) {
+	db, orders, store := setupOutbox(t)
+	ctx, cancel := context.WithCancel(staffCtx)
+
+	require.NoError(t, orders.Insert(ctx, &model.Order{CustomerID: 1}))
+
+	relay := outbox.NewRelay(store, outbox.SinkFunc(func(ctx context.Context, _ model.OutboxEvent) error {
+		cancel()
+		return ctx.Err()
+	}))
+
+	_, err := relay.RelayBatch(ctx)
+	require.ErrorIs(t, err, context.Canceled)
+
+	e := storedEvent(t, db, 1)
+	assert.Zero(t, e.Attempts, "an interrupted delivery is not a failure")
+	assert.Nil(t, e.DeliveredAt)
+	assert.Nil(t, e.DeadLetteredAt)
+}
+
+func TestRun_RelaysUntilCancelled(t *testing.T) {
+	_, orders, store := setupOutbox(t)
+	ctx, cancel := context.WithCancel(staffCtx)
+
+	sink := &recorder{}
+	relay := outbox.NewRelay(store, sink)
+	relay.PollInterval = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	require.NoError(t, orders.Insert(staffCtx, &model.Order{CustomerID: 1}))
+	assert.Eventually(t, func() bool { return len(sink.types()) == 1 }, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := outbox.ExponentialBackoff(time.Second, 10*time.Second)
+
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 8*time.Second, backoff(4))
+	assert.Equal(t, 10*time.Second, backoff(5))
+	assert.Equal(t, 10*time.Second, backoff(100))
+}
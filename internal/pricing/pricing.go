@@ -0,0 +1,125 @@
+// Package pricing computes order totals from line items.
+//
+// All amounts are unsigned integers in the currency's minor unit (cents for
+// EUR, yen for JPY). Every arithmetic step is checked, so a total that would
+// not fit in a uint64 is reported as ErrOverflow instead of wrapping.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math/bits"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// BasisPointsPerUnit is the denominator of tax rates: 10000 bps = 100%.
+const BasisPointsPerUnit = 10_000
+
+// Errors returned by Compute.
+var (
+	ErrOverflow        = errors.New("amount overflows")
+	ErrDiscountTooHigh = errors.New("discount exceeds line amount")
+	ErrInvalidTaxRate  = errors.New("tax rate out of range")
+)
+
+// Totals are the amounts derived from an order's line items.
+type Totals struct {
+	Subtotal      uint64 // sum of quantity * price
+	DiscountTotal uint64 // sum of line discounts
+	TaxTotal      uint64 // tax on the discounted amounts
+	GrandTotal    uint64 // Subtotal - DiscountTotal + TaxTotal
+}
+
+// Compute returns the totals of items. Each line is taxed on its amount after
+// discount, rounding half up to the nearest minor unit.
+func Compute(items []model.LineItem) (Totals, error) {
+	var t Totals
+
+	for i, item := range items {
+		amount, err := mul(uint64(item.Quantity), uint64(item.Price))
+		if err != nil {
+			return Totals{}, fmt.Errorf("line %d amount: %w", i, err)
+		}
+
+		discount := uint64(item.Discount)
+		if discount > amount {
+			return Totals{}, fmt.Errorf("line %d: %w", i, ErrDiscountTooHigh)
+		}
+
+		if item.TaxRateBps > BasisPointsPerUnit {
+			return Totals{}, fmt.Errorf("line %d rate %d bps: %w", i, item.TaxRateBps, ErrInvalidTaxRate)
+		}
+		tax, err := applyRate(amount-discount, uint64(item.TaxRateBps))
+		if err != nil {
+			return Totals{}, fmt.Errorf("line %d tax: %w", i, err)
+		}
+
+		if t.Subtotal, err = add(t.Subtotal, amount); err != nil {
+			return Totals{}, fmt.Errorf("subtotal: %w", err)
+		}
+		if t.DiscountTotal, err = add(t.DiscountTotal, discount); err != nil {
+			return Totals{}, fmt.Errorf("discount total: %w", err)
+		}
+		if t.TaxTotal, err = add(t.TaxTotal, tax); err != nil {
+			return Totals{}, fmt.Errorf("tax total: %w", err)
+		}
+	}
+
+	// DiscountTotal <= Subtotal because every line discount is bounded by
+	// its amount, so only the addition can overflow.
+	grand, err := add(t.Subtotal-t.DiscountTotal, t.TaxTotal)
+	if err != nil {
+		return Totals{}, fmt.Errorf("grand total: %w", err)
+	}
+	t.GrandTotal = grand
+
+	return t, nil
+}
+
+// Apply computes the totals of o's line items and stores them on o.
+func Apply(o *model.Order) error {
+	t, err := Compute(o.LineItems)
+	if err != nil {
+		return err
+	}
+
+	o.Subtotal = t.Subtotal
+	o.DiscountTotal = t.DiscountTotal
+	o.TaxTotal = t.TaxTotal
+	o.GrandTotal = t.GrandTotal
+
+	return nil
+}
+
+func add(a, b uint64) (uint64, error) {
+	sum, carry := bits.Add64(a, b, 0)
+	if carry != 0 {
+		return 0, ErrOverflow
+	}
+	return sum, nil
+}
+
+func mul(a, b uint64) (uint64, error) {
+	hi, lo := bits.Mul64(a, b)
+	if hi != 0 {
+		return 0, ErrOverflow
+	}
+	return lo, nil
+}
+
+// applyRate returns amount * bps / BasisPointsPerUnit rounded half up, using
+// 128-bit intermediates so that large amounts do not overflow early.
+func applyRate(amount, bps uint64) (uint64, error) {
+	hi, lo := bits.Mul64(amount, bps)
+
+	var carry uint64
+	lo, carry = bits.Add64(lo, BasisPointsPerUnit/2, 0)
+	hi += carry
+
+	if hi >= BasisPointsPerUnit {
+		return 0, ErrOverflow
+	}
+	quo, _ := bits.Div64(hi, lo, BasisPointsPerUnit)
+	return quo, nil
+}
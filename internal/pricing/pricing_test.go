@@ -0,0 +1,85 @@
+package pricing_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompute_Empty(t *testing.T) {
+	totals, err := pricing.Compute(nil)
+
+	require.NoError(t, err)
+	assert.Equal(t, pricing.Totals{}, totals)
+}
+
+func TestCompute_DiscountAndTax(t *testing.T) {
+	items := []model.LineItem{
+		{Quantity: 2, Price: 1000, Discount: 200, TaxRateBps: 2000}, // 2000 - 200 = 1800, tax 360
+		{Quantity: 1, Price: 999, TaxRateBps: 700},                  // tax 69.93 -> 70
+		{Quantity: 3, Price: 100},                                   // untaxed
+	}
+
+	totals, err := pricing.Compute(items)
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3299), totals.Subtotal)
+	assert.Equal(t, uint64(200), totals.DiscountTotal)
+	assert.Equal(t, uint64(430), totals.TaxTotal)
+	assert.Equal(t, uint64(3299-200+430), totals.GrandTotal)
+}
+
+func TestCompute_RoundsHalfUp(t *testing.T) {
+	// 25 * 10% = 2.5 -> 3
+	totals, err := pricing.Compute([]model.LineItem{{Quantity: 1, Price: 25, TaxRateBps: 1000}})
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), totals.TaxTotal)
+}
+
+func TestCompute_TaxOnLargeAmountDoesNotOverflowEarly(t *testing.T) {
+	// amount * bps exceeds 64 bits, but the tax itself fits.
+	price := uint(math.MaxUint64 / 4)
+	totals, err := pricing.Compute([]model.LineItem{{Quantity: 1, Price: price, TaxRateBps: 100}})
+
+	require.NoError(t, err)
+	assert.Equal(t, uint64(price)/100, totals.TaxTotal) // remainder .03 rounds down
+}
+
+func TestCompute_Overflow(t *testing.T) {
+	cases := map[string][]model.LineItem{
+		"line amount": {{Quantity: 2, Price: math.MaxUint64}},
+		"subtotal":    {{Quantity: 1, Price: math.MaxUint64}, {Quantity: 1, Price: 1}},
+		"grand total": {{Quantity: 1, Price: math.MaxUint64, TaxRateBps: 10}},
+	}
+
+	for name, items := range cases {
+		_, err := pricing.Compute(items)
+		assert.ErrorIs(t, err, pricing.ErrOverflow, name)
+	}
+}
+
+func TestCompute_DiscountTooHigh(t *testing.T) {
+	_, err := pricing.Compute([]model.LineItem{{Quantity: 1, Price: 100, Discount: 101}})
+	assert.ErrorIs(t, err, pricing.ErrDiscountTooHigh)
+}
+
+func TestCompute_InvalidTaxRate(t *testing.T) {
+	_, err := pricing.Compute([]model.LineItem{{Quantity: 1, Price: 100, TaxRateBps: 10001}})
+	assert.ErrorIs(t, err, pricing.ErrInvalidTaxRate)
+}
+
+func TestApply_SetsOrderTotals(t *testing.T) {
+	o := &model.Order{LineItems: []model.LineItem{{Quantity: 4, Price: 250, Discount: 100, TaxRateBps: 1000}}}
+
+	require.NoError(t, pricing.Apply(o))
+
+	assert.Equal(t, uint64(1000), o.Subtotal)
+	assert.Equal(t, uint64(100), o.DiscountTotal)
+	assert.Equal(t, uint64(90), o.TaxTotal)
+	assert.Equal(t, uint64(990), o.GrandTotal)
+}
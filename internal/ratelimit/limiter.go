@@ -0,0 +1,45 @@
+// Package ratelimit decides whether a client may make another request.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("invalid rate limit")
+
+// Limit allows Requests requests per Window.
+type Limit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (l Limit) validate() error {
+	if l.Requests < 1 || l.Window <= 0 {
+		return fmt.Errorf("%d requests per %s: %w", l.Requests, l.Window, ErrInvalidLimit)
+	}
+	return nil
+}
+
+// perSecond returns the rate at which a token bucket refills.
+func (l Limit) perSecond() float64 {
+	return float64(l.Requests) / l.Window.Seconds()
+}
+
+// Decision is a limiter's answer for one request.
+type Decision struct {
+	Allowed    bool
+	Limit      int           // requests allowed per window
+	Remaining  int           // requests left right now
+	ResetAt    time.Time     // when the full quota is available again
+	RetryAfter time.Duration // when Allowed is false, how long until a request may succeed
+}
+
+// Limiter tracks requests per key, such as a client's IP address. Allow
+// records a request for key if limit permits it. The limit is passed on every
+// call, so different keys may have different limits.
+type Limiter interface {
+	Allow(ctx context.Context, key string, limit Limit) (Decision, error)
+}
@@ -0,0 +1,276 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// clock is a manually advanced time source.
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newClock() *clock {
+	return &clock{t: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func TestTokenBucket_BurstThenRefill(t *testing.T) {
+	c := newClock()
+	l := NewTokenBucket(0)
+	l.now = c.now
+	ctx := context.Background()
+	limit := Limit{Requests: 3, Window: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		d, err := l.Allow(ctx, "k", limit)
+		require.NoError(t, err)
+		assert.True(t, d.Allowed)
+		assert.Equal(t, i, d.Remaining)
+	}
+
+	d, err := l.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+	assert.Equal(t, c.t.Add(3*time.Second), d.ResetAt)
+
+	// One token comes back per second.
+	c.advance(time.Second)
+	d, err = l.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	// Other keys have their own bucket.
+	d, err = l.Allow(ctx, "other", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 2, d.Remaining)
+}
+
+func TestTokenBucket_NeverExceedsCapacity(t *testing.T) {
+	c := newClock()
+	l := NewTokenBucket(0)
+	l.now = c.now
+	limit := Limit{Requests: 2, Window: time.Second}
+
+	_, err := l.Allow(context.Background(), "k", limit)
+	require.NoError(t, err)
+	c.advance(time.Hour)
+
+	d, err := l.Allow(context.Background(), "k", limit)
+	require.NoError(t, err)
+	assert.Equal(t, 1, d.Remaining)
+}
+
+func TestSlidingWindowLog(t *testing.T) {
+	c := newClock()
+	l := NewSlidingWindowLog(0)
+	l.now = c.now
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Window: 10 * time.Second}
+
+	d, err := l.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining)
+
+	c.advance(4 * time.Second)
+	d, err = l.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+	assert.Equal(t, c.t.Add(10*time.Second), d.ResetAt)
+
+	c.advance(4 * time.Second)
+	d, err = l.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, 2*time.Second, d.RetryAfter)
+
+	// The first request leaves the window.
+	c.advance(2 * time.Second)
+	d, err = l.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+}
+
+func TestLimiters_RejectInvalidLimit(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	for _, l := range []Limiter{NewTokenBucket(0), NewSlidingWindowLog(0), NewPostgresLimiter(db)} {
+		_, err := l.Allow(context.Background(), "k", Limit{Requests: 0, Window: time.Second})
+		assert.ErrorIs(t, err, ErrInvalidLimit)
+
+		_, err = l.Allow(context.Background(), "k", Limit{Requests: 1})
+		assert.ErrorIs(t, err, ErrInvalidLimit)
+	}
+}
+
+func TestPostgresLimiter_SharesBucketsAcrossInstances(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:?cache=shared"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Migrator().DropTable(&BucketRow{}))
+	require.NoError(t, db.AutoMigrate(&BucketRow{}))
+
+	c := newClock()
+	first, second := NewPostgresLimiter(db), NewPostgresLimiter(db)
+	first.now, second.now = c.now, c.now
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Window: 2 * time.Second}
+
+	d, err := first.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 1, d.Remaining)
+
+	d, err = second.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	assert.Equal(t, 0, d.Remaining)
+
+	d, err = first.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+	assert.Equal(t, time.Second, d.RetryAfter)
+
+	c.advance(time.Second)
+	d, err = second.Allow(ctx, "k", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+}
+
+func TestPostgresLimiter_SweepDeletesIdleBuckets(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&BucketRow{}))
+
+	c := newClock()
+	l := NewPostgresLimiter(db)
+	l.now = c.now
+	ctx := context.Background()
+	limit := Limit{Requests: 1, Window: time.Minute}
+
+	_, err = l.Allow(ctx, "idle", limit)
+	require.NoError(t, err)
+	c.advance(30 * time.Second)
+	_, err = l.Allow(ctx, "active", limit)
+	require.NoError(t, err)
+
+	n, err := l.Sweep(ctx, c.t.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	c.advance(31 * time.Second)
+	n, err = l.Sweep(ctx, c.t.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	var keys []string
+	require.NoError(t, db.Model(&BucketRow{}).Pluck("bucket_key", &keys).Error)
+	assert.Equal(t, []string{"active"}, keys)
+
+	// A swept client starts again from a full bucket; the active one does not.
+	d, err := l.Allow(ctx, "idle", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+	d, err = l.Allow(ctx, "active", limit)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+}
+
+func TestTokenBucket_SweepForgetsFullBuckets(t *testing.T) {
+	c := newClock()
+	l := NewTokenBucket(0)
+	l.now = c.now
+	ctx := context.Background()
+
+	_, err := l.Allow(ctx, "slow", Limit{Requests: 1, Window: time.Minute})
+	require.NoError(t, err)
+	_, err = l.Allow(ctx, "fast", Limit{Requests: 1, Window: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, 2, l.Tracked())
+
+	assert.Equal(t, 0, l.Sweep(c.t.Add(500*time.Millisecond)))
+	assert.Equal(t, 1, l.Sweep(c.t.Add(time.Second)))
+	assert.Equal(t, 1, l.Tracked())
+	assert.Equal(t, 1, l.Sweep(c.t.Add(time.Minute)))
+	assert.Equal(t, 0, l.Tracked())
+}
+
+func TestTokenBucket_EvictsLeastRecentlyUsed(t *testing.T) {
+	c := newClock()
+	l := NewTokenBucket(2)
+	l.now = c.now
+	ctx := context.Background()
+	limit := Limit{Requests: 1, Window: time.Minute}
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		_, err := l.Allow(ctx, key, limit)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 2, l.Tracked())
+
+	// "b" was used least recently, so it was evicted and starts afresh;
+	// "a" is still limited.
+	d, err := l.Allow(ctx, "b", limit)
+	require.NoError(t, err)
+	assert.True(t, d.Allowed)
+
+	d, err = l.Allow(ctx, "c", limit)
+	require.NoError(t, err)
+	assert.False(t, d.Allowed)
+}
+
+func TestSlidingWindowLog_SweepAndCap(t *testing.T) {
+	c := newClock()
+	l := NewSlidingWindowLog(2)
+	l.now = c.now
+	ctx := context.Background()
+	limit := Limit{Requests: 2, Window: 10 * time.Second}
+
+	for _, key := range []string{"a", "b", "c"} {
+		_, err := l.Allow(ctx, key, limit)
+		require.NoError(t, err)
+		c.advance(time.Second)
+	}
+	assert.Equal(t, 2, l.Tracked())
+
+	// "b" leaves the window at +11s, "c" at +12s.
+	assert.Equal(t, 1, l.Sweep(c.t.Add(8*time.Second)))
+	assert.Equal(t, 1, l.Tracked())
+}
+
+func TestInMemoryLimiters_CountEvictions(t *testing.T) {
+	ctx := context.Background()
+	limit := Limit{Requests: 1, Window: time.Minute}
+
+	for name, l := range map[string]interface {
+		Limiter
+		Sweeper
+	}{
+		"token bucket":   NewTokenBucket(1),
+		"sliding window": NewSlidingWindowLog(1),
+	} {
+		before := testutil.ToFloat64(metrics.RateLimitEvictedClients)
+
+		for _, key := range []string{"a", "b", "c"} {
+			_, err := l.Allow(ctx, key, limit)
+			require.NoError(t, err, name)
+		}
+		assert.Equal(t, before+2, testutil.ToFloat64(metrics.RateLimitEvictedClients), name)
+
+		l.Sweep(time.Now().Add(time.Hour))
+		assert.Equal(t, before+3, testutil.ToFloat64(metrics.RateLimitEvictedClients), name)
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"container/list"
+	"time"
+)
+
+// Sweeper is implemented by limiters that keep per-client state in memory.
+// Sweep forgets clients whose state has expired by now, so that a limiter
+// only tracks recently active clients. Clients forgotten by sweeps or to stay
+// under the cap are counted in metrics.RateLimitEvictedClients.
+type Sweeper interface {
+	Sweep(now time.Time) (evicted int)
+	Tracked() int
+}
+
+// lru maps keys to values, evicting the least recently used key once more
+// than max keys are stored. A max of 0 means no limit.
+type lru[V any] struct {
+	max   int
+	order *list.List // of *lruEntry[V], most recently used first
+	items map[string]*list.Element
+}
+
+type lruEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newLRU[V any](max int) *lru[V] {
+	return &lru[V]{
+		max:   max,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// get returns the value of key and marks it as most recently used.
+func (c *lru[V]) get(key string) (V, bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*lruEntry[V]).value, true
+}
+
+// put stores value under key, marks it as most recently used and reports
+// whether another key was evicted to make room.
+func (c *lru[V]) put(key string, value V) (evicted bool) {
+	if elem, ok := c.items[key]; ok {
+		elem.Value.(*lruEntry[V]).value = value
+		c.order.MoveToFront(elem)
+		return false
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[V]{key: key, value: value})
+
+	if c.max > 0 && c.order.Len() > c.max {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry[V]).key)
+		return true
+	}
+	return false
+}
+
+// removeIf deletes every key whose value satisfies expired and returns how
+// many were deleted.
+func (c *lru[V]) removeIf(expired func(V) bool) int {
+	removed := 0
+	for elem := c.order.Front(); elem != nil; {
+		next := elem.Next()
+		if entry := elem.Value.(*lruEntry[V]); expired(entry.value) {
+			c.order.Remove(elem)
+			delete(c.items, entry.key)
+			removed++
+		}
+		elem = next
+	}
+	return removed
+}
+
+func (c *lru[V]) len() int {
+	return c.order.Len()
+}
@@ -0,0 +1,180 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client identities a policy can limit by.
+const (
+	ClientIP       = "ip"       // the client's IP address
+	ClientAPIKey   = "api_key"  // the authenticated API key
+	ClientCustomer = "customer" // the authenticated customer
+)
+
+// Policy assigns a limit to the requests it matches. A request matches if
+// its method is one of Methods and its route one of Routes (empty lists
+// match everything), and if it carries the identity named by Client.
+type Policy struct {
+	Name string `json:"name"`
+
+	// Methods are HTTP methods such as "GET".
+	Methods []string `json:"methods,omitempty"`
+	// Routes are route patterns such as "/orders/{id}". A pattern ending in
+	// "*" matches every route with that prefix.
+	Routes []string `json:"routes,omitempty"`
+	// Client is ClientIP (the default), ClientAPIKey or ClientCustomer.
+	// Requests are counted per distinct value of that identity.
+	Client string `json:"client,omitempty"`
+
+	Requests   int  `json:"requests,omitempty"`
+	WindowSecs int  `json:"window_seconds,omitempty"`
+	Exempt     bool `json:"exempt,omitempty"` // matching requests are not limited
+}
+
+// Limit returns the policy's limit.
+func (p Policy) Limit() Limit {
+	return Limit{Requests: p.Requests, Window: time.Duration(p.WindowSecs) * time.Second}
+}
+
+// Request describes a request for policy resolution.
+type Request struct {
+	Method     string
+	Route      string // the matched route pattern, or "" if none matched
+	IP         string
+	APIKey     string // identifies the authenticated API key, if any
+	CustomerID int64  // the authenticated customer, if any
+}
+
+// Policies is an ordered policy table; the first matching policy applies.
+type Policies []Policy
+
+// ParsePolicies reads a JSON array of policies and validates it.
+func ParsePolicies(data []byte) (Policies, error) {
+	var ps Policies
+	if err := json.Unmarshal(data, &ps); err != nil {
+		return nil, fmt.Errorf("parse rate limit policies: %w", err)
+	}
+	if err := ps.Validate(); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+// Validate checks that every policy is named, limits a known client
+// identity and, unless exempt, has a positive limit.
+func (ps Policies) Validate() error {
+	seen := make(map[string]bool, len(ps))
+
+	for i, p := range ps {
+		if p.Name == "" {
+			return fmt.Errorf("rate limit policy %d: name is required", i)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("rate limit policy %q: duplicate name", p.Name)
+		}
+		seen[p.Name] = true
+
+		switch p.Client {
+		case "", ClientIP, ClientAPIKey, ClientCustomer:
+		default:
+			return fmt.Errorf("rate limit policy %q: unknown client %q", p.Name, p.Client)
+		}
+
+		if !p.Exempt {
+			if err := p.Limit().validate(); err != nil {
+				return fmt.Errorf("rate limit policy %q: %w", p.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Resolve returns the first policy matching req and the key under which req
+// is counted. ok is false if no policy matches.
+func (ps Policies) Resolve(req Request) (policy Policy, key string, ok bool) {
+	for _, p := range ps {
+		if !p.matchesMethod(req.Method) || !p.matchesRoute(req.Route) {
+			continue
+		}
+
+		var id string
+		switch p.Client {
+		case ClientAPIKey:
+			id = req.APIKey
+		case ClientCustomer:
+			if req.CustomerID > 0 {
+				id = strconv.FormatInt(req.CustomerID, 10)
+			}
+		default:
+			id = req.IP
+		}
+		if id == "" {
+			continue
+		}
+
+		client := p.Client
+		if client == "" {
+			client = ClientIP
+		}
+
+		return p, p.Name + ":" + client + ":" + id, true
+	}
+
+	return Policy{}, "", false
+}
+
+// MaxWindow returns the longest window of the policies that are not exempt.
+// After that long without requests every bucket has refilled completely.
+func (ps Policies) MaxWindow() time.Duration {
+	var longest time.Duration
+	for _, p := range ps {
+		if w := p.Limit().Window; !p.Exempt && w > longest {
+			longest = w
+		}
+	}
+	return longest
+}
+
+func (p Policy) matchesMethod(method string) bool {
+	if len(p.Methods) == 0 {
+		return true
+	}
+	for _, m := range p.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) matchesRoute(route string) bool {
+	if len(p.Routes) == 0 {
+		return true
+	}
+	for _, pattern := range p.Routes {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(route, prefix) {
+				return true
+			}
+		} else if route == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultPolicies returns the policies that follow any configured ones:
+// health checks are exempt, and everything else is limited per IP to
+// requests per windowSecs.
+func DefaultPolicies(requests, windowSecs int) Policies {
+	return Policies{
+		{Name: "health", Methods: []string{http.MethodGet, http.MethodHead}, Routes: []string{"/", "/healthz", "/readyz"}, Exempt: true},
+		{Name: "default", Client: ClientIP, Requests: requests, WindowSecs: windowSecs},
+	}
+}
@@ -0,0 +1,78 @@
+package ratelimit
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicies(t *testing.T) {
+	ps, err := ParsePolicies([]byte(`[
+		{"name": "reads", "methods": ["GET"], "routes": ["/orders/*"], "requests": 100, "window_seconds": 60},
+		{"name": "probes", "routes": ["/healthz"], "exempt": true}
+	]`))
+	require.NoError(t, err)
+	require.Len(t, ps, 2)
+	assert.Equal(t, Limit{Requests: 100, Window: time.Minute}, ps[0].Limit())
+	assert.True(t, ps[1].Exempt)
+}
+
+func TestParsePolicies_Invalid(t *testing.T) {
+	for name, data := range map[string]string{
+		"not json":       `{`,
+		"missing name":   `[{"requests": 1, "window_seconds": 1}]`,
+		"duplicate name": `[{"name": "a", "requests": 1, "window_seconds": 1}, {"name": "a", "requests": 1, "window_seconds": 1}]`,
+		"unknown client": `[{"name": "a", "client": "session", "requests": 1, "window_seconds": 1}]`,
+		"missing limit":  `[{"name": "a"}]`,
+	} {
+		_, err := ParsePolicies([]byte(data))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestPolicies_Resolve(t *testing.T) {
+	ps := append(Policies{
+		{Name: "customers", Client: ClientCustomer, Routes: []string{"/orders/{id}"}, Requests: 5, WindowSecs: 1},
+		{Name: "writes", Methods: []string{"post", "PATCH"}, Routes: []string{"/orders*"}, Requests: 2, WindowSecs: 1},
+	}, DefaultPolicies(10, 60)...)
+
+	tests := []struct {
+		name   string
+		req    Request
+		policy string
+		key    string
+	}{
+		{"customer on matching route", Request{Method: "GET", Route: "/orders/{id}", IP: "1.1.1.1", CustomerID: 42}, "customers", "customers:customer:42"},
+		{"anonymous falls through", Request{Method: "GET", Route: "/orders/{id}", IP: "1.1.1.1"}, "default", "default:ip:1.1.1.1"},
+		{"method is case-insensitive", Request{Method: "POST", Route: "/orders/", IP: "1.1.1.1"}, "writes", "writes:ip:1.1.1.1"},
+		{"health check", Request{Method: "GET", Route: "/", IP: "1.1.1.1"}, "health", "health:ip:1.1.1.1"},
+		{"readiness probe", Request{Method: "GET", Route: "/readyz", IP: "1.1.1.1"}, "health", "health:ip:1.1.1.1"},
+		{"unmatched route", Request{Method: "DELETE", Route: "", IP: "1.1.1.1"}, "default", "default:ip:1.1.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, key, ok := ps.Resolve(tt.req)
+			require.True(t, ok)
+			assert.Equal(t, tt.policy, p.Name)
+			assert.Equal(t, tt.key, key)
+		})
+	}
+
+	_, _, ok := Policies{{Name: "keys", Client: ClientAPIKey, Requests: 1, WindowSecs: 1}}.Resolve(Request{IP: "1.1.1.1"})
+	assert.False(t, ok)
+}
+
+func TestPolicies_MaxWindow(t *testing.T) {
+	ps := append(Policies{
+		{Name: "writes", Methods: []string{http.MethodPost}, Requests: 5, WindowSecs: 600},
+		{Name: "internal", Routes: []string{"/internal/*"}, Exempt: true, WindowSecs: 3600},
+	}, DefaultPolicies(10, 60)...)
+
+	assert.Equal(t, 10*time.Minute, ps.MaxWindow())
+	assert.Equal(t, time.Minute, DefaultPolicies(10, 60).MaxWindow())
+	assert.Zero(t, Policies{}.MaxWindow())
+}
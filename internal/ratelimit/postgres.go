@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// BucketRow is a token bucket stored in the rate_limit_buckets table.
+type BucketRow struct {
+	Key       string    `gorm:"primaryKey;column:bucket_key;type:varchar(255)"`
+	Tokens    float64   `gorm:"not null"`
+	UpdatedAt time.Time `gorm:"not null;autoUpdateTime:false"`
+}
+
+func (BucketRow) TableName() string {
+	return "rate_limit_buckets"
+}
+
+// PostgresLimiter is a token bucket limiter whose buckets live in the
+// database, so every replica of the service shares the same limits. Each
+// bucket row is locked while a request is counted against it. Idle buckets
+// stay in the table until Sweep removes them.
+type PostgresLimiter struct {
+	DB  *gorm.DB
+	now func() time.Time
+}
+
+func NewPostgresLimiter(db *gorm.DB) *PostgresLimiter {
+	return &PostgresLimiter{DB: db, now: time.Now}
+}
+
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, limit Limit) (Decision, error) {
+	if err := limit.validate(); err != nil {
+		return Decision{}, fmt.Errorf("postgres bucket %q: %w", key, err)
+	}
+
+	now := l.now().UTC()
+
+	var d Decision
+	err := l.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Updating the existing row, rather than doing nothing, locks it
+		// before a concurrent Sweep can delete it.
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "bucket_key"}},
+			DoUpdates: clause.Assignments(map[string]any{"bucket_key": gorm.Expr("excluded.bucket_key")}),
+		}).Create(&BucketRow{Key: key, Tokens: float64(limit.Requests), UpdatedAt: now}).Error; err != nil {
+			return err
+		}
+
+		var row BucketRow
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("bucket_key = ?", key).
+			First(&row).Error; err != nil {
+			return err
+		}
+
+		var b bucket
+		b, d = bucket{tokens: row.Tokens, updated: row.UpdatedAt}.take(limit, now)
+
+		return tx.Model(&BucketRow{}).
+			Where("bucket_key = ?", key).
+			Updates(map[string]any{"tokens": b.tokens, "updated_at": b.updated}).Error
+	})
+	if err != nil {
+		return Decision{}, fmt.Errorf("postgres bucket %q: %w", key, err)
+	}
+
+	return d, nil
+}
+
+// Sweep deletes the buckets last used before olderThan and returns how many
+// it deleted. A bucket idle for a whole window has refilled completely, so
+// with olderThan at least the longest window in use ago no client loses
+// anything: its next request starts from a full bucket either way.
+func (l *PostgresLimiter) Sweep(ctx context.Context, olderThan time.Time) (int64, error) {
+	result := l.DB.WithContext(ctx).
+		Where("updated_at < ?", olderThan.UTC()).
+		Delete(&BucketRow{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("sweep postgres buckets: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
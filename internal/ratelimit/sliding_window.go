@@ -0,0 +1,96 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+)
+
+// SlidingWindowLog is an in-memory limiter that remembers the time of each
+// allowed request and permits a new one only while fewer than limit.Requests
+// fall within the last limit.Window. It is exact, at the cost of keeping up
+// to limit.Requests timestamps per key.
+//
+// At most maxKeys logs are kept; beyond that the least recently used one is
+// dropped, which resets that client's quota. Logs whose requests have all
+// left the window are removed by Sweep.
+type SlidingWindowLog struct {
+	mu   sync.Mutex
+	logs *lru[windowLog]
+	now  func() time.Time
+}
+
+type windowLog struct {
+	entries []time.Time // allowed requests within the window, oldest first
+	resetAt time.Time   // when the newest entry leaves the window
+}
+
+// NewSlidingWindowLog returns a SlidingWindowLog tracking at most maxKeys
+// clients, or any number if maxKeys is 0.
+func NewSlidingWindowLog(maxKeys int) *SlidingWindowLog {
+	return &SlidingWindowLog{
+		logs: newLRU[windowLog](maxKeys),
+		now:  time.Now,
+	}
+}
+
+func (l *SlidingWindowLog) Allow(_ context.Context, key string, limit Limit) (Decision, error) {
+	if err := limit.validate(); err != nil {
+		return Decision{}, fmt.Errorf("sliding window %q: %w", key, err)
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Drop requests that have left the window.
+	wl, _ := l.logs.get(key)
+	entries := wl.entries
+	start := 0
+	for start < len(entries) && !entries[start].Add(limit.Window).After(now) {
+		start++
+	}
+	entries = entries[start:]
+
+	d := Decision{Limit: limit.Requests}
+	if len(entries) < limit.Requests {
+		entries = append(entries, now)
+		d.Allowed = true
+	} else {
+		// The request that must expire before another fits.
+		d.RetryAfter = entries[len(entries)-limit.Requests].Add(limit.Window).Sub(now)
+	}
+
+	d.Remaining = max(0, limit.Requests-len(entries))
+	d.ResetAt = entries[len(entries)-1].Add(limit.Window)
+
+	if l.logs.put(key, windowLog{entries: entries, resetAt: d.ResetAt}) {
+		metrics.RateLimitEvictedClients.Inc()
+	}
+
+	return d, nil
+}
+
+// Sweep removes the logs whose requests have all left the window by now.
+func (l *SlidingWindowLog) Sweep(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	evicted := l.logs.removeIf(func(w windowLog) bool {
+		return !now.Before(w.resetAt)
+	})
+	metrics.RateLimitEvictedClients.Add(float64(evicted))
+	return evicted
+}
+
+// Tracked returns the number of clients with a log.
+func (l *SlidingWindowLog) Tracked() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.logs.len()
+}
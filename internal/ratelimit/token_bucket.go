@@ -0,0 +1,115 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+)
+
+// bucket is the state of a token bucket: tokens left as of updated.
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// take refills b for the time elapsed since it was last updated and takes a
+// token from it if one is left. A zero bucket starts full.
+func (b bucket) take(limit Limit, now time.Time) (bucket, Decision) {
+	capacity := float64(limit.Requests)
+	rate := limit.perSecond()
+
+	switch {
+	case b.updated.IsZero():
+		b.tokens = capacity
+	case now.After(b.updated):
+		b.tokens = math.Min(capacity, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	}
+	if now.After(b.updated) {
+		b.updated = now
+	}
+
+	d := Decision{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		d.Allowed = true
+	} else {
+		d.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	d.Remaining = int(b.tokens)
+	d.ResetAt = now.Add(seconds((capacity - b.tokens) / rate))
+
+	return b, d
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
+
+// TokenBucket is an in-memory token bucket limiter. Each key has a bucket
+// holding up to limit.Requests tokens that refills evenly over limit.Window,
+// so short bursts are allowed while the long-run rate stays bounded.
+//
+// At most maxKeys buckets are kept; beyond that the least recently used one
+// is dropped, which resets that client's quota. Buckets that have refilled
+// completely carry no information and are removed by Sweep.
+type TokenBucket struct {
+	mu      sync.Mutex
+	buckets *lru[tokenBucketEntry]
+	now     func() time.Time
+}
+
+type tokenBucketEntry struct {
+	bucket
+	fullAt time.Time // when the bucket will have refilled completely
+}
+
+// NewTokenBucket returns a TokenBucket tracking at most maxKeys clients, or
+// any number if maxKeys is 0.
+func NewTokenBucket(maxKeys int) *TokenBucket {
+	return &TokenBucket{
+		buckets: newLRU[tokenBucketEntry](maxKeys),
+		now:     time.Now,
+	}
+}
+
+func (l *TokenBucket) Allow(_ context.Context, key string, limit Limit) (Decision, error) {
+	if err := limit.validate(); err != nil {
+		return Decision{}, fmt.Errorf("token bucket %q: %w", key, err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entry, _ := l.buckets.get(key)
+	b, d := entry.take(limit, l.now())
+	if l.buckets.put(key, tokenBucketEntry{bucket: b, fullAt: d.ResetAt}) {
+		metrics.RateLimitEvictedClients.Inc()
+	}
+
+	return d, nil
+}
+
+// Sweep removes the buckets that are full again by now.
+func (l *TokenBucket) Sweep(now time.Time) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	evicted := l.buckets.removeIf(func(e tokenBucketEntry) bool {
+		return !now.Before(e.fullAt)
+	})
+	metrics.RateLimitEvictedClients.Add(float64(evicted))
+	return evicted
+}
+
+// Tracked returns the number of clients with a bucket.
+func (l *TokenBucket) Tracked() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.buckets.len()
+}
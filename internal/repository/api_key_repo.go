@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"gorm.io/gorm"
+)
+
+const keyIDColumn = "key_id"
+
+// APIKeyRepo stores API keys.
+type APIKeyRepo struct {
+	DB *gorm.DB
+}
+
+func NewAPIKeyRepo(db *gorm.DB) *APIKeyRepo {
+	return &APIKeyRepo{DB: db}
+}
+
+// Create stores a new API key. It needs a name, a secret hash and at least
+// one scope, all of them known.
+func (r *APIKeyRepo) Create(ctx context.Context, key *model.APIKey) error {
+	if key == nil {
+		return fmt.Errorf("API key is nil: %w", ErrInvalidInput)
+	}
+	if key.KeyID == "" || key.SecretHash == "" {
+		return fmt.Errorf("API key ID and secret hash are required: %w", ErrInvalidInput)
+	}
+	if strings.TrimSpace(key.Name) == "" {
+		return fmt.Errorf("API key name is required: %w", ErrInvalidInput)
+	}
+	if len(key.Scopes) == 0 {
+		return fmt.Errorf("API key needs at least one scope: %w", ErrInvalidInput)
+	}
+	for _, s := range key.Scopes {
+		if !s.Valid() {
+			return fmt.Errorf("unknown scope %q: %w", s, ErrInvalidInput)
+		}
+	}
+
+	if key.CreatedAt.IsZero() {
+		key.CreatedAt = time.Now().UTC()
+	}
+
+	if err := r.DB.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("insert API key: %w", err)
+	}
+	return nil
+}
+
+// FindAPIKey returns the API key with the given ID, revoked or not.
+func (r *APIKeyRepo) FindAPIKey(ctx context.Context, keyID string) (model.APIKey, error) {
+	var key model.APIKey
+	err := r.DB.WithContext(ctx).Where(keyIDColumn+" = ?", keyID).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.APIKey{}, fmt.Errorf("API key %s: %w", keyID, ErrAPIKeyNotExist)
+		}
+		return model.APIKey{}, fmt.Errorf("find API key %s: %w", keyID, err)
+	}
+	return key, nil
+}
+
+// List returns all API keys, oldest first.
+func (r *APIKeyRepo) List(ctx context.Context) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	if err := r.DB.WithContext(ctx).Order("created_at, " + keyIDColumn).Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("list API keys: %w", err)
+	}
+	return keys, nil
+}
+
+// Revoke marks an API key as revoked at the given time. Revoking a key twice
+// keeps the first revocation time.
+func (r *APIKeyRepo) Revoke(ctx context.Context, keyID string, at time.Time) error {
+	result := r.DB.WithContext(ctx).
+		Model(&model.APIKey{}).
+		Where(keyIDColumn+" = ? AND revoked_at IS NULL", keyID).
+		Update("revoked_at", at)
+	if result.Error != nil {
+		return fmt.Errorf("revoke API key %s: %w", keyID, result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		if _, err := r.FindAPIKey(ctx, keyID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeys_CreateFindRevoke(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Where("1 = 1").Delete(&model.APIKey{}).Error)
+	repo := NewAPIKeyRepo(db)
+	ctx := context.Background()
+
+	key := &model.APIKey{
+		KeyID:      "0123456789abcdef",
+		Name:       "warehouse",
+		SecretHash: "hash",
+		Scopes:     model.Scopes{model.ScopeOrdersRead, model.ScopeOrdersWrite},
+	}
+	require.NoError(t, repo.Create(ctx, key))
+
+	found, err := repo.FindAPIKey(ctx, key.KeyID)
+	require.NoError(t, err)
+	assert.Equal(t, "warehouse", found.Name)
+	assert.Equal(t, key.Scopes, found.Scopes)
+	assert.False(t, found.Revoked())
+
+	revokedAt := time.Now().UTC()
+	require.NoError(t, repo.Revoke(ctx, key.KeyID, revokedAt))
+	require.NoError(t, repo.Revoke(ctx, key.KeyID, revokedAt.Add(time.Hour)))
+
+	found, err = repo.FindAPIKey(ctx, key.KeyID)
+	require.NoError(t, err)
+	require.True(t, found.Revoked())
+	assert.WithinDuration(t, revokedAt, *found.RevokedAt, time.Second)
+
+	keys, err := repo.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, keys, 1)
+}
+
+func TestAPIKeys_NotFound(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAPIKeyRepo(db)
+
+	_, err := repo.FindAPIKey(context.Background(), "missing")
+	assert.ErrorIs(t, err, ErrAPIKeyNotExist)
+
+	err = repo.Revoke(context.Background(), "missing", time.Now())
+	assert.ErrorIs(t, err, ErrAPIKeyNotExist)
+}
+
+func TestAPIKeys_Create_RejectsInvalid(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewAPIKeyRepo(db)
+
+	for name, key := range map[string]*model.APIKey{
+		"nil":           nil,
+		"no name":       {KeyID: "a", SecretHash: "h", Scopes: model.Scopes{model.ScopeOrdersRead}},
+		"no scopes":     {KeyID: "a", SecretHash: "h", Name: "n"},
+		"unknown scope": {KeyID: "a", SecretHash: "h", Name: "n", Scopes: model.Scopes{"orders:admin"}},
+		"no hash":       {KeyID: "a", Name: "n", Scopes: model.Scopes{model.ScopeOrdersRead}},
+	} {
+		err := repo.Create(context.Background(), key)
+		assert.ErrorIs(t, err, ErrInvalidInput, name)
+	}
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCursorCodec_RoundTrip(t *testing.T) {
+	codec := NewCursorCodec([]byte("secret"))
+	created := time.Date(2025, 3, 4, 5, 6, 7, 8, time.UTC)
+
+	token, err := codec.Encode(Cursor{Sort: "created_at,order_id", OrderID: 42, CreatedAt: &created})
+	require.NoError(t, err)
+
+	cur, err := codec.Decode(token)
+	require.NoError(t, err)
+	assert.Equal(t, "created_at,order_id", cur.Sort)
+	assert.Equal(t, int64(42), cur.OrderID)
+	require.NotNil(t, cur.CreatedAt)
+	assert.True(t, created.Equal(*cur.CreatedAt))
+}
+
+func TestCursorCodec_RejectsTamperedPayload(t *testing.T) {
+	codec := NewCursorCodec([]byte("secret"))
+
+	token, err := codec.Encode(Cursor{Sort: "order_id", OrderID: 1})
+	require.NoError(t, err)
+
+	forged, err := NewCursorCodec([]byte("other")).Encode(Cursor{Sort: "order_id", OrderID: 1000})
+	require.NoError(t, err)
+
+	payload, _, _ := strings.Cut(forged, ".")
+	_, sig, _ := strings.Cut(token, ".")
+
+	_, err = codec.Decode(payload + "." + sig)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursorCodec_RejectsForeignKey(t *testing.T) {
+	token, err := NewCursorCodec([]byte("a")).Encode(Cursor{Sort: "order_id", OrderID: 1})
+	require.NoError(t, err)
+
+	_, err = NewCursorCodec([]byte("b")).Decode(token)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestCursorCodec_RejectsMalformed(t *testing.T) {
+	codec := NewCursorCodec(nil)
+
+	for _, token := range []string{"3", "abc", "!!.!!", "e30.%%"} {
+		_, err := codec.Decode(token)
+		assert.ErrorIs(t, err, ErrInvalidCursor, token)
+	}
+}
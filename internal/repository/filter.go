@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+// apply adds the filter's conditions to query.
+func (f Filter) apply(query *gorm.DB) *gorm.DB {
+	if f.IncludeDeleted {
+		query = query.Unscoped()
+	}
+
+	if f.CustomerID > 0 {
+		query = query.Where(customerIDColumn+" = ?", f.CustomerID)
+	}
+
+	if f.Status != "" {
+		query = query.Where(statusColumn+" = ?", f.Status)
+	}
+
+	if f.CreatedFrom != nil {
+		query = query.Where(createdAtColumn+" >= ?", f.CreatedFrom.UTC())
+	}
+	if f.CreatedTo != nil {
+		query = query.Where(createdAtColumn+" < ?", f.CreatedTo.UTC())
+	}
+	if f.ShippedFrom != nil {
+		query = query.Where(shippedAtColumn+" >= ?", f.ShippedFrom.UTC())
+	}
+	if f.ShippedTo != nil {
+		query = query.Where(shippedAtColumn+" < ?", f.ShippedTo.UTC())
+	}
+
+	if f.MinTotal != nil {
+		query = query.Where(grandTotalColumn+" >= ?", *f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		query = query.Where(grandTotalColumn+" <= ?", *f.MaxTotal)
+	}
+
+	return query
+}
@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// Actor identifies who makes the order changes of a context. It is recorded
+// with each change in the order history.
+type Actor struct {
+	Name      string // the caller, such as "api_key:3f9c0a1b2d4e5f60"
+	RequestID string // the request that made the change
+}
+
+type actorContextKey struct{}
+
+// WithActor returns a copy of ctx whose order changes are attributed to a.
+func WithActor(ctx context.Context, a Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, a)
+}
+
+// ActorFrom returns the actor stored in ctx by WithActor.
+func ActorFrom(ctx context.Context) Actor {
+	a, _ := ctx.Value(actorContextKey{}).(Actor)
+	return a
+}
+
+// History returns a page of the history of an order, oldest first. The
+// history outlives the order, so it can be read after the order has been
+// deleted. Orders without history that are not stored within the scope of
+// ctx are reported as not existing.
+func (r *OrderRepo) History(ctx context.Context, orderID int64, page HistoryPage) (HistoryResult, error) {
+	if err := validateID(orderID); err != nil {
+		return HistoryResult{}, err
+	}
+	if page.Size < 0 || page.After < 0 {
+		return HistoryResult{}, fmt.Errorf("invalid history page %+v: %w", page, ErrInvalidInput)
+	}
+
+	query := ScopeFrom(ctx).apply(r.DB.WithContext(ctx)).
+		Where(orderIDColumn+" = ? AND id > ?", orderID, page.After).
+		Order("id")
+
+	// Fetch one extra row to learn whether another page exists.
+	if page.Size > 0 {
+		query = query.Limit(int(page.Size) + 1)
+	}
+
+	var entries []model.OrderHistory
+	if err := query.Find(&entries).Error; err != nil {
+		return HistoryResult{}, fmt.Errorf("find history of order %d: %w", orderID, err)
+	}
+
+	// Orders created before the history was recorded have none, and the
+	// order of a page past the last entry may have been deleted since.
+	if len(entries) == 0 && !r.exists(ctx, orderID) && !r.hasHistory(ctx, orderID) {
+		return HistoryResult{}, fmt.Errorf("order %d: %w", orderID, ErrNotExist)
+	}
+
+	var next int64
+	if page.Size > 0 && int64(len(entries)) > page.Size {
+		entries = entries[:page.Size]
+		next = entries[len(entries)-1].ID
+	}
+
+	return HistoryResult{Entries: entries, Next: next}, nil
+}
+
+// hasHistory reports whether the history of order id has entries within
+// the scope of ctx.
+func (r *OrderRepo) hasHistory(ctx context.Context, id int64) bool {
+	var count int64
+	ScopeFrom(ctx).apply(r.DB.WithContext(ctx)).
+		Model(&model.OrderHistory{}).
+		Where(orderIDColumn+" = ?", id).
+		Count(&count)
+	return count > 0
+}
+
+// recordHistory writes the change of an order from before to after to the
+// order history, attributed to the actor of tx's context. before is nil for
+// a created order and after for a deleted one. It must run in the
+// transaction that made the change.
+func recordHistory(tx *gorm.DB, operation string, before, after *model.Order) error {
+	order := after
+	if order == nil {
+		order = before
+	}
+
+	changes, err := diffOrders(before, after)
+	if err != nil {
+		return fmt.Errorf("diff order %d: %w", order.OrderID, err)
+	}
+
+	actor := ActorFrom(tx.Statement.Context)
+	entry := model.OrderHistory{
+		OrderID:    order.OrderID,
+		CustomerID: order.CustomerID,
+		Operation:  operation,
+		Actor:      actor.Name,
+		RequestID:  actor.RequestID,
+		Changes:    changes,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return fmt.Errorf("record %s of order %d: %w", operation, order.OrderID, err)
+	}
+	return nil
+}
+
+// recordUpdate reads the order before describes as tx now sees it, and
+// records its change from before in the order history and as an event of
+// the given type.
+func recordUpdate(tx *gorm.DB, eventType string, before *model.Order) error {
+	after, err := loadOrder(tx, before.OrderID)
+	if err != nil {
+		return fmt.Errorf("load order %d for %s event: %w", before.OrderID, eventType, err)
+	}
+	if err := recordHistory(tx, model.OperationUpdate, before, &after); err != nil {
+		return err
+	}
+	return recordEvent(tx, eventType, &after)
+}
+
+// diffOrders returns the fields, by JSON name, whose values differ between
+// before and after. A nil order has no fields.
+func diffOrders(before, after *model.Order) (model.Changes, error) {
+	from, err := orderFields(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := orderFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := model.Changes{}
+	for name, v := range from {
+		if w := to[name]; !bytes.Equal(v, w) {
+			changes[name] = model.FieldChange{From: v, To: w}
+		}
+	}
+	for name, w := range to {
+		if _, ok := from[name]; !ok {
+			changes[name] = model.FieldChange{To: w}
+		}
+	}
+	return changes, nil
+}
+
+// orderFields returns the JSON encoding of each field of o.
+func orderFields(o *model.Order) (map[string]json.RawMessage, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(o)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// loadOrder reads order id, with its line items, as tx sees it.
+func loadOrder(tx *gorm.DB, id int64) (model.Order, error) {
+	var order model.Order
+	err := tx.Preload("LineItems", orderLineItems).
+		Where(orderIDColumn+" = ?", id).
+		First(&order).Error
+	return order, err
+}
+
+// orderLineItems sorts preloaded line items, so that loading an order twice
+// lists its items alike.
+func orderLineItems(db *gorm.DB) *gorm.DB {
+	return db.Order(itemIDColumn)
+}
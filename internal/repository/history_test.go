@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func history(t *testing.T, repo OrderRepository, ctx context.Context, orderID int64) []model.OrderHistory {
+	t.Helper()
+
+	res, err := repo.History(ctx, orderID, HistoryPage{})
+	require.NoError(t, err)
+	return res.Entries
+}
+
+func operations(entries []model.OrderHistory) []string {
+	ops := make([]string, len(entries))
+	for i, e := range entries {
+		ops[i] = e.Operation
+	}
+	return ops
+}
+
+func TestHistory_RecordsEveryChange(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := WithActor(staffCtx, Actor{Name: "api_key:abc", RequestID: "req-1"})
+
+	o := &model.Order{CustomerID: 7, Currency: "EUR"}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	item := &model.LineItem{OrderID: o.OrderID, SKU: "A", Quantity: 2, Price: 500}
+	_, err := repo.InsertLineItem(ctx, item, 0)
+	require.NoError(t, err)
+
+	o.Version = 2
+	o.Status = model.StatusPaid
+	require.NoError(t, repo.UpdateByID(ctx, o))
+
+	require.NoError(t, repo.DeleteByID(ctx, o.OrderID, 0))
+
+	entries := history(t, repo, ctx, o.OrderID)
+	assert.Equal(t, []string{"create", "update", "update", "delete"}, operations(entries))
+	for _, e := range entries {
+		assert.Equal(t, o.OrderID, e.OrderID)
+		assert.Equal(t, "api_key:abc", e.Actor)
+		assert.Equal(t, "req-1", e.RequestID)
+		assert.False(t, e.CreatedAt.IsZero())
+	}
+
+	created := entries[0].Changes
+	assert.JSONEq(t, `"pending"`, string(created["status"].To))
+	assert.Nil(t, created["status"].From)
+
+	added := entries[1].Changes
+	assert.Contains(t, added, "line_items")
+	assert.JSONEq(t, `0`, string(added["grand_total"].From))
+	assert.JSONEq(t, `1000`, string(added["grand_total"].To))
+	assert.NotContains(t, added, "status")
+
+	paid := entries[2].Changes
+	assert.JSONEq(t, `"pending"`, string(paid["status"].From))
+	assert.JSONEq(t, `"paid"`, string(paid["status"].To))
+	assert.JSONEq(t, `2`, string(paid["version"].From))
+	assert.JSONEq(t, `3`, string(paid["version"].To))
+	assert.NotContains(t, paid, "line_items")
+	assert.NotContains(t, paid, "customer_id")
+
+	deleted := entries[3].Changes
+	assert.JSONEq(t, `"paid"`, string(deleted["status"].From))
+	assert.Nil(t, deleted["status"].To)
+}
+
+func TestHistory_NotRecordedWhenChangeFails(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 7}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	o.Status = model.StatusShipped
+	assert.ErrorIs(t, repo.UpdateByID(ctx, o), orderstate.ErrInvalidTransition)
+
+	o.Status = model.StatusPaid
+	o.Version = 5
+	assert.ErrorIs(t, repo.UpdateByID(ctx, o), ErrVersionConflict)
+
+	entries := history(t, repo, ctx, o.OrderID)
+	assert.Equal(t, []string{"create"}, operations(entries))
+	assert.Empty(t, entries[0].Actor)
+}
+
+func TestHistory_Pages(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 7, Currency: "EUR"}
+	require.NoError(t, repo.Insert(ctx, o))
+	for _, sku := range []string{"A", "B", "C", "D"} {
+		_, err := repo.InsertLineItem(ctx, &model.LineItem{OrderID: o.OrderID, SKU: sku, Quantity: 1, Price: 100}, 0)
+		require.NoError(t, err)
+	}
+
+	var all []model.OrderHistory
+	page := HistoryPage{Size: 2}
+	for {
+		res, err := repo.History(ctx, o.OrderID, page)
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(res.Entries), 2)
+		all = append(all, res.Entries...)
+		if res.Next == 0 {
+			break
+		}
+		page.After = res.Next
+	}
+	assert.Equal(t, history(t, repo, ctx, o.OrderID), all)
+	assert.Len(t, all, 5)
+
+	_, err := repo.History(ctx, o.OrderID, HistoryPage{Size: -1})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestHistory_OutlivesOrderAndHonoursScope(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 7}
+	require.NoError(t, repo.Insert(ctx, o))
+	require.NoError(t, repo.DeleteByID(ctx, o.OrderID, 0))
+
+	mine := WithScope(ctx, Scope{CustomerID: 7})
+	assert.Len(t, history(t, repo, mine, o.OrderID), 2)
+
+	others := WithScope(ctx, Scope{CustomerID: 8})
+	_, err := repo.History(others, o.OrderID, HistoryPage{})
+	assert.ErrorIs(t, err, ErrNotExist)
+	_, err = repo.History(others, o.OrderID, HistoryPage{After: 1})
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	_, err = repo.History(ctx, o.OrderID+1, HistoryPage{})
+	assert.ErrorIs(t, err, ErrNotExist)
+}
+
+func TestHistory_OrderWithoutHistory(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	// An order stored before the history was recorded.
+	o := &model.Order{CustomerID: 7}
+	require.NoError(t, repo.Insert(ctx, o))
+	require.NoError(t, db.Where("1 = 1").Delete(&model.OrderHistory{}).Error)
+
+	assert.Empty(t, history(t, repo, ctx, o.OrderID))
+}
+
+func TestDiffOrders(t *testing.T) {
+	before := &model.Order{OrderID: 1, Status: model.StatusPending, Version: 1}
+	after := &model.Order{OrderID: 1, Status: model.StatusCancelled, Version: 2, CancelNote: "duplicate"}
+
+	changes, err := diffOrders(before, after)
+	require.NoError(t, err)
+
+	b, err := json.Marshal(changes)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"status": {"from": "pending", "to": "cancelled"},
+		"version": {"from": 1, "to": 2},
+		"cancel_note": {"to": "duplicate"}
+	}`, string(b))
+
+	changes, err = diffOrders(before, before)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
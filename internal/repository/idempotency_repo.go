@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const idempotencyKeyColumn = "idempotency_key"
+
+// IdempotencyRepo stores idempotency keys and the responses they produced.
+type IdempotencyRepo struct {
+	DB *gorm.DB
+}
+
+func NewIdempotencyRepo(db *gorm.DB) *IdempotencyRepo {
+	return &IdempotencyRepo{DB: db}
+}
+
+// Reserve claims rec.Key for a new request. If the key is already held by an
+// unexpired record, that record is returned with reserved set to false.
+// An expired record is replaced.
+func (r *IdempotencyRepo) Reserve(ctx context.Context, rec model.IdempotencyKey) (existing model.IdempotencyKey, reserved bool, err error) {
+	db := r.DB.WithContext(ctx)
+
+	// Two attempts: the second runs after clearing an expired holder.
+	for attempt := 0; attempt < 2; attempt++ {
+		result := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&rec)
+		if result.Error != nil {
+			return model.IdempotencyKey{}, false, fmt.Errorf("reserve idempotency key: %w", result.Error)
+		}
+		if result.RowsAffected == 1 {
+			return rec, true, nil
+		}
+
+		if err := db.Where(idempotencyKeyColumn+" = ?", rec.Key).First(&existing).Error; err != nil {
+			return model.IdempotencyKey{}, false, fmt.Errorf("load idempotency key: %w", err)
+		}
+		if existing.ExpiresAt.After(rec.CreatedAt) {
+			return existing, false, nil
+		}
+
+		if err := db.Where(idempotencyKeyColumn+" = ? AND expires_at <= ?", rec.Key, rec.CreatedAt).
+			Delete(&model.IdempotencyKey{}).Error; err != nil {
+			return model.IdempotencyKey{}, false, fmt.Errorf("expire idempotency key: %w", err)
+		}
+	}
+
+	return existing, false, nil
+}
+
+// Complete stores the response produced for key.
+func (r *IdempotencyRepo) Complete(ctx context.Context, key string, status int, contentType, etag string, body []byte) error {
+	err := r.DB.WithContext(ctx).
+		Model(&model.IdempotencyKey{}).
+		Where(idempotencyKeyColumn+" = ?", key).
+		Updates(map[string]any{
+			"status_code":  status,
+			"content_type": contentType,
+			"etag":         etag,
+			"body":         body,
+		}).Error
+	if err != nil {
+		return fmt.Errorf("complete idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Release forgets key, so that the request can be retried.
+func (r *IdempotencyRepo) Release(ctx context.Context, key string) error {
+	if err := r.DB.WithContext(ctx).
+		Where(idempotencyKeyColumn+" = ?", key).
+		Delete(&model.IdempotencyKey{}).Error; err != nil {
+		return fmt.Errorf("release idempotency key: %w", err)
+	}
+	return nil
+}
+
+// Purge deletes keys that expired before now and returns how many were removed.
+func (r *IdempotencyRepo) Purge(ctx context.Context, now time.Time) (int64, error) {
+	result := r.DB.WithContext(ctx).
+		Where("expires_at <= ?", now).
+		Delete(&model.IdempotencyKey{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("purge idempotency keys: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIdempotencyKey(key string, now time.Time, ttl time.Duration) model.IdempotencyKey {
+	return model.IdempotencyKey{
+		Key:         key,
+		Method:      "POST",
+		Path:        "/orders",
+		RequestHash: "hash",
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(ttl),
+	}
+}
+
+func TestIdempotency_ReserveCompleteReplay(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewIdempotencyRepo(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	_, reserved, err := repo.Reserve(ctx, newIdempotencyKey("k1", now, time.Hour))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	existing, reserved, err := repo.Reserve(ctx, newIdempotencyKey("k1", now, time.Hour))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.True(t, existing.InFlight())
+
+	require.NoError(t, repo.Complete(ctx, "k1", 201, "application/json", `"1"`, []byte(`{"ok":true}`)))
+
+	existing, reserved, err = repo.Reserve(ctx, newIdempotencyKey("k1", now, time.Hour))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, 201, existing.StatusCode)
+	assert.Equal(t, "application/json", existing.ContentType)
+	assert.Equal(t, `"1"`, existing.ETag)
+	assert.Equal(t, []byte(`{"ok":true}`), existing.Body)
+}
+
+func TestIdempotency_ReserveReplacesExpired(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewIdempotencyRepo(db)
+	ctx := context.Background()
+	past := time.Now().UTC().Add(-2 * time.Hour)
+
+	_, reserved, err := repo.Reserve(ctx, newIdempotencyKey("k1", past, time.Hour))
+	require.NoError(t, err)
+	require.True(t, reserved)
+
+	_, reserved, err = repo.Reserve(ctx, newIdempotencyKey("k1", time.Now().UTC(), time.Hour))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+}
+
+func TestIdempotency_Release(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewIdempotencyRepo(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	_, _, err := repo.Reserve(ctx, newIdempotencyKey("k1", now, time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, repo.Release(ctx, "k1"))
+
+	_, reserved, err := repo.Reserve(ctx, newIdempotencyKey("k1", now, time.Hour))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+}
+
+func TestIdempotency_Purge(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewIdempotencyRepo(db)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	_, _, err := repo.Reserve(ctx, newIdempotencyKey("old", now.Add(-2*time.Hour), time.Hour))
+	require.NoError(t, err)
+	_, _, err = repo.Reserve(ctx, newIdempotencyKey("fresh", now, time.Hour))
+	require.NoError(t, err)
+
+	n, err := repo.Purge(ctx, now)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	var remaining []model.IdempotencyKey
+	require.NoError(t, db.Find(&remaining).Error)
+	require.Len(t, remaining, 1)
+	assert.Equal(t, "fresh", remaining[0].Key)
+}
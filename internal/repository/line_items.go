@@ -0,0 +1,248 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/pricing"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ListLineItems returns the line items of an order.
+func (r *OrderRepo) ListLineItems(ctx context.Context, orderID int64) ([]model.LineItem, error) {
+	if err := validateID(orderID); err != nil {
+		return nil, err
+	}
+
+	if !r.exists(ctx, orderID) {
+		return nil, fmt.Errorf("order %d: %w", orderID, ErrNotExist)
+	}
+
+	var items []model.LineItem
+	if err := r.DB.WithContext(ctx).
+		Where(orderIDColumn+" = ?", orderID).
+		Order(itemIDColumn + " ASC").
+		Find(&items).Error; err != nil {
+		return nil, fmt.Errorf("list line items of order %d: %w", orderID, err)
+	}
+
+	return items, nil
+}
+
+// InsertLineItem adds a line item to the order item.OrderID and returns the
+// order's new version. If version is non-zero the order must still have it;
+// otherwise ErrVersionConflict is returned.
+func (r *OrderRepo) InsertLineItem(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+	if err := validateLineItem(item); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := lockEditableOrder(tx, ScopeFrom(ctx), item.OrderID, version)
+		if err != nil {
+			return err
+		}
+		order := before
+		if err := matchOrderCurrency(tx, &order, item); err != nil {
+			return err
+		}
+
+		item.ItemID = 0
+		if err := tx.Create(item).Error; err != nil {
+			return fmt.Errorf("insert line item into order %d: %w", item.OrderID, err)
+		}
+
+		updated, err = recomputeTotals(tx, &before)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// UpdateLineItem replaces the line item identified by item.OrderID and
+// item.ItemID and returns the order's new version. version is checked as by
+// InsertLineItem.
+func (r *OrderRepo) UpdateLineItem(ctx context.Context, item *model.LineItem, version int64) (int64, error) {
+	if err := validateLineItem(item); err != nil {
+		return 0, err
+	}
+	if err := validateID(item.ItemID); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := lockEditableOrder(tx, ScopeFrom(ctx), item.OrderID, version)
+		if err != nil {
+			return err
+		}
+		order := before
+		if err := matchOrderCurrency(tx, &order, item); err != nil {
+			return err
+		}
+
+		result := tx.Model(&model.LineItem{}).
+			Where(itemIDColumn+" = ? AND "+orderIDColumn+" = ?", item.ItemID, item.OrderID).
+			Select("*").
+			Omit(itemIDColumn, orderIDColumn).
+			Updates(item)
+
+		if result.Error != nil {
+			return fmt.Errorf("update line item %d: %w", item.ItemID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("line item %d of order %d: %w", item.ItemID, item.OrderID, ErrLineItemNotExist)
+		}
+
+		updated, err = recomputeTotals(tx, &before)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// DeleteLineItem removes a line item from an order and returns the order's
+// new version. version is checked as by InsertLineItem.
+func (r *OrderRepo) DeleteLineItem(ctx context.Context, orderID, itemID, version int64) (int64, error) {
+	if err := validateID(orderID); err != nil {
+		return 0, err
+	}
+	if err := validateID(itemID); err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := lockEditableOrder(tx, ScopeFrom(ctx), orderID, version)
+		if err != nil {
+			return err
+		}
+
+		result := tx.
+			Where(itemIDColumn+" = ? AND "+orderIDColumn+" = ?", itemID, orderID).
+			Delete(&model.LineItem{})
+
+		if result.Error != nil {
+			return fmt.Errorf("delete line item %d: %w", itemID, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("line item %d of order %d: %w", itemID, orderID, ErrLineItemNotExist)
+		}
+
+		updated, err = recomputeTotals(tx, &before)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return updated, nil
+}
+
+// lockEditableOrder locks the order row for the rest of tx and returns it
+// with its line items. Orders outside scope are reported as not existing. It
+// fails with ErrVersionConflict if version is non-zero and the order no
+// longer has it, and with ErrOrderLocked once the order has shipped or been
+// closed.
+func lockEditableOrder(tx *gorm.DB, scope Scope, orderID, version int64) (model.Order, error) {
+	var order model.Order
+	err := scope.apply(tx).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("LineItems", orderLineItems).
+		Where(orderIDColumn+" = ?", orderID).
+		First(&order).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Order{}, fmt.Errorf("order %d: %w", orderID, ErrNotExist)
+		}
+		return model.Order{}, fmt.Errorf("lock order %d: %w", orderID, err)
+	}
+
+	if version != 0 && order.Version != version {
+		return model.Order{}, fmt.Errorf("order %d at version %d, stored %d: %w", orderID, version, order.Version, ErrVersionConflict)
+	}
+
+	if !lineItemsEditable(order) {
+		return model.Order{}, fmt.Errorf("order %d is %s: %w", orderID, order.Status, ErrOrderLocked)
+	}
+
+	return order, nil
+}
+
+// recomputeTotals recalculates and stores the totals of an order from its
+// current line items, and records the change of the order from before in
+// the history and as an order.updated event. The order must be locked; its
+// new version is returned.
+func recomputeTotals(tx *gorm.DB, before *model.Order) (int64, error) {
+	orderID := before.OrderID
+	order := model.Order{OrderID: orderID}
+	if err := tx.Where(orderIDColumn+" = ?", orderID).Find(&order.LineItems).Error; err != nil {
+		return 0, fmt.Errorf("load line items of order %d: %w", orderID, err)
+	}
+
+	if err := pricing.Apply(&order); err != nil {
+		return 0, fmt.Errorf("order %d: %w", orderID, pricingError(err))
+	}
+
+	// The totals are part of the order, so changing them bumps its version.
+	if err := tx.Model(&model.Order{}).
+		Where(orderIDColumn+" = ?", orderID).
+		Updates(map[string]any{
+			"subtotal":       order.Subtotal,
+			"discount_total": order.DiscountTotal,
+			"tax_total":      order.TaxTotal,
+			grandTotalColumn: order.GrandTotal,
+			versionColumn:    gorm.Expr(versionColumn + " + 1"),
+		}).Error; err != nil {
+		return 0, fmt.Errorf("update totals of order %d: %w", orderID, err)
+	}
+
+	if err := recordUpdate(tx, model.EventOrderUpdated, before); err != nil {
+		return 0, err
+	}
+	return before.Version + 1, nil
+}
+
+// matchOrderCurrency makes item use the order's currency. An item without a
+// currency inherits it, and an order without one adopts the item's.
+func matchOrderCurrency(tx *gorm.DB, order *model.Order, item *model.LineItem) error {
+	switch {
+	case item.Currency == "":
+		item.Currency = order.Currency
+	case order.Currency == "":
+		order.Currency = item.Currency
+		if err := tx.Model(&model.Order{}).
+			Where(orderIDColumn+" = ?", order.OrderID).
+			Update("currency", order.Currency).Error; err != nil {
+			return fmt.Errorf("set currency of order %d: %w", order.OrderID, err)
+		}
+		if err := tx.Model(&model.LineItem{}).
+			Where(orderIDColumn+" = ? AND currency = ?", order.OrderID, "").
+			Update("currency", order.Currency).Error; err != nil {
+			return fmt.Errorf("set currency of order %d items: %w", order.OrderID, err)
+		}
+	case item.Currency != order.Currency:
+		return fmt.Errorf("line item currency %q does not match order currency %q: %w", item.Currency, order.Currency, ErrInvalidInput)
+	}
+	return nil
+}
+
+// lineItemsEditable reports whether an order's items may still change: it
+// has not shipped and has not been cancelled or refunded.
+func lineItemsEditable(o model.Order) bool {
+	if o.ShippedAt != nil {
+		return false
+	}
+	switch o.Status {
+	case model.StatusShipped, model.StatusCompleted, model.StatusCancelled, model.StatusRefunded:
+		return false
+	}
+	return true
+}
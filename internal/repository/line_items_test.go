@@ -0,0 +1,214 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineItems_CRUD(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	item := &model.LineItem{OrderID: o.OrderID, Quantity: 2, Price: 150}
+	_, err := repo.InsertLineItem(ctx, item, 0)
+	require.NoError(t, err)
+	assert.Greater(t, item.ItemID, int64(0))
+
+	item.Quantity = 5
+	_, err = repo.UpdateLineItem(ctx, item, 0)
+	require.NoError(t, err)
+
+	items, err := repo.ListLineItems(ctx, o.OrderID)
+	require.NoError(t, err)
+	require.Len(t, items, 1)
+	assert.Equal(t, uint(5), items[0].Quantity)
+
+	_, err = repo.DeleteLineItem(ctx, o.OrderID, item.ItemID, 0)
+	require.NoError(t, err)
+
+	items, err = repo.ListLineItems(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestLineItems_CheckVersion(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	item := &model.LineItem{OrderID: o.OrderID, Quantity: 2, Price: 150}
+	version, err := repo.InsertLineItem(ctx, item, o.Version)
+	require.NoError(t, err)
+	assert.Equal(t, o.Version+1, version)
+
+	stale := o.Version
+	_, err = repo.InsertLineItem(ctx, &model.LineItem{OrderID: o.OrderID, Quantity: 1, Price: 100}, stale)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	item.Quantity = 5
+	_, err = repo.UpdateLineItem(ctx, item, stale)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	_, err = repo.DeleteLineItem(ctx, o.OrderID, item.ItemID, stale)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	got, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, version, got.Version)
+	assert.Equal(t, uint64(300), got.Subtotal)
+	require.Len(t, got.LineItems, 1)
+	assert.Equal(t, uint(2), got.LineItems[0].Quantity)
+
+	version, err = repo.UpdateLineItem(ctx, item, version)
+	require.NoError(t, err)
+	version, err = repo.DeleteLineItem(ctx, o.OrderID, item.ItemID, version)
+	require.NoError(t, err)
+
+	got, err = repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, version, got.Version)
+}
+
+func TestLineItems_RejectedOnceShipped(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 1, Price: 100}}}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	now := time.Now().UTC()
+	require.NoError(t, db.Model(o).Updates(map[string]any{"status": model.StatusShipped, "shipped_at": now}).Error)
+
+	_, err := repo.InsertLineItem(ctx, &model.LineItem{OrderID: o.OrderID, Quantity: 1}, 0)
+	assert.ErrorIs(t, err, ErrOrderLocked)
+
+	item := o.LineItems[0]
+	item.Quantity = 3
+	_, err = repo.UpdateLineItem(ctx, &item, 0)
+	assert.ErrorIs(t, err, ErrOrderLocked)
+	_, err = repo.DeleteLineItem(ctx, o.OrderID, item.ItemID, 0)
+	assert.ErrorIs(t, err, ErrOrderLocked)
+}
+
+func TestLineItems_OrderNotFound(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	_, err := repo.ListLineItems(ctx, 999)
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	_, err = repo.InsertLineItem(ctx, &model.LineItem{OrderID: 999, Quantity: 1}, 0)
+	assert.ErrorIs(t, err, ErrNotExist)
+}
+
+func TestLineItems_ItemOfOtherOrder(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	a := &model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 1, Price: 100}}}
+	b := &model.Order{CustomerID: 2}
+	require.NoError(t, repo.Insert(ctx, a))
+	require.NoError(t, repo.Insert(ctx, b))
+
+	_, err := repo.DeleteLineItem(ctx, b.OrderID, a.LineItems[0].ItemID, 0)
+	assert.ErrorIs(t, err, ErrLineItemNotExist)
+}
+
+func TestLineItems_CurrencyMustMatchOrder(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1, Currency: "EUR"}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	_, err := repo.InsertLineItem(ctx, &model.LineItem{OrderID: o.OrderID, Currency: "USD", Quantity: 1}, 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	item := &model.LineItem{OrderID: o.OrderID, SKU: "SKU-9", Quantity: 1}
+	_, err = repo.InsertLineItem(ctx, item, 0)
+	require.NoError(t, err)
+	assert.Equal(t, model.Currency("EUR"), item.Currency)
+}
+
+func TestLineItems_OrderAdoptsFirstCurrency(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	_, err := repo.InsertLineItem(ctx, &model.LineItem{OrderID: o.OrderID, Currency: "JPY", Quantity: 1}, 0)
+	require.NoError(t, err)
+
+	found, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Currency("JPY"), found.Currency)
+}
+
+func TestLineItems_RecomputeTotals(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 2, Price: 500}}}
+	require.NoError(t, repo.Insert(ctx, o))
+	assert.Equal(t, uint64(1000), o.GrandTotal)
+
+	item := &model.LineItem{OrderID: o.OrderID, Quantity: 1, Price: 1000, Discount: 100, TaxRateBps: 1000}
+	_, err := repo.InsertLineItem(ctx, item, 0)
+	require.NoError(t, err)
+
+	found, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2000), found.Subtotal)
+	assert.Equal(t, uint64(100), found.DiscountTotal)
+	assert.Equal(t, uint64(90), found.TaxTotal)
+	assert.Equal(t, uint64(1990), found.GrandTotal)
+	assert.Equal(t, int64(2), found.Version)
+
+	_, err = repo.DeleteLineItem(ctx, o.OrderID, o.LineItems[0].ItemID, 0)
+	require.NoError(t, err)
+
+	found, err = repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(990), found.GrandTotal)
+	assert.Equal(t, int64(3), found.Version)
+}
+
+func TestLineItems_Fails_WhenDiscountExceedsAmount(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	_, err := repo.InsertLineItem(ctx, &model.LineItem{OrderID: o.OrderID, Quantity: 1, Price: 10, Discount: 11}, 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	items, err := repo.ListLineItems(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Empty(t, items)
+}
+
+func TestLineItems_Fails_WhenQuantityZero(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	_, err := repo.InsertLineItem(staffCtx, &model.LineItem{OrderID: 1}, 0)
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
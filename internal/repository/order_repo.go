@@ -4,57 +4,109 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
+	"github.com/corradoisidoro/orders-api/internal/pricing"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type OrderRepo struct {
-	DB *gorm.DB
+	DB     *gorm.DB
+	States *orderstate.Machine
 }
 
 func NewOrderRepo(db *gorm.DB) OrderRepository {
-	return &OrderRepo{DB: db}
+	return &OrderRepo{DB: db, States: orderstate.Default()}
 }
 
-// Insert creates a new order.
+// Insert creates a new order. Line items without a currency take the order's,
+// and all line items must share it. The order's totals are computed from its
+// line items; any totals set by the caller are ignored. Under a restricted
+// Scope the order must belong to the scope's customer; otherwise
+// ErrOutOfScope is returned.
 func (r *OrderRepo) Insert(ctx context.Context, order *model.Order) error {
+	if order != nil {
+		inheritCurrency(order)
+	}
 	if err := validateOrderForInsert(order); err != nil {
 		return err
 	}
+	if !ScopeFrom(ctx).allows(order.CustomerID) {
+		return fmt.Errorf("insert order for customer %d: %w", order.CustomerID, ErrOutOfScope)
+	}
 
-	if err := r.DB.WithContext(ctx).Create(order).Error; err != nil {
-		return fmt.Errorf("insert order: %w", err)
+	if order.Status == "" {
+		order.Status = r.States.Initial()
+	}
+	if order.Status != r.States.Initial() {
+		return &ValidationError{Field: "status", Reason: fmt.Sprintf("must be %s", r.States.Initial())}
 	}
 
-	return nil
+	order.Version = 1
+
+	if err := pricing.Apply(order); err != nil {
+		return pricingError(err)
+	}
+
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(order).Error; err != nil {
+			return fmt.Errorf("insert order: %w", err)
+		}
+		if err := recordHistory(tx, model.OperationCreate, nil, order); err != nil {
+			return err
+		}
+		return recordEvent(tx, model.EventOrderCreated, order)
+	})
 }
 
-// FindAll returns a page of orders and the cursor for the next page.
-// If page.Size is 0, all remaining records are returned.
+// FindAll returns a page of orders matching page.Filter and the cursor for
+// the next page. Orders are read with keyset pagination, so pages stay stable
+// while rows are inserted or deleted between requests. If page.Size is 0, all
+// remaining records are returned.
 func (r *OrderRepo) FindAll(ctx context.Context, page Page) (Result, error) {
 	if err := validatePage(page); err != nil {
 		return Result{}, err
 	}
+	if page.Filter.Status != "" && !r.States.Known(page.Filter.Status) {
+		return Result{}, fmt.Errorf("invalid status %q: %w", page.Filter.Status, ErrInvalidInput)
+	}
 
-	var orders []model.Order
+	keyset := page.Sort.keyset()
+
+	query := ScopeFrom(ctx).apply(page.Filter.apply(r.DB.WithContext(ctx)))
 
-	query := r.DB.WithContext(ctx).Offset(int(page.Offset))
+	if page.After != nil {
+		cond, args := keyset.seekCondition(*page.After)
+		query = query.Where(cond, args...)
+	}
+
+	query = query.Order(keyset.orderClause())
+
+	// Fetch one extra row to learn whether another page exists.
 	if page.Size > 0 {
-		query = query.Limit(int(page.Size))
+		query = query.Limit(int(page.Size) + 1)
 	}
 
+	var orders []model.Order
 	if err := query.
 		Preload("LineItems").
 		Find(&orders).Error; err != nil {
 		return Result{}, fmt.Errorf("find all orders: %w", err)
 	}
 
-	nextCursor := page.Offset + int64(len(orders))
+	var next *Cursor
+	if page.Size > 0 && int64(len(orders)) > page.Size {
+		orders = orders[:page.Size]
+		c := cursorFor(keyset, orders[len(orders)-1])
+		next = &c
+	}
 
 	return Result{
 		Orders: orders,
-		Cursor: nextCursor,
+		Next:   next,
 	}, nil
 }
 
@@ -65,7 +117,7 @@ func (r *OrderRepo) FindByID(ctx context.Context, id int64) (model.Order, error)
 	}
 
 	var order model.Order
-	result := r.DB.WithContext(ctx).
+	result := ScopeFrom(ctx).apply(r.DB.WithContext(ctx)).
 		Preload("LineItems").
 		Where(orderIDColumn+" = ?", id).
 		First(&order)
@@ -82,6 +134,18 @@ func (r *OrderRepo) FindByID(ctx context.Context, id int64) (model.Order, error)
 
 // UpdateByID updates an existing order by its ID.
 //
+// order.Version must hold the version the caller read. The update only
+// applies if the stored order still has that version, and then increments
+// it; otherwise ErrVersionConflict is returned and order is unchanged.
+//
+// If order.Status is set, the stored status must be able to move to it
+// according to r.States; otherwise orderstate.ErrInvalidTransition is
+// returned. Both checks are part of the UPDATE itself, so concurrent writers
+// cannot both win.
+//
+// Line items and totals are never written here: they change only through the
+// line item methods, which keep them consistent.
+//
 // NOTE: Updates(order) will overwrite zero-value fields.
 // Callers should ensure the order struct contains the intended final state.
 func (r *OrderRepo) UpdateByID(ctx context.Context, order *model.Order) error {
@@ -89,39 +153,268 @@ func (r *OrderRepo) UpdateByID(ctx context.Context, order *model.Order) error {
 		return err
 	}
 
-	result := r.DB.WithContext(ctx).
-		Model(&model.Order{}).
-		Where(orderIDColumn+" = ?", order.OrderID).
-		Updates(order)
+	scope := ScopeFrom(ctx)
+	if !scope.allows(order.CustomerID) {
+		return fmt.Errorf("update order %d for customer %d: %w", order.OrderID, order.CustomerID, ErrOutOfScope)
+	}
 
-	if result.Error != nil {
-		return fmt.Errorf("update order %d: %w", order.OrderID, result.Error)
+	expected := order.Version
+
+	var allowed []model.Status
+	event := model.EventOrderUpdated
+	if order.Status != "" {
+		if !r.States.Known(order.Status) {
+			return fmt.Errorf("update order %d: status %q: %w", order.OrderID, order.Status, orderstate.ErrUnknownStatus)
+		}
+		allowed = append(r.States.Sources(order.Status), order.Status)
+		event = model.StatusEvent(order.Status)
+	}
+
+	order.Version = expected + 1
+	var updated bool
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Lock the order as it was: the history records the change from it.
+		var before []model.Order
+		if err := scope.apply(tx).Preload("LineItems", orderLineItems).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(orderIDColumn+" = ?", order.OrderID).
+			Limit(1).
+			Find(&before).Error; err != nil {
+			return fmt.Errorf("update order %d: %w", order.OrderID, err)
+		}
+		if len(before) == 0 {
+			return nil
+		}
+
+		query := scope.apply(tx).
+			Model(&model.Order{}).
+			Where(orderIDColumn+" = ? AND "+versionColumn+" = ?", order.OrderID, expected)
+		if allowed != nil {
+			query = query.Where(statusColumn+" IN ?", allowed)
+		}
+
+		result := query.Omit(append([]string{clause.Associations}, totalColumns...)...).Updates(order)
+		if result.Error != nil {
+			return fmt.Errorf("update order %d: %w", order.OrderID, result.Error)
+		}
+
+		updated = result.RowsAffected > 0
+		if !updated {
+			return nil
+		}
+		return recordUpdate(tx, event, &before[0])
+	})
+
+	if err != nil {
+		order.Version = expected
+		return err
 	}
 
-	if result.RowsAffected == 0 {
-		return fmt.Errorf("update order %d: %w", order.OrderID, ErrNotExist)
+	if !updated {
+		order.Version = expected
+		stored, found := r.storedVersion(ctx, order.OrderID)
+		switch {
+		case !found:
+			return fmt.Errorf("update order %d: %w", order.OrderID, ErrNotExist)
+		case stored != expected:
+			return fmt.Errorf("update order %d at version %d, stored %d: %w", order.OrderID, expected, stored, ErrVersionConflict)
+		default:
+			return fmt.Errorf("update order %d to %s: %w", order.OrderID, order.Status, orderstate.ErrInvalidTransition)
+		}
 	}
 
 	return nil
 }
 
-// DeleteByID deletes an order by its ID.
-func (r *OrderRepo) DeleteByID(ctx context.Context, id int64) error {
+// DeleteByID deletes an order by its ID. If version is non-zero the order is
+// only deleted while it still has that version; otherwise ErrVersionConflict
+// is returned.
+//
+// The deletion is soft: the order and its line items are kept, hidden from
+// every other method, until Restore brings them back or PurgeDeleted removes
+// them.
+func (r *OrderRepo) DeleteByID(ctx context.Context, id int64, version int64) error {
 	if err := validateID(id); err != nil {
 		return err
 	}
+	if version < 0 {
+		return fmt.Errorf("invalid version %d: %w", version, ErrInvalidInput)
+	}
 
-	result := r.DB.WithContext(ctx).
-		Where(orderIDColumn+" = ?", id).
-		Delete(&model.Order{})
+	var deleted bool
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := ScopeFrom(ctx).apply(tx).Where(orderIDColumn+" = ?", id)
+		if version > 0 {
+			query = query.Where(versionColumn+" = ?", version)
+		}
 
-	if result.Error != nil {
-		return fmt.Errorf("delete order %d: %w", id, result.Error)
+		// Read the order first: the deletion event describes it.
+		var orders []model.Order
+		if err := query.Preload("LineItems", orderLineItems).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Limit(1).
+			Find(&orders).Error; err != nil {
+			return fmt.Errorf("delete order %d: %w", id, err)
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		if err := tx.Where(orderIDColumn+" = ?", id).Delete(&model.Order{}).Error; err != nil {
+			return fmt.Errorf("delete order %d: %w", id, err)
+		}
+		deleted = true
+
+		if err := recordHistory(tx, model.OperationDelete, &orders[0], nil); err != nil {
+			return err
+		}
+		return recordEvent(tx, model.EventOrderDeleted, &orders[0])
+	})
+
+	if err != nil {
+		return err
 	}
 
-	if result.RowsAffected == 0 {
+	if !deleted {
+		if _, found := r.storedVersion(ctx, id); found {
+			return fmt.Errorf("delete order %d at version %d: %w", id, version, ErrVersionConflict)
+		}
 		return fmt.Errorf("delete order %d: %w", id, ErrNotExist)
 	}
 
 	return nil
 }
+
+// Restore undeletes an order deleted by DeleteByID and returns it. It fails
+// with ErrNotDeleted if the order is not deleted.
+func (r *OrderRepo) Restore(ctx context.Context, id int64) (model.Order, error) {
+	if err := validateID(id); err != nil {
+		return model.Order{}, err
+	}
+
+	var restored model.Order
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var orders []model.Order
+		if err := ScopeFrom(ctx).apply(tx.Unscoped()).
+			Preload("LineItems", orderLineItems).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(orderIDColumn+" = ?", id).
+			Limit(1).
+			Find(&orders).Error; err != nil {
+			return fmt.Errorf("restore order %d: %w", id, err)
+		}
+		if len(orders) == 0 {
+			return fmt.Errorf("order %d: %w", id, ErrNotExist)
+		}
+		before := orders[0]
+		if !before.DeletedAt.Valid {
+			return fmt.Errorf("restore order %d: %w", id, ErrNotDeleted)
+		}
+
+		if err := tx.Unscoped().Model(&model.Order{}).
+			Where(orderIDColumn+" = ?", id).
+			Updates(map[string]any{
+				deletedAtColumn: nil,
+				versionColumn:   gorm.Expr(versionColumn + " + 1"),
+			}).Error; err != nil {
+			return fmt.Errorf("restore order %d: %w", id, err)
+		}
+
+		after, err := loadOrder(tx, id)
+		if err != nil {
+			return fmt.Errorf("load restored order %d: %w", id, err)
+		}
+		if err := recordHistory(tx, model.OperationRestore, &before, &after); err != nil {
+			return err
+		}
+		restored = after
+		return recordEvent(tx, model.EventOrderRestored, &after)
+	})
+
+	return restored, err
+}
+
+// PurgeDeleted permanently removes the orders deleted before the given time,
+// with their line items, and returns how many were removed. Their history is
+// kept, and records the purge.
+func (r *OrderRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	for {
+		n, err := r.purgeBatch(ctx, before)
+		purged += n
+		if err != nil || n < purgeBatchSize {
+			return purged, err
+		}
+	}
+}
+
+// purgeBatch removes up to purgeBatchSize of the orders PurgeDeleted removes.
+func (r *OrderRepo) purgeBatch(ctx context.Context, before time.Time) (int64, error) {
+	var orders []model.Order
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := ScopeFrom(ctx).apply(tx.Unscoped()).
+			Preload("LineItems", orderLineItems).
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where(deletedAtColumn+" < ?", before.UTC()).
+			Order(orderIDColumn).
+			Limit(purgeBatchSize).
+			Find(&orders).Error; err != nil {
+			return fmt.Errorf("find deleted orders: %w", err)
+		}
+		if len(orders) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(orders))
+		for i, o := range orders {
+			ids[i] = o.OrderID
+		}
+
+		// Not every database cascades, so remove the line items explicitly.
+		if err := tx.Where(orderIDColumn+" IN ?", ids).Delete(&model.LineItem{}).Error; err != nil {
+			return fmt.Errorf("purge line items: %w", err)
+		}
+		if err := tx.Unscoped().Where(orderIDColumn+" IN ?", ids).Delete(&model.Order{}).Error; err != nil {
+			return fmt.Errorf("purge orders: %w", err)
+		}
+
+		for i := range orders {
+			if err := recordHistory(tx, model.OperationPurge, &orders[i], nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(orders)), nil
+}
+
+// storedVersion returns the current version of an order and whether it exists
+// within the scope of ctx.
+func (r *OrderRepo) storedVersion(ctx context.Context, id int64) (int64, bool) {
+	var versions []int64
+	ScopeFrom(ctx).apply(r.DB.WithContext(ctx)).
+		Model(&model.Order{}).
+		Where(orderIDColumn+" = ?", id).
+		Limit(1).
+		Pluck(versionColumn, &versions)
+	if len(versions) == 0 {
+		return 0, false
+	}
+	return versions[0], true
+}
+
+// exists reports whether an order with the given ID is stored within the
+// scope of ctx.
+func (r *OrderRepo) exists(ctx context.Context, id int64) bool {
+	var count int64
+	ScopeFrom(ctx).apply(r.DB.WithContext(ctx)).
+		Model(&model.Order{}).
+		Where(orderIDColumn+" = ?", id).
+		Count(&count)
+	return count > 0
+}
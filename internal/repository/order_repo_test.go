@@ -4,8 +4,10 @@ import (
 	"context"
 	"log"
 	"testing"
+	"time"
 
 	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/orderstate"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gorm.io/driver/sqlite"
@@ -13,6 +15,9 @@ import (
 	"gorm.io/gorm/logger"
 )
 
+// staffCtx sees and changes every customer's orders.
+var staffCtx = WithScope(context.Background(), Unrestricted)
+
 func setupTestDB(t *testing.T) *gorm.DB {
 	t.Helper()
 
@@ -24,7 +29,8 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	})
 	require.NoError(t, err)
 
-	require.NoError(t, db.AutoMigrate(&model.Order{}, &model.LineItem{}))
+	require.NoError(t, db.AutoMigrate(&model.Order{}, &model.LineItem{}, &model.OutboxEvent{}, &model.OrderHistory{}, &model.IdempotencyKey{}, &model.APIKey{},
+		&model.Webhook{}, &model.WebhookDelivery{}))
 
 	sqlDB, _ := db.DB()
 	t.Cleanup(func() { sqlDB.Close() })
@@ -39,7 +45,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 func TestInsert_Success(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
-	ctx := context.Background()
+	ctx := staffCtx
 
 	o := &model.Order{CustomerID: 1}
 	err := repo.Insert(ctx, o)
@@ -48,11 +54,108 @@ func TestInsert_Success(t *testing.T) {
 	assert.Greater(t, o.OrderID, int64(0))
 }
 
+func TestInsert_DefaultsToInitialStatus(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(staffCtx, o))
+
+	found, err := repo.FindByID(staffCtx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusPending, found.Status)
+}
+
+func TestInsert_Fails_WhenStatusNotInitial(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	err := repo.Insert(staffCtx, &model.Order{CustomerID: 1, Status: model.StatusShipped})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestInsert_PersistsProductFieldsAndCurrency(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{
+		CustomerID: 1,
+		LineItems: []model.LineItem{
+			{SKU: "SKU-1", ProductName: "Widget", Currency: "EUR", Quantity: 1, Price: 100},
+			{SKU: "SKU-2", ProductName: "Gadget", Quantity: 2, Price: 50},
+		},
+	}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	found, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, model.Currency("EUR"), found.Currency)
+	require.Len(t, found.LineItems, 2)
+	assert.Equal(t, "SKU-1", found.LineItems[0].SKU)
+	assert.Equal(t, "Widget", found.LineItems[0].ProductName)
+	assert.Equal(t, model.Currency("EUR"), found.LineItems[1].Currency)
+
+	result, err := repo.FindAll(ctx, Page{})
+	require.NoError(t, err)
+	require.Len(t, result.Orders, 1)
+	assert.Equal(t, "Gadget", result.Orders[0].LineItems[1].ProductName)
+}
+
+func TestInsert_Fails_WhenCurrenciesMixed(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	err := repo.Insert(staffCtx, &model.Order{
+		CustomerID: 1,
+		LineItems: []model.LineItem{
+			{Currency: "EUR", Quantity: 1, Price: 100},
+			{Currency: "USD", Quantity: 1, Price: 100},
+		},
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestInsert_Fails_WhenItemCurrencyDiffersFromOrder(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	err := repo.Insert(staffCtx, &model.Order{
+		CustomerID: 1,
+		Currency:   "GBP",
+		LineItems:  []model.LineItem{{Currency: "EUR", Quantity: 1}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestInsert_Fails_WhenCurrencyMalformed(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	err := repo.Insert(staffCtx, &model.Order{CustomerID: 1, Currency: "euro"})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestInsert_Fails_WhenQuantityZero(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	err := repo.Insert(staffCtx, &model.Order{
+		CustomerID: 1,
+		LineItems:  []model.LineItem{{Quantity: 0, Price: 100}},
+	})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+
+	var count int64
+	require.NoError(t, db.Model(&model.Order{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
 func TestInsert_Fails_WhenNilOrder(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	err := repo.Insert(context.Background(), nil)
+	err := repo.Insert(staffCtx, nil)
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrInvalidInput)
 }
@@ -61,11 +164,59 @@ func TestInsert_Fails_WhenCustomerIDZero(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	err := repo.Insert(context.Background(), &model.Order{CustomerID: 0})
+	err := repo.Insert(staffCtx, &model.Order{CustomerID: 0})
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrInvalidInput)
 }
 
+func TestInsert_ReportsInvalidField(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	cases := map[string]struct {
+		order model.Order
+		want  ValidationError
+	}{
+		"no customer": {
+			order: model.Order{},
+			want:  ValidationError{Field: "customer_id", Reason: "is required"},
+		},
+		"malformed currency": {
+			order: model.Order{CustomerID: 1, Currency: "euro"},
+			want:  ValidationError{Field: "currency", Reason: "must be an ISO 4217 code"},
+		},
+		"mixed currencies": {
+			order: model.Order{CustomerID: 1, LineItems: []model.LineItem{
+				{Currency: "EUR", Quantity: 1},
+				{Currency: "USD", Quantity: 1},
+			}},
+			want: ValidationError{Field: "line_items[1].currency", Reason: "must match the order's currency"},
+		},
+		"zero quantity": {
+			order: model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 1}, {Quantity: 0}}},
+			want:  ValidationError{Field: "line_items[1].quantity", Reason: "must be at least 1"},
+		},
+		"discount too high": {
+			order: model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 1, Price: 10, Discount: 11}}},
+			want:  ValidationError{Field: "line_items", Reason: "discount exceeds line amount"},
+		},
+		"not pending": {
+			order: model.Order{CustomerID: 1, Status: model.StatusPaid},
+			want:  ValidationError{Field: "status", Reason: "must be pending"},
+		},
+	}
+
+	for name, tc := range cases {
+		err := repo.Insert(staffCtx, &tc.order)
+		assert.ErrorIs(t, err, ErrInvalidInput, name)
+
+		var invalid *ValidationError
+		if assert.ErrorAs(t, err, &invalid, name) {
+			assert.Equal(t, tc.want, *invalid, name)
+		}
+	}
+}
+
 //
 // FIND ALL
 //
@@ -73,52 +224,343 @@ func TestInsert_Fails_WhenCustomerIDZero(t *testing.T) {
 func TestFindAll_Success(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
-	ctx := context.Background()
+	ctx := staffCtx
 
 	for i := 1; i <= 3; i++ {
 		require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: int64(i)}))
 	}
 
-	result, err := repo.FindAll(ctx, Page{Size: 2, Offset: 0})
+	result, err := repo.FindAll(ctx, Page{Size: 2})
+
+	require.NoError(t, err)
+	assert.Len(t, result.Orders, 2)
+	require.NotNil(t, result.Next)
+	assert.Equal(t, result.Orders[1].OrderID, result.Next.OrderID)
+	assert.Equal(t, "order_id", result.Next.Sort)
+}
+
+func TestFindAll_WalksAllPages(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	for i := 1; i <= 5; i++ {
+		require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: int64(i)}))
+	}
+
+	var seen []int64
+	page := Page{Size: 2}
+	for {
+		result, err := repo.FindAll(ctx, page)
+		require.NoError(t, err)
+		for _, o := range result.Orders {
+			seen = append(seen, o.OrderID)
+		}
+		if result.Next == nil {
+			break
+		}
+		page.After = result.Next
+	}
+
+	assert.Len(t, seen, 5)
+	assert.IsIncreasing(t, seen)
+}
+
+func TestFindAll_StableWhenRowsDeletedBetweenPages(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	var ids []int64
+	for i := 1; i <= 4; i++ {
+		o := &model.Order{CustomerID: int64(i)}
+		require.NoError(t, repo.Insert(ctx, o))
+		ids = append(ids, o.OrderID)
+	}
+
+	first, err := repo.FindAll(ctx, Page{Size: 2})
+	require.NoError(t, err)
+
+	// Removing an already-seen row must not shift the next page.
+	require.NoError(t, repo.DeleteByID(ctx, ids[0], 0))
+
+	second, err := repo.FindAll(ctx, Page{Size: 2, After: first.Next})
+	require.NoError(t, err)
+	require.Len(t, second.Orders, 2)
+	assert.Equal(t, ids[2], second.Orders[0].OrderID)
+	assert.Equal(t, ids[3], second.Orders[1].OrderID)
+	assert.Nil(t, second.Next)
+}
+
+func TestFindAll_SortByCreatedAt(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{2 * time.Hour, time.Hour, time.Hour, 0}
+	for i, off := range offsets {
+		created := base.Add(off)
+		require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: int64(i + 1), CreatedAt: &created}))
+	}
+
+	first, err := repo.FindAll(ctx, Page{Size: 2, Sort: Sort{{Column: "created_at"}}})
+	require.NoError(t, err)
+	require.Len(t, first.Orders, 2)
+	require.NotNil(t, first.Next)
+	require.NotNil(t, first.Next.CreatedAt)
 
+	second, err := repo.FindAll(ctx, Page{Size: 2, Sort: Sort{{Column: "created_at"}}, After: first.Next})
+	require.NoError(t, err)
+	require.Len(t, second.Orders, 2)
+
+	var customers []int64
+	for _, o := range append(first.Orders, second.Orders...) {
+		customers = append(customers, o.CustomerID)
+	}
+	assert.Equal(t, []int64{4, 2, 3, 1}, customers)
+	assert.Nil(t, second.Next)
+}
+
+func TestFindAll_SortByCreatedAtWithNulls(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	// Orders 2 and 4 were stored before created_at was recorded.
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ids []int64
+	for i, off := range []time.Duration{time.Hour, 0, 0, 2 * time.Hour, 0} {
+		created := base.Add(off)
+		o := &model.Order{CustomerID: int64(i + 1), CreatedAt: &created}
+		require.NoError(t, repo.Insert(ctx, o))
+		ids = append(ids, o.OrderID)
+	}
+	require.NoError(t, db.Model(&model.Order{}).
+		Where("order_id IN ?", []int64{ids[1], ids[3]}).
+		Update("created_at", nil).Error)
+
+	walk := func(sort string) []int64 {
+		keys, err := ParseSort(sort)
+		require.NoError(t, err)
+
+		var customers []int64
+		page := Page{Size: 1, Sort: keys}
+		for {
+			result, err := repo.FindAll(ctx, page)
+			require.NoError(t, err, sort)
+			for _, o := range result.Orders {
+				customers = append(customers, o.CustomerID)
+			}
+			if result.Next == nil {
+				return customers
+			}
+			page.After = result.Next
+		}
+	}
+
+	// NULLs sort after every time, with order_id breaking ties.
+	assert.Equal(t, []int64{3, 5, 1, 2, 4}, walk("created_at"))
+	assert.Equal(t, []int64{2, 4, 1, 3, 5}, walk("-created_at"))
+	assert.Equal(t, []int64{4, 2, 1, 5, 3}, walk("-created_at,-order_id"))
+}
+
+func TestFindAll_MixedDirectionSort(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	customers := []int64{1, 2, 1, 2, 1}
+	for _, c := range customers {
+		require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: c}))
+	}
+
+	sort, err := ParseSort("-customer_id,order_id")
+	require.NoError(t, err)
+
+	var got []int64
+	page := Page{Size: 2, Sort: sort}
+	for {
+		result, err := repo.FindAll(ctx, page)
+		require.NoError(t, err)
+		for _, o := range result.Orders {
+			got = append(got, o.CustomerID)
+		}
+		if result.Next == nil {
+			break
+		}
+		page.After = result.Next
+	}
+
+	assert.Equal(t, []int64{2, 2, 1, 1, 1}, got)
+}
+
+func TestFindAll_FiltersByCustomerAndStatus(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	statuses := []struct {
+		customer int64
+		status   model.Status
+	}{
+		{1, model.StatusPending},
+		{1, model.StatusShipped},
+		{1, model.StatusCompleted},
+		{2, model.StatusShipped},
+	}
+	for _, s := range statuses {
+		o := &model.Order{CustomerID: s.customer}
+		require.NoError(t, repo.Insert(ctx, o))
+		require.NoError(t, db.Model(o).Update("status", s.status).Error)
+	}
+
+	result, err := repo.FindAll(ctx, Page{Filter: Filter{CustomerID: 1, Status: model.StatusShipped}})
+	require.NoError(t, err)
+	require.Len(t, result.Orders, 1)
+	assert.Equal(t, model.StatusShipped, result.Orders[0].Status)
+	assert.Equal(t, int64(1), result.Orders[0].CustomerID)
+
+	result, err = repo.FindAll(ctx, Page{Filter: Filter{Status: model.StatusShipped}})
 	require.NoError(t, err)
 	assert.Len(t, result.Orders, 2)
-	assert.Equal(t, int64(2), result.Cursor)
+}
+
+func TestFindAll_Fails_WhenUnknownStatus(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	_, err := repo.FindAll(staffCtx, Page{Filter: Filter{Status: "lost"}})
+
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestFindAll_FiltersByCreatedRange(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	base := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 4; i++ {
+		created := base.AddDate(0, 0, i)
+		require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: int64(i + 1), CreatedAt: &created}))
+	}
+
+	from := base.AddDate(0, 0, 1)
+	to := base.AddDate(0, 0, 3)
+	result, err := repo.FindAll(ctx, Page{Filter: Filter{CreatedFrom: &from, CreatedTo: &to}})
+
+	require.NoError(t, err)
+	require.Len(t, result.Orders, 2)
+	assert.Equal(t, int64(2), result.Orders[0].CustomerID)
+	assert.Equal(t, int64(3), result.Orders[1].CustomerID)
+}
+
+func TestFindAll_FiltersByTotal(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 1, Price: 500}}}))
+	require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: 2, LineItems: []model.LineItem{{Quantity: 3, Price: 1000}}}))
+	require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: 3}))
+
+	minTotal, maxTotal := uint64(1000), uint64(3000)
+	result, err := repo.FindAll(ctx, Page{Filter: Filter{MinTotal: &minTotal, MaxTotal: &maxTotal}})
+
+	require.NoError(t, err)
+	require.Len(t, result.Orders, 1)
+	assert.Equal(t, int64(2), result.Orders[0].CustomerID)
+}
+
+func TestFindAll_SortByGrandTotal(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	for i, price := range []uint{300, 100, 200, 100} {
+		require.NoError(t, repo.Insert(ctx, &model.Order{
+			CustomerID: int64(i + 1),
+			LineItems:  []model.LineItem{{Quantity: 1, Price: price}},
+		}))
+	}
+
+	sort, err := ParseSort("-grand_total")
+	require.NoError(t, err)
+
+	var totals []uint64
+	page := Page{Size: 3, Sort: sort}
+	for {
+		result, err := repo.FindAll(ctx, page)
+		require.NoError(t, err)
+		for _, o := range result.Orders {
+			totals = append(totals, o.GrandTotal)
+		}
+		if result.Next == nil {
+			break
+		}
+		page.After = result.Next
+	}
+
+	assert.Equal(t, []uint64{300, 200, 100, 100}, totals)
+}
+
+func TestFindAll_Fails_WhenRangeInverted(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	minTotal, maxTotal := uint64(10), uint64(5)
+	_, err := repo.FindAll(staffCtx, Page{Filter: Filter{MinTotal: &minTotal, MaxTotal: &maxTotal}})
+
+	assert.ErrorIs(t, err, ErrInvalidInput)
 }
 
 func TestFindAll_EmptyResult(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	result, err := repo.FindAll(context.Background(), Page{Size: 10, Offset: 0})
+	result, err := repo.FindAll(staffCtx, Page{Size: 10})
 
 	require.NoError(t, err)
 	assert.Empty(t, result.Orders)
-	assert.Equal(t, int64(0), result.Cursor)
+	assert.Nil(t, result.Next)
 }
 
-func TestFindAll_OffsetBeyondRange(t *testing.T) {
+func TestFindAll_CursorBeyondRange(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
-	ctx := context.Background()
+	ctx := staffCtx
 
 	require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: 1}))
 
-	result, err := repo.FindAll(ctx, Page{Size: 10, Offset: 50})
+	result, err := repo.FindAll(ctx, Page{Size: 10, After: &Cursor{Sort: "order_id", OrderID: 50}})
 
 	require.NoError(t, err)
 	assert.Empty(t, result.Orders)
-	assert.Equal(t, int64(50), result.Cursor)
+	assert.Nil(t, result.Next)
 }
 
-func TestFindAll_Fails_WhenNegativeOffset(t *testing.T) {
+func TestFindAll_Fails_WhenCursorSortMismatch(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	result, err := repo.FindAll(context.Background(), Page{Size: 10, Offset: -1})
+	result, err := repo.FindAll(staffCtx, Page{
+		Size:  10,
+		Sort:  Sort{{Column: "created_at"}},
+		After: &Cursor{Sort: "order_id", OrderID: 1},
+	})
 
 	assert.Error(t, err)
 	assert.Empty(t, result.Orders)
+	assert.ErrorIs(t, err, ErrInvalidCursor)
+}
+
+func TestFindAll_Fails_WhenUnknownSort(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	_, err := repo.FindAll(staffCtx, Page{Size: 10, Sort: Sort{{Column: "line_items"}}})
+
 	assert.ErrorIs(t, err, ErrInvalidInput)
 }
 
@@ -126,7 +568,7 @@ func TestFindAll_Fails_WhenNegativeSize(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	result, err := repo.FindAll(context.Background(), Page{Size: -5, Offset: 0})
+	result, err := repo.FindAll(staffCtx, Page{Size: -5})
 
 	assert.Error(t, err)
 	assert.Empty(t, result.Orders)
@@ -140,7 +582,7 @@ func TestFindAll_Fails_WhenNegativeSize(t *testing.T) {
 func TestFindByID_Success(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
-	ctx := context.Background()
+	ctx := staffCtx
 
 	o := &model.Order{CustomerID: 1}
 	require.NoError(t, repo.Insert(ctx, o))
@@ -155,7 +597,7 @@ func TestFindByID_NotFound(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	_, err := repo.FindByID(context.Background(), 999)
+	_, err := repo.FindByID(staffCtx, 999)
 	assert.ErrorIs(t, err, ErrNotExist)
 }
 
@@ -163,7 +605,7 @@ func TestFindByID_Fails_WhenIDZero(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	_, err := repo.FindByID(context.Background(), 0)
+	_, err := repo.FindByID(staffCtx, 0)
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrInvalidInput)
 }
@@ -175,7 +617,7 @@ func TestFindByID_Fails_WhenIDZero(t *testing.T) {
 func TestUpdateByID_Success(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
-	ctx := context.Background()
+	ctx := staffCtx
 
 	o := &model.Order{CustomerID: 1}
 	require.NoError(t, repo.Insert(ctx, o))
@@ -188,19 +630,169 @@ func TestUpdateByID_Success(t *testing.T) {
 	assert.Equal(t, int64(2), updated.CustomerID)
 }
 
+func TestUpdateByID_AllowsValidTransition(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	o.Status = model.StatusPaid
+	require.NoError(t, repo.UpdateByID(ctx, o))
+
+	updated, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusPaid, updated.Status)
+}
+
+func TestUpdateByID_Fails_WhenTransitionNotAllowed(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	o.Status = model.StatusCompleted
+	err := repo.UpdateByID(ctx, o)
+	assert.ErrorIs(t, err, orderstate.ErrInvalidTransition)
+
+	stored, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, model.StatusPending, stored.Status)
+}
+
+func TestUpdateByID_Fails_WhenStatusUnknown(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	err := repo.UpdateByID(staffCtx, &model.Order{OrderID: 1, CustomerID: 1, Status: "lost", Version: 1})
+	assert.ErrorIs(t, err, orderstate.ErrUnknownStatus)
+}
+
+func TestUpdateByID_CancelledOrderStaysListed(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	now := time.Now().UTC()
+	o.Status = model.StatusCancelled
+	o.CancelledAt = &now
+	o.CancelledBy = "ops"
+	o.CancelReason = model.CancelReasonDuplicate
+	require.NoError(t, repo.UpdateByID(ctx, o))
+
+	result, err := repo.FindAll(ctx, Page{Filter: Filter{Status: model.StatusCancelled}})
+	require.NoError(t, err)
+	require.Len(t, result.Orders, 1)
+	assert.Equal(t, "ops", result.Orders[0].CancelledBy)
+	assert.Equal(t, model.CancelReasonDuplicate, result.Orders[0].CancelReason)
+	assert.NotNil(t, result.Orders[0].CancelledAt)
+}
+
+func TestUpdateByID_KeepsLineItemsAndTotals(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 1, Price: 100}}}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	// A stale copy taken before the line item was removed.
+	stale, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	_, err = repo.DeleteLineItem(ctx, o.OrderID, o.LineItems[0].ItemID, 0)
+	require.NoError(t, err)
+
+	// Skip the version check; only the omitted columns are under test here.
+	current, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	stale.Version = current.Version
+
+	stale.Status = model.StatusPaid
+	require.NoError(t, repo.UpdateByID(ctx, &stale))
+
+	found, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Empty(t, found.LineItems)
+	assert.Equal(t, uint64(0), found.GrandTotal)
+	assert.Equal(t, model.StatusPaid, found.Status)
+}
+
 func TestUpdateByID_NotFound(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	err := repo.UpdateByID(context.Background(), &model.Order{OrderID: 999, CustomerID: 1})
+	err := repo.UpdateByID(staffCtx, &model.Order{OrderID: 999, CustomerID: 1, Version: 1})
 	assert.ErrorIs(t, err, ErrNotExist)
 }
 
+func TestUpdateByID_IncrementsVersion(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+	assert.Equal(t, int64(1), o.Version)
+
+	o.Status = model.StatusPaid
+	require.NoError(t, repo.UpdateByID(ctx, o))
+	assert.Equal(t, int64(2), o.Version)
+
+	stored, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), stored.Version)
+}
+
+func TestUpdateByID_Fails_WhenVersionStale(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1, Status: model.StatusPending}
+	require.NoError(t, repo.Insert(ctx, o))
+	o.Status = model.StatusPaid
+	require.NoError(t, repo.UpdateByID(ctx, o))
+
+	// Two writers read the paid order; only the first may ship it.
+	first, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	second := first
+
+	shippedAt := time.Now().UTC()
+	first.Status = model.StatusShipped
+	first.ShippedAt = &shippedAt
+	require.NoError(t, repo.UpdateByID(ctx, &first))
+
+	second.Status = model.StatusShipped
+	err = repo.UpdateByID(ctx, &second)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+	assert.Equal(t, first.Version-1, second.Version)
+
+	stored, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	require.NotNil(t, stored.ShippedAt)
+	assert.WithinDuration(t, shippedAt, *stored.ShippedAt, time.Second)
+}
+
+func TestUpdateByID_Fails_WhenVersionMissing(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+
+	err := repo.UpdateByID(staffCtx, &model.Order{OrderID: 1, CustomerID: 1})
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
 func TestUpdateByID_Fails_WhenNilOrder(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	err := repo.UpdateByID(context.Background(), nil)
+	err := repo.UpdateByID(staffCtx, nil)
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrInvalidInput)
 }
@@ -209,7 +801,7 @@ func TestUpdateByID_Fails_WhenOrderIDZero(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	err := repo.UpdateByID(context.Background(), &model.Order{OrderID: 0, CustomerID: 1})
+	err := repo.UpdateByID(staffCtx, &model.Order{OrderID: 0, CustomerID: 1})
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrInvalidInput)
 }
@@ -218,7 +810,7 @@ func TestUpdateByID_Fails_WhenCustomerIDZero(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	err := repo.UpdateByID(context.Background(), &model.Order{OrderID: 1, CustomerID: 0})
+	err := repo.UpdateByID(staffCtx, &model.Order{OrderID: 1, CustomerID: 0})
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrInvalidInput)
 }
@@ -230,12 +822,12 @@ func TestUpdateByID_Fails_WhenCustomerIDZero(t *testing.T) {
 func TestDeleteByID_Success(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
-	ctx := context.Background()
+	ctx := staffCtx
 
 	o := &model.Order{CustomerID: 1}
 	require.NoError(t, repo.Insert(ctx, o))
 
-	require.NoError(t, repo.DeleteByID(ctx, o.OrderID))
+	require.NoError(t, repo.DeleteByID(ctx, o.OrderID, o.Version))
 
 	_, err := repo.FindByID(ctx, o.OrderID)
 	assert.ErrorIs(t, err, ErrNotExist)
@@ -245,15 +837,32 @@ func TestDeleteByID_NotFound(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	err := repo.DeleteByID(context.Background(), 999)
+	err := repo.DeleteByID(staffCtx, 999, 0)
 	assert.ErrorIs(t, err, ErrNotExist)
 }
 
+func TestDeleteByID_Fails_WhenVersionStale(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+	o.Status = model.StatusPaid
+	require.NoError(t, repo.UpdateByID(ctx, o))
+
+	err := repo.DeleteByID(ctx, o.OrderID, 1)
+	assert.ErrorIs(t, err, ErrVersionConflict)
+
+	_, err = repo.FindByID(ctx, o.OrderID)
+	assert.NoError(t, err)
+}
+
 func TestDeleteByID_Fails_WhenIDZero(t *testing.T) {
 	db := setupTestDB(t)
 	repo := NewOrderRepo(db)
 
-	err := repo.DeleteByID(context.Background(), 0)
+	err := repo.DeleteByID(staffCtx, 0, 0)
 	assert.Error(t, err)
 	assert.ErrorIs(t, err, ErrInvalidInput)
 }
@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// recordEvent writes an event of the given type describing order to the
+// outbox. It must run in the transaction that made the change, so that the
+// event is stored if and only if the change is.
+func recordEvent(tx *gorm.DB, eventType string, order *model.Order) error {
+	payload, err := json.Marshal(order)
+	if err != nil {
+		return fmt.Errorf("encode %s event of order %d: %w", eventType, order.OrderID, err)
+	}
+
+	now := time.Now().UTC()
+	event := model.OutboxEvent{
+		Type:          eventType,
+		OrderID:       order.OrderID,
+		CustomerID:    order.CustomerID,
+		Payload:       payload,
+		CreatedAt:     now,
+		NextAttemptAt: now,
+	}
+	if err := tx.Create(&event).Error; err != nil {
+		return fmt.Errorf("record %s event of order %d: %w", eventType, order.OrderID, err)
+	}
+	return nil
+}
+
+// OutboxRepo reads and updates the delivery state of outbox events for the
+// outbox relay.
+type OutboxRepo struct {
+	DB *gorm.DB
+}
+
+func NewOutboxRepo(db *gorm.DB) *OutboxRepo {
+	return &OutboxRepo{DB: db}
+}
+
+// Claim returns up to limit pending events that are due at now, oldest
+// first, and leases them until now+lease: until then no other call claims
+// them, and if they are neither delivered nor failed by then they become
+// due again. An event is only claimed once every earlier pending event of
+// its order has been delivered or dead-lettered, so each order's events are
+// delivered in order.
+func (r *OutboxRepo) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+
+	err := r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		query := tx.
+			Where("delivered_at IS NULL AND dead_lettered_at IS NULL AND next_attempt_at <= ?", now).
+			Where("NOT EXISTS (SELECT 1 FROM outbox earlier WHERE earlier.order_id = outbox.order_id" +
+				" AND earlier.id < outbox.id AND earlier.delivered_at IS NULL AND earlier.dead_lettered_at IS NULL)").
+			Order("id").
+			Limit(limit)
+
+		// Replicas claim disjoint batches instead of waiting on each other.
+		if tx.Dialector.Name() == "postgres" {
+			query = query.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"})
+		}
+
+		if err := query.Find(&events).Error; err != nil {
+			return fmt.Errorf("claim outbox events: %w", err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(events))
+		for i, e := range events {
+			ids[i] = e.ID
+		}
+		if err := tx.Model(&model.OutboxEvent{}).
+			Where("id IN ?", ids).
+			Update("next_attempt_at", now.Add(lease)).Error; err != nil {
+			return fmt.Errorf("lease outbox events: %w", err)
+		}
+		return nil
+	})
+
+	return events, err
+}
+
+// MarkDelivered records that event id has been delivered.
+func (r *OutboxRepo) MarkDelivered(ctx context.Context, id int64, at time.Time) error {
+	if err := r.DB.WithContext(ctx).Model(&model.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":     gorm.Expr("attempts + 1"),
+			"delivered_at": at,
+			"last_error":   "",
+		}).Error; err != nil {
+		return fmt.Errorf("mark outbox event %d delivered: %w", id, err)
+	}
+	return nil
+}
+
+// MarkFailed records a failed delivery of event id, to be retried at next.
+func (r *OutboxRepo) MarkFailed(ctx context.Context, id int64, next time.Time, cause error) error {
+	if err := r.DB.WithContext(ctx).Model(&model.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": next,
+			"last_error":      cause.Error(),
+		}).Error; err != nil {
+		return fmt.Errorf("mark outbox event %d failed: %w", id, err)
+	}
+	return nil
+}
+
+// MarkDeadLettered records that delivery of event id has been given up after
+// a last failure. The event stays in the outbox for inspection.
+func (r *OutboxRepo) MarkDeadLettered(ctx context.Context, id int64, at time.Time, cause error) error {
+	if err := r.DB.WithContext(ctx).Model(&model.OutboxEvent{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"attempts":         gorm.Expr("attempts + 1"),
+			"dead_lettered_at": at,
+			"last_error":       cause.Error(),
+		}).Error; err != nil {
+		return fmt.Errorf("dead-letter outbox event %d: %w", id, err)
+	}
+	return nil
+}
+
+// Purge deletes the events delivered before before and returns how many
+// were deleted. Dead-lettered events are kept.
+func (r *OutboxRepo) Purge(ctx context.Context, before time.Time) (int64, error) {
+	result := r.DB.WithContext(ctx).
+		Where("delivered_at < ?", before).
+		Delete(&model.OutboxEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("purge outbox events: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// Latest returns the limit most recent events, delivered or not, oldest
+// first.
+func (r *OutboxRepo) Latest(ctx context.Context, limit int) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+	if err := r.DB.WithContext(ctx).Order("id DESC").Limit(limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("find latest outbox events: %w", err)
+	}
+	slices.Reverse(events)
+	return events, nil
+}
+
+// After returns up to limit events, delivered or not, whose ID is greater
+// than id, oldest first.
+func (r *OutboxRepo) After(ctx context.Context, id int64, limit int) ([]model.OutboxEvent, error) {
+	var events []model.OutboxEvent
+	if err := r.DB.WithContext(ctx).Where("id > ?", id).Order("id").Limit(limit).Find(&events).Error; err != nil {
+		return nil, fmt.Errorf("find outbox events after %d: %w", id, err)
+	}
+	return events, nil
+}
@@ -0,0 +1,231 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func outboxEvents(t *testing.T, db *gorm.DB) []model.OutboxEvent {
+	t.Helper()
+
+	var events []model.OutboxEvent
+	require.NoError(t, db.Order("id").Find(&events).Error)
+	return events
+}
+
+func eventTypes(events []model.OutboxEvent) []string {
+	types := make([]string, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+//
+// EVENTS RECORDED BY ORDER REPO
+//
+
+func TestOutbox_RecordsOrderLifecycle(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 7, LineItems: []model.LineItem{
+		{SKU: "A", Quantity: 2, Price: 500},
+	}}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	o.Status = model.StatusPaid
+	require.NoError(t, repo.UpdateByID(ctx, o))
+	require.NoError(t, repo.DeleteByID(ctx, o.OrderID, o.Version))
+
+	events := outboxEvents(t, db)
+	assert.Equal(t, []string{"order.created", "order.paid", "order.deleted"}, eventTypes(events))
+
+	for _, e := range events {
+		assert.Equal(t, o.OrderID, e.OrderID)
+		assert.Equal(t, int64(7), e.CustomerID)
+		assert.Nil(t, e.DeliveredAt)
+	}
+
+	var paid model.Order
+	require.NoError(t, json.Unmarshal(events[1].Payload, &paid))
+	assert.Equal(t, model.StatusPaid, paid.Status)
+	assert.Equal(t, int64(2), paid.Version)
+	require.Len(t, paid.LineItems, 1, "the payload is the whole order")
+	assert.Equal(t, uint64(1000), paid.GrandTotal)
+}
+
+func TestOutbox_RecordsLineItemChanges(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	_, err := repo.InsertLineItem(ctx, &model.LineItem{OrderID: o.OrderID, Quantity: 1, Price: 250}, 0)
+	require.NoError(t, err)
+
+	events := outboxEvents(t, db)
+	require.Equal(t, []string{"order.created", "order.updated"}, eventTypes(events))
+
+	var updated model.Order
+	require.NoError(t, json.Unmarshal(events[1].Payload, &updated))
+	assert.Equal(t, uint64(250), updated.GrandTotal)
+}
+
+func TestOutbox_NoEventWhenChangeFails(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, repo.Insert(ctx, o))
+
+	stale := *o
+	stale.Version = 99
+	stale.Status = model.StatusPaid
+	require.ErrorIs(t, repo.UpdateByID(ctx, &stale), ErrVersionConflict)
+	require.ErrorIs(t, repo.DeleteByID(ctx, o.OrderID, 99), ErrVersionConflict)
+
+	assert.Equal(t, []string{"order.created"}, eventTypes(outboxEvents(t, db)))
+}
+
+func TestOutbox_RolledBackWithItsChange(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	// Fail the event insert; the order must not be stored without it.
+	require.NoError(t, db.Callback().Create().Before("gorm:create").Register("fail_outbox", func(tx *gorm.DB) {
+		if tx.Statement.Table == "outbox" {
+			tx.AddError(errors.New("outbox unavailable"))
+		}
+	}))
+
+	err := repo.Insert(ctx, &model.Order{CustomerID: 1})
+	require.Error(t, err)
+
+	var count int64
+	require.NoError(t, db.Model(&model.Order{}).Count(&count).Error)
+	assert.Zero(t, count)
+}
+
+//
+// OUTBOX REPO
+//
+
+func TestOutboxRepo_ClaimLeasesEvents(t *testing.T) {
+	db := setupTestDB(t)
+	orders := NewOrderRepo(db)
+	outbox := NewOutboxRepo(db)
+	ctx := staffCtx
+
+	for range 3 {
+		require.NoError(t, orders.Insert(ctx, &model.Order{CustomerID: 1}))
+	}
+
+	now := time.Now().UTC().Add(time.Second)
+	claimed, err := outbox.Claim(ctx, now, time.Minute, 2)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2)
+	assert.Less(t, claimed[0].ID, claimed[1].ID)
+
+	// Leased events are not claimed again until the lease expires.
+	rest, err := outbox.Claim(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, rest, 1)
+
+	none, err := outbox.Claim(ctx, now.Add(30*time.Second), time.Minute, 10)
+	require.NoError(t, err)
+	assert.Empty(t, none)
+
+	expired, err := outbox.Claim(ctx, now.Add(2*time.Minute), time.Minute, 10)
+	require.NoError(t, err)
+	assert.Len(t, expired, 3)
+}
+
+func TestOutboxRepo_ClaimKeepsOrderOfEachOrder(t *testing.T) {
+	db := setupTestDB(t)
+	orders := NewOrderRepo(db)
+	outbox := NewOutboxRepo(db)
+	ctx := staffCtx
+
+	a := &model.Order{CustomerID: 1}
+	require.NoError(t, orders.Insert(ctx, a))
+	a.Status = model.StatusPaid
+	require.NoError(t, orders.UpdateByID(ctx, a))
+	b := &model.Order{CustomerID: 2}
+	require.NoError(t, orders.Insert(ctx, b))
+
+	now := time.Now().UTC().Add(time.Second)
+	claimed, err := outbox.Claim(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 2, "order.paid waits for order.created of the same order")
+	assert.Equal(t, []string{"order.created", "order.created"}, eventTypes(claimed))
+
+	// A failed event holds back the later events of its order.
+	require.NoError(t, outbox.MarkFailed(ctx, claimed[0].ID, now, errors.New("boom")))
+	require.NoError(t, outbox.MarkDelivered(ctx, claimed[1].ID, now))
+	retried, err := outbox.Claim(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, retried, 1)
+	assert.Equal(t, claimed[0].ID, retried[0].ID)
+	assert.Equal(t, 1, retried[0].Attempts)
+	assert.Equal(t, "boom", retried[0].LastError)
+
+	require.NoError(t, outbox.MarkDeadLettered(ctx, retried[0].ID, now, errors.New("boom")))
+	next, err := outbox.Claim(ctx, now, time.Minute, 10)
+	require.NoError(t, err)
+	require.Len(t, next, 1)
+	assert.Equal(t, "order.paid", next[0].Type)
+}
+
+func TestOutboxRepo_PurgeKeepsPendingAndDeadLettered(t *testing.T) {
+	db := setupTestDB(t)
+	orders := NewOrderRepo(db)
+	outbox := NewOutboxRepo(db)
+	ctx := staffCtx
+
+	for range 3 {
+		require.NoError(t, orders.Insert(ctx, &model.Order{CustomerID: 1}))
+	}
+	events := outboxEvents(t, db)
+	past := time.Now().UTC().Add(-time.Hour)
+	require.NoError(t, outbox.MarkDelivered(ctx, events[0].ID, past))
+	require.NoError(t, outbox.MarkDeadLettered(ctx, events[1].ID, past, errors.New("boom")))
+
+	n, err := outbox.Purge(ctx, time.Now().UTC())
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Len(t, outboxEvents(t, db), 2)
+}
+
+func TestOutboxRepo_LatestAndAfter(t *testing.T) {
+	db := setupTestDB(t)
+	orders := NewOrderRepo(db)
+	outbox := NewOutboxRepo(db)
+	ctx := staffCtx
+
+	for range 4 {
+		require.NoError(t, orders.Insert(ctx, &model.Order{CustomerID: 1}))
+	}
+	events := outboxEvents(t, db)
+	require.NoError(t, outbox.MarkDelivered(ctx, events[3].ID, time.Now().UTC()))
+
+	latest, err := outbox.Latest(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{events[2].ID, events[3].ID}, []int64{latest[0].ID, latest[1].ID})
+
+	after, err := outbox.After(ctx, events[0].ID, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{events[1].ID, events[2].ID}, []int64{after[0].ID, after[1].ID})
+}
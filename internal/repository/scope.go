@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// Scope restricts the orders that OrderRepository calls may see and change.
+// Access is denied by default: the zero Scope, and a context without one,
+// match no orders. Staff and internal jobs use Unrestricted; customers a
+// Scope with their CustomerID.
+//
+// The scope travels in the request context (see WithScope) rather than as
+// an argument, so that every order query is restricted and a handler cannot
+// forget to pass it. Orders outside the scope look like they do not exist.
+type Scope struct {
+	All        bool  // every customer's orders
+	CustomerID int64 // otherwise, only this customer's orders
+}
+
+// Unrestricted is the scope of staff and internal jobs.
+var Unrestricted = Scope{All: true}
+
+type scopeContextKey struct{}
+
+// WithScope returns a copy of ctx in which order repository calls are
+// restricted to s.
+func WithScope(ctx context.Context, s Scope) context.Context {
+	return context.WithValue(ctx, scopeContextKey{}, s)
+}
+
+// ScopeFrom returns the scope stored in ctx by WithScope, or the zero
+// Scope, which matches no orders.
+func ScopeFrom(ctx context.Context) Scope {
+	s, _ := ctx.Value(scopeContextKey{}).(Scope)
+	return s
+}
+
+// Restricted reports whether s limits access at all.
+func (s Scope) Restricted() bool {
+	return !s.All
+}
+
+// allows reports whether an order of customerID is within s.
+func (s Scope) allows(customerID int64) bool {
+	return s.All || (s.CustomerID != 0 && s.CustomerID == customerID)
+}
+
+// apply restricts an orders query to s.
+func (s Scope) apply(query *gorm.DB) *gorm.DB {
+	switch {
+	case s.All:
+		return query
+	case s.CustomerID == 0:
+		return query.Where("1 = 0")
+	}
+	return query.Where(customerIDColumn+" = ?", s.CustomerID)
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scopedOrders stores one order for customer 1 and one for customer 2 and
+// returns them with a context scoped to customer 1.
+func scopedOrders(t *testing.T, repo OrderRepository) (context.Context, *model.Order, *model.Order) {
+	t.Helper()
+
+	own := &model.Order{CustomerID: 1, LineItems: []model.LineItem{{Quantity: 1, Price: 100}}}
+	other := &model.Order{CustomerID: 2, LineItems: []model.LineItem{{Quantity: 1, Price: 100}}}
+	require.NoError(t, repo.Insert(staffCtx, own))
+	require.NoError(t, repo.Insert(staffCtx, other))
+
+	return WithScope(context.Background(), Scope{CustomerID: 1}), own, other
+}
+
+func TestScope_RestrictsReads(t *testing.T) {
+	repo := NewOrderRepo(setupTestDB(t))
+	ctx, own, other := scopedOrders(t, repo)
+
+	res, err := repo.FindAll(ctx, Page{})
+	require.NoError(t, err)
+	require.Len(t, res.Orders, 1)
+	assert.Equal(t, own.OrderID, res.Orders[0].OrderID)
+
+	// Filtering for another customer cannot widen the scope.
+	res, err = repo.FindAll(ctx, Page{Filter: Filter{CustomerID: 2}})
+	require.NoError(t, err)
+	assert.Empty(t, res.Orders)
+
+	_, err = repo.FindByID(ctx, own.OrderID)
+	assert.NoError(t, err)
+	_, err = repo.FindByID(ctx, other.OrderID)
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	_, err = repo.ListLineItems(ctx, other.OrderID)
+	assert.ErrorIs(t, err, ErrNotExist)
+}
+
+func TestScope_RestrictsWrites(t *testing.T) {
+	repo := NewOrderRepo(setupTestDB(t))
+	ctx, own, other := scopedOrders(t, repo)
+
+	err := repo.Insert(ctx, &model.Order{CustomerID: 2})
+	assert.ErrorIs(t, err, ErrOutOfScope)
+	require.NoError(t, repo.Insert(ctx, &model.Order{CustomerID: 1}))
+
+	foreign := *other
+	foreign.Status = model.StatusPaid
+	assert.ErrorIs(t, repo.UpdateByID(ctx, &foreign), ErrOutOfScope)
+
+	// Claiming the other customer's order as one's own does not help either.
+	foreign.CustomerID = 1
+	assert.ErrorIs(t, repo.UpdateByID(ctx, &foreign), ErrNotExist)
+
+	moved := *own
+	moved.CustomerID = 2
+	assert.ErrorIs(t, repo.UpdateByID(ctx, &moved), ErrOutOfScope)
+
+	assert.ErrorIs(t, repo.DeleteByID(ctx, other.OrderID, 0), ErrNotExist)
+	_, err = repo.InsertLineItem(ctx, &model.LineItem{OrderID: other.OrderID, Quantity: 1}, 0)
+	assert.ErrorIs(t, err, ErrNotExist)
+	_, err = repo.DeleteLineItem(ctx, other.OrderID, other.LineItems[0].ItemID, 0)
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	item := other.LineItems[0]
+	item.Quantity = 9
+	_, err = repo.UpdateLineItem(ctx, &item, 0)
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	// The other customer's order is untouched.
+	stored, err := repo.FindByID(staffCtx, other.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, other.Version, stored.Version)
+	assert.Equal(t, uint(1), stored.LineItems[0].Quantity)
+
+	require.NoError(t, repo.DeleteByID(ctx, own.OrderID, 0))
+}
+
+func TestScope_DeniesByDefault(t *testing.T) {
+	repo := NewOrderRepo(setupTestDB(t))
+	_, own, _ := scopedOrders(t, repo)
+
+	for name, ctx := range map[string]context.Context{
+		"no scope":   context.Background(),
+		"zero scope": WithScope(context.Background(), Scope{}),
+	} {
+		res, err := repo.FindAll(ctx, Page{})
+		require.NoError(t, err, name)
+		assert.Empty(t, res.Orders, name)
+
+		_, err = repo.FindByID(ctx, own.OrderID)
+		assert.ErrorIs(t, err, ErrNotExist, name)
+		assert.ErrorIs(t, repo.Insert(ctx, &model.Order{CustomerID: 1}), ErrOutOfScope, name)
+		assert.ErrorIs(t, repo.DeleteByID(ctx, own.OrderID, 0), ErrNotExist, name)
+	}
+	assert.True(t, ScopeFrom(context.Background()).Restricted())
+
+	res, err := repo.FindAll(WithScope(context.Background(), Unrestricted), Page{})
+	require.NoError(t, err)
+	assert.Len(t, res.Orders, 2)
+}
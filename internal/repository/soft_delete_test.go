@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func insertOrderWithItem(t *testing.T, repo OrderRepository, customerID int64) *model.Order {
+	t.Helper()
+
+	o := &model.Order{CustomerID: customerID, LineItems: []model.LineItem{
+		{SKU: "A", Quantity: 1, Price: 100},
+	}}
+	require.NoError(t, repo.Insert(staffCtx, o))
+	return o
+}
+
+func TestDeleteByID_IsSoft(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := insertOrderWithItem(t, repo, 7)
+	kept := insertOrderWithItem(t, repo, 7)
+	require.NoError(t, repo.DeleteByID(ctx, o.OrderID, 0))
+
+	_, err := repo.FindByID(ctx, o.OrderID)
+	assert.ErrorIs(t, err, ErrNotExist)
+	_, err = repo.ListLineItems(ctx, o.OrderID)
+	assert.ErrorIs(t, err, ErrNotExist)
+	o.Status = model.StatusPaid
+	assert.ErrorIs(t, repo.UpdateByID(ctx, o), ErrNotExist)
+	assert.ErrorIs(t, repo.DeleteByID(ctx, o.OrderID, 0), ErrNotExist)
+
+	res, err := repo.FindAll(ctx, Page{})
+	require.NoError(t, err)
+	require.Len(t, res.Orders, 1)
+	assert.Equal(t, kept.OrderID, res.Orders[0].OrderID)
+
+	res, err = repo.FindAll(ctx, Page{Filter: Filter{IncludeDeleted: true}})
+	require.NoError(t, err)
+	require.Len(t, res.Orders, 2)
+	assert.True(t, res.Orders[0].DeletedAt.Valid)
+	assert.Len(t, res.Orders[0].LineItems, 1, "line items are kept")
+	assert.False(t, res.Orders[1].DeletedAt.Valid)
+}
+
+func TestRestore(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	o := insertOrderWithItem(t, repo, 7)
+	require.NoError(t, repo.DeleteByID(ctx, o.OrderID, 0))
+
+	_, err := repo.Restore(WithScope(ctx, Scope{CustomerID: 8}), o.OrderID)
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	restored, err := repo.Restore(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.False(t, restored.DeletedAt.Valid)
+	assert.Equal(t, int64(2), restored.Version)
+	assert.Len(t, restored.LineItems, 1)
+
+	found, err := repo.FindByID(ctx, o.OrderID)
+	require.NoError(t, err)
+	assert.Equal(t, restored.Version, found.Version)
+
+	_, err = repo.Restore(ctx, o.OrderID)
+	assert.ErrorIs(t, err, ErrNotDeleted)
+	_, err = repo.Restore(ctx, o.OrderID+100)
+	assert.ErrorIs(t, err, ErrNotExist)
+
+	entries := history(t, repo, ctx, o.OrderID)
+	assert.Equal(t, []string{"create", "delete", "restore"}, operations(entries))
+	assert.Contains(t, entries[2].Changes, "deleted_at")
+	assert.JSONEq(t, `null`, string(entries[2].Changes["deleted_at"].To))
+
+	assert.Equal(t, []string{"order.created", "order.deleted", "order.restored"}, eventTypes(outboxEvents(t, db)))
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewOrderRepo(db)
+	ctx := staffCtx
+
+	old := insertOrderWithItem(t, repo, 7)
+	recent := insertOrderWithItem(t, repo, 7)
+	live := insertOrderWithItem(t, repo, 7)
+	require.NoError(t, repo.DeleteByID(ctx, old.OrderID, 0))
+	require.NoError(t, repo.DeleteByID(ctx, recent.OrderID, 0))
+
+	longAgo := time.Now().UTC().AddDate(0, 0, -40)
+	require.NoError(t, db.Unscoped().Model(&model.Order{}).
+		Where("order_id = ?", old.OrderID).
+		Update("deleted_at", longAgo).Error)
+
+	n, err := repo.PurgeDeleted(ctx, time.Now().UTC().AddDate(0, 0, -30))
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	var orders []model.Order
+	require.NoError(t, db.Unscoped().Order("order_id").Find(&orders).Error)
+	require.Len(t, orders, 2)
+	assert.Equal(t, recent.OrderID, orders[0].OrderID)
+	assert.Equal(t, live.OrderID, orders[1].OrderID)
+
+	var items int64
+	require.NoError(t, db.Model(&model.LineItem{}).Where("order_id = ?", old.OrderID).Count(&items).Error)
+	assert.Zero(t, items)
+
+	_, err = repo.Restore(ctx, old.OrderID)
+	assert.ErrorIs(t, err, ErrNotExist)
+	assert.Equal(t, []string{"create", "delete", "purge"}, operations(history(t, repo, ctx, old.OrderID)))
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SortField is a single key of a listing's ordering.
+type SortField struct {
+	Column string
+	Desc   bool
+}
+
+// Sort is an ordered list of sort keys, e.g. "created_at,-order_id".
+type Sort []SortField
+
+// sortableColumns lists the columns a listing may be ordered by.
+var sortableColumns = map[string]bool{
+	orderIDColumn:    true,
+	customerIDColumn: true,
+	createdAtColumn:  true,
+	grandTotalColumn: true,
+}
+
+// nullableColumns lists the sortable columns that may be NULL: orders stored
+// before created_at was recorded lack it. NULL sorts after every value, as
+// Postgres does by default, so that the (created_at, order_id) index still
+// serves both directions; orderClause and seekCondition spell this out for
+// databases that disagree.
+var nullableColumns = map[string]bool{
+	createdAtColumn: true,
+}
+
+// ParseSort parses a comma-separated list of columns, each optionally
+// prefixed with "-" for descending order.
+func ParseSort(s string) (Sort, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+
+	var sort Sort
+	seen := make(map[string]bool)
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+
+		field := SortField{Column: part}
+		if col, ok := strings.CutPrefix(part, "-"); ok {
+			field = SortField{Column: col, Desc: true}
+		}
+
+		if !sortableColumns[field.Column] {
+			return nil, fmt.Errorf("unknown sort column %q: %w", field.Column, ErrInvalidInput)
+		}
+		if seen[field.Column] {
+			return nil, fmt.Errorf("duplicate sort column %q: %w", field.Column, ErrInvalidInput)
+		}
+		seen[field.Column] = true
+
+		sort = append(sort, field)
+	}
+
+	return sort, nil
+}
+
+// String returns s in the format accepted by ParseSort.
+func (s Sort) String() string {
+	parts := make([]string, len(s))
+	for i, f := range s {
+		if f.Desc {
+			parts[i] = "-" + f.Column
+		} else {
+			parts[i] = f.Column
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// keyset returns s with order_id appended as a final tie-breaker, so that
+// every row has a unique position. An empty sort orders by order_id.
+func (s Sort) keyset() Sort {
+	for _, f := range s {
+		if f.Column == orderIDColumn {
+			return s
+		}
+	}
+	return append(append(Sort{}, s...), SortField{Column: orderIDColumn})
+}
+
+// orderClause renders s as an SQL ORDER BY expression.
+func (s Sort) orderClause() string {
+	parts := make([]string, len(s))
+	for i, f := range s {
+		switch {
+		case f.Desc && nullableColumns[f.Column]:
+			parts[i] = f.Column + " DESC NULLS FIRST"
+		case f.Desc:
+			parts[i] = f.Column + " DESC"
+		case nullableColumns[f.Column]:
+			parts[i] = f.Column + " ASC NULLS LAST"
+		default:
+			parts[i] = f.Column + " ASC"
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// seekCondition builds the WHERE clause selecting the rows that come after c
+// in the ordering s. A nil cursor value stands for NULL.
+func (s Sort) seekCondition(c Cursor) (string, []any) {
+	var (
+		clauses []string
+		args    []any
+	)
+
+	for i, f := range s {
+		var parts []string
+		var partArgs []any
+		for _, prev := range s[:i] {
+			if v := c.value(prev.Column); v != nil {
+				parts = append(parts, prev.Column+" = ?")
+				partArgs = append(partArgs, v)
+			} else {
+				parts = append(parts, prev.Column+" IS NULL")
+			}
+		}
+
+		after, afterArgs, ok := f.after(c.value(f.Column))
+		if !ok {
+			continue // nothing comes after c in this column
+		}
+		parts = append(parts, after)
+
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+		args = append(append(args, partArgs...), afterArgs...)
+	}
+
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+// after returns the condition selecting the values of f that sort after v,
+// where NULL sorts after every value and a nil v stands for NULL. ok is false
+// if no value does.
+func (f SortField) after(v any) (cond string, args []any, ok bool) {
+	switch {
+	case v == nil && f.Desc:
+		return f.Column + " IS NOT NULL", nil, true
+	case v == nil:
+		return "", nil, false
+	case f.Desc:
+		return f.Column + " < ?", []any{v}, true
+	case nullableColumns[f.Column]:
+		return "(" + f.Column + " > ? OR " + f.Column + " IS NULL)", []any{v}, true
+	default:
+		return f.Column + " > ?", []any{v}, true
+	}
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSort_Success(t *testing.T) {
+	sort, err := ParseSort("created_at, -order_id")
+
+	require.NoError(t, err)
+	assert.Equal(t, Sort{{Column: "created_at"}, {Column: "order_id", Desc: true}}, sort)
+	assert.Equal(t, "created_at,-order_id", sort.String())
+}
+
+func TestParseSort_Empty(t *testing.T) {
+	sort, err := ParseSort("")
+
+	require.NoError(t, err)
+	assert.Empty(t, sort)
+	assert.Equal(t, "order_id", sort.keyset().String())
+}
+
+func TestParseSort_Fails_WhenUnknownColumn(t *testing.T) {
+	_, err := ParseSort("shipped_at")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestParseSort_Fails_WhenDuplicateColumn(t *testing.T) {
+	_, err := ParseSort("created_at,-created_at")
+	assert.ErrorIs(t, err, ErrInvalidInput)
+}
+
+func TestSort_KeysetAppendsTieBreaker(t *testing.T) {
+	sort, err := ParseSort("-created_at")
+	require.NoError(t, err)
+
+	assert.Equal(t, "-created_at,order_id", sort.keyset().String())
+}
@@ -3,38 +3,122 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/corradoisidoro/orders-api/internal/model"
 )
 
-// OrderRepository defines the contract for order persistence.
+// OrderRepository defines the contract for order persistence. Every method
+// honours the Scope stored in its context by WithScope.
 type OrderRepository interface {
 	Insert(ctx context.Context, order *model.Order) error
 	FindAll(ctx context.Context, page Page) (Result, error)
 	FindByID(ctx context.Context, id int64) (model.Order, error)
 	UpdateByID(ctx context.Context, order *model.Order) error
-	DeleteByID(ctx context.Context, id int64) error
+	DeleteByID(ctx context.Context, id int64, version int64) error
+	Restore(ctx context.Context, id int64) (model.Order, error)
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	History(ctx context.Context, orderID int64, page HistoryPage) (HistoryResult, error)
+
+	ListLineItems(ctx context.Context, orderID int64) ([]model.LineItem, error)
+	InsertLineItem(ctx context.Context, item *model.LineItem, version int64) (int64, error)
+	UpdateLineItem(ctx context.Context, item *model.LineItem, version int64) (int64, error)
+	DeleteLineItem(ctx context.Context, orderID, itemID, version int64) (int64, error)
+}
+
+// WebhookRepository defines the contract for managing webhook subscriptions.
+type WebhookRepository interface {
+	Create(ctx context.Context, hook *model.Webhook) error
+	List(ctx context.Context) ([]model.Webhook, error)
+	FindByID(ctx context.Context, id int64) (model.Webhook, error)
+	Delete(ctx context.Context, id int64) error
+	ListDeliveries(ctx context.Context, webhookID int64, limit int) ([]model.WebhookDelivery, error)
 }
 
 // Domain-level errors returned by the repository.
 var (
-	ErrNotExist     = errors.New("order does not exist")
-	ErrInvalidInput = errors.New("invalid input provided")
+	ErrNotExist      = errors.New("order does not exist")
+	ErrInvalidInput  = errors.New("invalid input provided")
+	ErrInvalidCursor = errors.New("invalid cursor")
+
+	ErrVersionConflict  = errors.New("order was modified concurrently")
+	ErrLineItemNotExist = errors.New("line item does not exist")
+	ErrOrderLocked      = errors.New("order can no longer be modified")
+	ErrOutOfScope       = errors.New("order belongs to another customer")
+	ErrNotDeleted       = errors.New("order is not deleted")
+
+	ErrAPIKeyNotExist  = errors.New("API key does not exist")
+	ErrWebhookNotExist = errors.New("webhook does not exist")
 )
 
-// Page represents pagination parameters.
+// ValidationError reports which field of an order was rejected and why, in
+// terms safe to show to clients. It matches ErrInvalidInput.
+type ValidationError struct {
+	Field  string // JSON path of the field, such as "line_items[1].currency"
+	Reason string // such as "must match the order's currency"
+}
+
+func (e *ValidationError) Error() string { return e.Field + " " + e.Reason }
+
+func (e *ValidationError) Is(target error) bool { return target == ErrInvalidInput }
+
+// Page represents keyset pagination parameters.
 type Page struct {
-	Size   int64 // number of items to return; 0 means "no limit"
-	Offset int64 // cursor/offset for pagination; must be >= 0
+	Size   int64   // number of items to return; 0 means "no limit"
+	After  *Cursor // position of the last item of the previous page; nil starts at the beginning
+	Sort   Sort    // ordering of the listing; empty means order_id ascending
+	Filter Filter  // restricts which orders are listed
+}
+
+// Filter narrows a listing. Zero-valued fields do not filter.
+type Filter struct {
+	CustomerID  int64        // only orders of this customer
+	Status      model.Status // only orders in this status
+	CreatedFrom *time.Time   // created_at >= CreatedFrom
+	CreatedTo   *time.Time   // created_at < CreatedTo
+	ShippedFrom *time.Time   // shipped_at >= ShippedFrom
+	ShippedTo   *time.Time   // shipped_at < ShippedTo
+	MinTotal    *uint64      // grand total >= MinTotal
+	MaxTotal    *uint64      // grand total <= MaxTotal
+
+	IncludeDeleted bool // also list deleted orders, which are otherwise hidden
 }
 
 // Result represents a paginated list of orders.
 type Result struct {
 	Orders []model.Order
-	Cursor int64 // cursor for the next page
+	Next   *Cursor // cursor for the next page; nil when there are no more orders
 }
 
+// HistoryPage selects a page of an order's history.
+type HistoryPage struct {
+	Size  int64 // number of entries to return; 0 means "no limit"
+	After int64 // ID of the last entry of the previous page; 0 starts at the beginning
+}
+
+// HistoryResult represents a page of an order's history.
+type HistoryResult struct {
+	Entries []model.OrderHistory
+	Next    int64 // After for the next page; 0 when there are no more entries
+}
+
+// totalColumns are the order columns maintained by recomputeTotals.
+var totalColumns = []string{"subtotal", "discount_total", "tax_total", grandTotalColumn}
+
 // Internal constants used across the repository.
 const (
-	orderIDColumn = "order_id"
+	orderIDColumn    = "order_id"
+	itemIDColumn     = "item_id"
+	customerIDColumn = "customer_id"
+	statusColumn     = "status"
+	createdAtColumn  = "created_at"
+	shippedAtColumn  = "shipped_at"
+	grandTotalColumn = "grand_total"
+	versionColumn    = "version"
+	deletedAtColumn  = "deleted_at"
+
+	purgeBatchSize = 500 // orders removed per transaction by PurgeDeleted
+
+	maxSKULength         = 64
+	maxProductNameLength = 255
 )
@@ -1,9 +1,11 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
 
 	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/pricing"
 )
 
 // validateID ensures the ID is positive.
@@ -16,12 +18,54 @@ func validateID(id int64) error {
 
 // validatePage ensures pagination parameters are valid.
 func validatePage(page Page) error {
-	if page.Offset < 0 {
-		return fmt.Errorf("invalid offset %d: %w", page.Offset, ErrInvalidInput)
-	}
 	if page.Size < 0 {
 		return fmt.Errorf("invalid size %d: %w", page.Size, ErrInvalidInput)
 	}
+
+	for _, f := range page.Sort {
+		if !sortableColumns[f.Column] {
+			return fmt.Errorf("invalid sort column %q: %w", f.Column, ErrInvalidInput)
+		}
+	}
+
+	if err := validateFilter(page.Filter); err != nil {
+		return err
+	}
+
+	if page.After == nil {
+		return nil
+	}
+
+	keyset := page.Sort.keyset()
+	if page.After.Sort != keyset.String() {
+		return fmt.Errorf("cursor sort %q does not match %q: %w", page.After.Sort, keyset.String(), ErrInvalidCursor)
+	}
+	for _, f := range keyset {
+		if page.After.value(f.Column) == nil && !nullableColumns[f.Column] {
+			return fmt.Errorf("cursor missing %s: %w", f.Column, ErrInvalidCursor)
+		}
+	}
+	if page.After.OrderID <= 0 {
+		return fmt.Errorf("cursor order ID %d: %w", page.After.OrderID, ErrInvalidCursor)
+	}
+	return nil
+}
+
+// validateFilter ensures listing filters are consistent.
+func validateFilter(f Filter) error {
+	if f.CustomerID < 0 {
+		return fmt.Errorf("invalid customer ID %d: %w", f.CustomerID, ErrInvalidInput)
+	}
+
+	if f.CreatedFrom != nil && f.CreatedTo != nil && f.CreatedFrom.After(*f.CreatedTo) {
+		return fmt.Errorf("created range is inverted: %w", ErrInvalidInput)
+	}
+	if f.ShippedFrom != nil && f.ShippedTo != nil && f.ShippedFrom.After(*f.ShippedTo) {
+		return fmt.Errorf("shipped range is inverted: %w", ErrInvalidInput)
+	}
+	if f.MinTotal != nil && f.MaxTotal != nil && *f.MinTotal > *f.MaxTotal {
+		return fmt.Errorf("total range is inverted: %w", ErrInvalidInput)
+	}
 	return nil
 }
 
@@ -31,7 +75,29 @@ func validateOrderForInsert(order *model.Order) error {
 		return fmt.Errorf("order cannot be nil: %w", ErrInvalidInput)
 	}
 	if order.CustomerID < 1 {
-		return fmt.Errorf("customer ID is required for insert: %w", ErrInvalidInput)
+		return &ValidationError{Field: "customer_id", Reason: "is required"}
+	}
+	return validateOrderItems(order)
+}
+
+// validateOrderItems ensures the order's currency is well formed and that
+// every line item is valid and priced in that same currency.
+func validateOrderItems(order *model.Order) error {
+	if order.Currency != "" && !order.Currency.Valid() {
+		return &ValidationError{Field: "currency", Reason: "must be an ISO 4217 code"}
+	}
+	for i := range order.LineItems {
+		item := &order.LineItems[i]
+		field := fmt.Sprintf("line_items[%d]", i)
+		if item.Quantity < 1 {
+			return &ValidationError{Field: field + ".quantity", Reason: "must be at least 1"}
+		}
+		if err := validateLineItemFields(item, field+"."); err != nil {
+			return err
+		}
+		if item.Currency != order.Currency {
+			return &ValidationError{Field: field + ".currency", Reason: "must match the order's currency"}
+		}
 	}
 	return nil
 }
@@ -47,5 +113,69 @@ func validateOrderForUpdate(order *model.Order) error {
 	if order.CustomerID < 1 {
 		return fmt.Errorf("customer ID is required for update: %w", ErrInvalidInput)
 	}
+	if order.Version < 1 {
+		return fmt.Errorf("version is required for update: %w", ErrInvalidInput)
+	}
 	return nil
 }
+
+// validateLineItem ensures a line item is valid for insert or update.
+func validateLineItem(item *model.LineItem) error {
+	if item == nil {
+		return fmt.Errorf("line item cannot be nil: %w", ErrInvalidInput)
+	}
+	if err := validateID(item.OrderID); err != nil {
+		return err
+	}
+	if item.Quantity < 1 {
+		return fmt.Errorf("line item quantity must be >= 1: %w", ErrInvalidInput)
+	}
+	return validateLineItemFields(item, "")
+}
+
+// validateLineItemFields checks the descriptive fields of a line item,
+// reporting them as ValidationErrors with the given field prefix.
+func validateLineItemFields(item *model.LineItem, prefix string) error {
+	if len(item.SKU) > maxSKULength {
+		return &ValidationError{Field: prefix + "sku", Reason: fmt.Sprintf("must be at most %d characters", maxSKULength)}
+	}
+	if len(item.ProductName) > maxProductNameLength {
+		return &ValidationError{Field: prefix + "product_name", Reason: fmt.Sprintf("must be at most %d characters", maxProductNameLength)}
+	}
+	if item.Currency != "" && !item.Currency.Valid() {
+		return &ValidationError{Field: prefix + "currency", Reason: "must be an ISO 4217 code"}
+	}
+	return nil
+}
+
+// pricingError reports an error from pricing.Apply as a ValidationError of
+// the line items, keeping err in the chain for logs.
+func pricingError(err error) error {
+	reason := "amounts are out of range"
+	for _, known := range []error{pricing.ErrDiscountTooHigh, pricing.ErrInvalidTaxRate, pricing.ErrOverflow} {
+		if errors.Is(err, known) {
+			reason = known.Error()
+			break
+		}
+	}
+	return fmt.Errorf("price order: %w: %w", err, &ValidationError{Field: "line_items", Reason: reason})
+}
+
+// inheritCurrency fills in the currency of an order and its line items when
+// only one side specifies it: an order without a currency adopts that of its
+// first priced item, and items without one adopt the order's.
+func inheritCurrency(order *model.Order) {
+	if order.Currency == "" {
+		for _, item := range order.LineItems {
+			if item.Currency != "" {
+				order.Currency = item.Currency
+				break
+			}
+		}
+	}
+	for i := range order.LineItems {
+		if order.LineItems[i].Currency == "" {
+			order.LineItems[i].Currency = order.Currency
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"gorm.io/gorm"
+)
+
+// WebhookRepo stores webhook subscriptions and their delivery log.
+type WebhookRepo struct {
+	DB *gorm.DB
+}
+
+func NewWebhookRepo(db *gorm.DB) *WebhookRepo {
+	return &WebhookRepo{DB: db}
+}
+
+// Create stores a new webhook. It needs an absolute http(s) URL and a
+// secret; its event patterns may not contain spaces.
+func (r *WebhookRepo) Create(ctx context.Context, hook *model.Webhook) error {
+	if hook == nil {
+		return fmt.Errorf("webhook is nil: %w", ErrInvalidInput)
+	}
+	if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook URL %q must be an absolute http or https URL: %w", hook.URL, ErrInvalidInput)
+	}
+	if hook.Secret == "" {
+		return fmt.Errorf("webhook secret is required: %w", ErrInvalidInput)
+	}
+	for _, pattern := range hook.Events {
+		if pattern == "" || strings.ContainsAny(pattern, " \t\n") {
+			return fmt.Errorf("invalid event pattern %q: %w", pattern, ErrInvalidInput)
+		}
+	}
+
+	if hook.CreatedAt.IsZero() {
+		hook.CreatedAt = time.Now().UTC()
+	}
+
+	if err := r.DB.WithContext(ctx).Create(hook).Error; err != nil {
+		return fmt.Errorf("insert webhook: %w", err)
+	}
+	return nil
+}
+
+// List returns all webhooks, oldest first.
+func (r *WebhookRepo) List(ctx context.Context) ([]model.Webhook, error) {
+	var hooks []model.Webhook
+	if err := r.DB.WithContext(ctx).Order("id").Find(&hooks).Error; err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// FindByID returns the webhook with the given ID.
+func (r *WebhookRepo) FindByID(ctx context.Context, id int64) (model.Webhook, error) {
+	var hook model.Webhook
+	if err := r.DB.WithContext(ctx).Where("id = ?", id).First(&hook).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.Webhook{}, fmt.Errorf("webhook %d: %w", id, ErrWebhookNotExist)
+		}
+		return model.Webhook{}, fmt.Errorf("find webhook %d: %w", id, err)
+	}
+	return hook, nil
+}
+
+// Delete deletes a webhook and its delivery log.
+func (r *WebhookRepo) Delete(ctx context.Context, id int64) error {
+	return r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", id).Delete(&model.WebhookDelivery{}).Error; err != nil {
+			return fmt.Errorf("delete deliveries of webhook %d: %w", id, err)
+		}
+
+		result := tx.Where("id = ?", id).Delete(&model.Webhook{})
+		if result.Error != nil {
+			return fmt.Errorf("delete webhook %d: %w", id, result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("webhook %d: %w", id, ErrWebhookNotExist)
+		}
+		return nil
+	})
+}
+
+// Subscribed returns the enabled webhooks whose filter matches eventType.
+func (r *WebhookRepo) Subscribed(ctx context.Context, eventType string) ([]model.Webhook, error) {
+	var hooks []model.Webhook
+	if err := r.DB.WithContext(ctx).Where("disabled_at IS NULL").Order("id").Find(&hooks).Error; err != nil {
+		return nil, fmt.Errorf("find webhooks for %s: %w", eventType, err)
+	}
+
+	matching := hooks[:0]
+	for _, h := range hooks {
+		if h.Events.Matches(eventType) {
+			matching = append(matching, h)
+		}
+	}
+	return matching, nil
+}
+
+// Delivered reports whether event eventID has been delivered to webhook
+// webhookID successfully.
+func (r *WebhookRepo) Delivered(ctx context.Context, webhookID, eventID int64) (bool, error) {
+	var count int64
+	if err := r.DB.WithContext(ctx).Model(&model.WebhookDelivery{}).
+		Where("webhook_id = ? AND event_id = ? AND success = ?", webhookID, eventID, true).
+		Count(&count).Error; err != nil {
+		return false, fmt.Errorf("find deliveries of event %d to webhook %d: %w", eventID, webhookID, err)
+	}
+	return count > 0, nil
+}
+
+// RecordDelivery logs a delivery attempt and updates the failure count of
+// its webhook: a success resets it, and a failure that brings it to
+// disableAfter disables the webhook. It reports whether this attempt
+// disabled the webhook.
+func (r *WebhookRepo) RecordDelivery(ctx context.Context, d *model.WebhookDelivery, disableAfter int) (disabled bool, err error) {
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now().UTC()
+	}
+
+	err = r.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(d).Error; err != nil {
+			return fmt.Errorf("record delivery to webhook %d: %w", d.WebhookID, err)
+		}
+
+		hooks := tx.Model(&model.Webhook{}).Where("id = ?", d.WebhookID)
+		if d.Success {
+			if err := hooks.Update("consecutive_failures", 0).Error; err != nil {
+				return fmt.Errorf("reset failures of webhook %d: %w", d.WebhookID, err)
+			}
+			return nil
+		}
+
+		if err := hooks.Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error; err != nil {
+			return fmt.Errorf("count failure of webhook %d: %w", d.WebhookID, err)
+		}
+
+		result := tx.Model(&model.Webhook{}).
+			Where("id = ? AND disabled_at IS NULL AND consecutive_failures >= ?", d.WebhookID, disableAfter).
+			Update("disabled_at", d.CreatedAt)
+		if result.Error != nil {
+			return fmt.Errorf("disable webhook %d: %w", d.WebhookID, result.Error)
+		}
+		disabled = result.RowsAffected > 0
+		return nil
+	})
+
+	return disabled, err
+}
+
+// ListDeliveries returns up to limit delivery attempts to a webhook, newest
+// first.
+func (r *WebhookRepo) ListDeliveries(ctx context.Context, webhookID int64, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+	if err := r.DB.WithContext(ctx).
+		Where("webhook_id = ?", webhookID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).Error; err != nil {
+		return nil, fmt.Errorf("list deliveries of webhook %d: %w", webhookID, err)
+	}
+	return deliveries, nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookRepo_CreateValidates(t *testing.T) {
+	repo := NewWebhookRepo(setupTestDB(t))
+	ctx := context.Background()
+
+	for name, hook := range map[string]*model.Webhook{
+		"nil":            nil,
+		"relative URL":   {URL: "/hooks", Secret: "s"},
+		"other scheme":   {URL: "ftp://example.com/hooks", Secret: "s"},
+		"no secret":      {URL: "https://example.com/hooks"},
+		"spaced pattern": {URL: "https://example.com/hooks", Secret: "s", Events: model.EventFilter{"order. paid"}},
+	} {
+		assert.ErrorIs(t, repo.Create(ctx, hook), ErrInvalidInput, name)
+	}
+
+	hook := &model.Webhook{URL: "https://example.com/hooks", Secret: "s", Events: model.EventFilter{"order.*"}}
+	require.NoError(t, repo.Create(ctx, hook))
+	assert.Positive(t, hook.ID)
+	assert.False(t, hook.CreatedAt.IsZero())
+
+	stored, err := repo.FindByID(ctx, hook.ID)
+	require.NoError(t, err)
+	assert.Equal(t, model.EventFilter{"order.*"}, stored.Events)
+	assert.Equal(t, "s", stored.Secret)
+}
+
+func TestWebhookRepo_Subscribed(t *testing.T) {
+	repo := NewWebhookRepo(setupTestDB(t))
+	ctx := context.Background()
+
+	all := &model.Webhook{URL: "https://a.example", Secret: "s"}
+	shipped := &model.Webhook{URL: "https://b.example", Secret: "s", Events: model.EventFilter{"order.shipped"}}
+	prefix := &model.Webhook{URL: "https://c.example", Secret: "s", Events: model.EventFilter{"order.*"}}
+	for _, h := range []*model.Webhook{all, shipped, prefix} {
+		require.NoError(t, repo.Create(ctx, h))
+	}
+
+	ids := func(eventType string) []int64 {
+		hooks, err := repo.Subscribed(ctx, eventType)
+		require.NoError(t, err)
+		var ids []int64
+		for _, h := range hooks {
+			ids = append(ids, h.ID)
+		}
+		return ids
+	}
+
+	assert.Equal(t, []int64{all.ID, shipped.ID, prefix.ID}, ids("order.shipped"))
+	assert.Equal(t, []int64{all.ID, prefix.ID}, ids("order.paid"))
+
+	disabled, err := repo.RecordDelivery(ctx, &model.WebhookDelivery{WebhookID: all.ID, EventID: 1, EventType: "order.paid"}, 1)
+	require.NoError(t, err)
+	require.True(t, disabled)
+	assert.Equal(t, []int64{prefix.ID}, ids("order.paid"), "disabled webhooks are not subscribed")
+}
+
+func TestWebhookRepo_RecordDelivery(t *testing.T) {
+	repo := NewWebhookRepo(setupTestDB(t))
+	ctx := context.Background()
+
+	hook := &model.Webhook{URL: "https://example.com", Secret: "s"}
+	require.NoError(t, repo.Create(ctx, hook))
+
+	record := func(eventID int64, success bool) bool {
+		disabled, err := repo.RecordDelivery(ctx, &model.WebhookDelivery{
+			WebhookID: hook.ID, EventID: eventID, EventType: "order.created", Success: success,
+		}, 3)
+		require.NoError(t, err)
+		return disabled
+	}
+
+	assert.False(t, record(1, false))
+	assert.False(t, record(1, false))
+	assert.False(t, record(1, true), "a success resets the failure count")
+
+	delivered, err := repo.Delivered(ctx, hook.ID, 1)
+	require.NoError(t, err)
+	assert.True(t, delivered)
+	delivered, err = repo.Delivered(ctx, hook.ID, 2)
+	require.NoError(t, err)
+	assert.False(t, delivered)
+
+	assert.False(t, record(2, false))
+	assert.False(t, record(2, false))
+	assert.True(t, record(2, false))
+	assert.False(t, record(2, false), "only the failure that disables the webhook reports it")
+
+	stored, err := repo.FindByID(ctx, hook.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Disabled())
+	assert.Equal(t, 4, stored.ConsecutiveFailures)
+
+	deliveries, err := repo.ListDeliveries(ctx, hook.ID, 2)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.Greater(t, deliveries[0].ID, deliveries[1].ID, "newest first")
+}
+
+func TestWebhookRepo_Delete(t *testing.T) {
+	db := setupTestDB(t)
+	repo := NewWebhookRepo(db)
+	ctx := context.Background()
+
+	hook := &model.Webhook{URL: "https://example.com", Secret: "s"}
+	require.NoError(t, repo.Create(ctx, hook))
+	_, err := repo.RecordDelivery(ctx, &model.WebhookDelivery{WebhookID: hook.ID, EventID: 1, EventType: "order.created", Success: true}, 5)
+	require.NoError(t, err)
+
+	require.NoError(t, repo.Delete(ctx, hook.ID))
+
+	var count int64
+	require.NoError(t, db.Model(&model.WebhookDelivery{}).Count(&count).Error)
+	assert.Zero(t, count, "the delivery log goes with the webhook")
+
+	assert.ErrorIs(t, repo.Delete(ctx, hook.ID), ErrWebhookNotExist)
+	_, err = repo.FindByID(ctx, hook.ID)
+	assert.ErrorIs(t, err, ErrWebhookNotExist)
+}
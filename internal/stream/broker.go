@@ -0,0 +1,220 @@
+// Package stream fans order events out to live subscribers, such as the
+// Server-Sent Events stream at GET /orders/stream.
+//
+// A Tailer reads the events from the outbox table, so that every replica
+// sees every event whichever replica made the change, and publishes them to
+// a Broker. The broker keeps the most recent events in a bounded buffer, from
+// which subscribers that reconnect can resume.
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// subscriptionBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriptionBuffer = 64
+
+var (
+	// ErrClosed is returned by Subscribe once the broker has been closed.
+	ErrClosed = errors.New("event stream closed")
+	// ErrLagged is reported by a subscription that was dropped for falling
+	// behind.
+	ErrLagged = errors.New("subscriber fell behind")
+)
+
+// Event is an order event as streamed to subscribers.
+type Event struct {
+	ID         int64
+	Type       string
+	OrderID    int64
+	CustomerID int64
+	Status     model.Status // of the order after the change
+	Data       []byte       // the event as JSON, as sent to webhooks
+}
+
+// NewEvent converts an outbox event.
+func NewEvent(e model.OutboxEvent) (Event, error) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return Event{}, fmt.Errorf("encode event %d: %w", e.ID, err)
+	}
+
+	var order struct {
+		Status model.Status `json:"status"`
+	}
+	if err := json.Unmarshal(e.Payload, &order); err != nil {
+		return Event{}, fmt.Errorf("decode order of event %d: %w", e.ID, err)
+	}
+
+	return Event{
+		ID:         e.ID,
+		Type:       e.Type,
+		OrderID:    e.OrderID,
+		CustomerID: e.CustomerID,
+		Status:     order.Status,
+		Data:       data,
+	}, nil
+}
+
+// Filter selects events. Zero-valued fields do not filter.
+type Filter struct {
+	CustomerID int64        // only events of this customer's orders
+	Status     model.Status // only events leaving an order in this status
+}
+
+// Matches reports whether e is selected by f.
+func (f Filter) Matches(e Event) bool {
+	return (f.CustomerID == 0 || e.CustomerID == f.CustomerID) &&
+		(f.Status == "" || e.Status == f.Status)
+}
+
+// Broker delivers published events to subscribers and keeps the last few
+// for replay. It is safe for concurrent use.
+type Broker struct {
+	mu     sync.Mutex
+	size   int
+	buffer []Event // the last size events, oldest first
+	last   int64   // ID of the last published event
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBroker returns a broker that keeps the last size events for replay.
+func NewBroker(size int) *Broker {
+	return &Broker{
+		size: max(size, 1),
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// Publish delivers events, which must be in ID order, to the subscribers
+// whose filter they match. Events already published are ignored.
+func (b *Broker) Publish(events ...Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, e := range events {
+		if e.ID <= b.last {
+			continue
+		}
+		b.last = e.ID
+
+		if len(b.buffer) == b.size {
+			copy(b.buffer, b.buffer[1:])
+			b.buffer = b.buffer[:b.size-1]
+		}
+		b.buffer = append(b.buffer, e)
+
+		for sub := range b.subs {
+			if !sub.filter.Matches(e) {
+				continue
+			}
+			select {
+			case sub.c <- e:
+			default:
+				b.drop(sub, ErrLagged)
+			}
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events matching filter. If after
+// is non-zero, the buffered events after it are replayed first; events
+// older than the buffer cannot be replayed.
+func (b *Broker) Subscribe(filter Filter, after int64) (*Subscription, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	sub := &Subscription{
+		b:      b,
+		filter: filter,
+		c:      make(chan Event, subscriptionBuffer),
+	}
+	if after > 0 {
+		for _, e := range b.buffer {
+			if e.ID > after && filter.Matches(e) {
+				sub.Replay = append(sub.Replay, e)
+			}
+		}
+	}
+	b.subs[sub] = struct{}{}
+	metrics.StreamSubscribers.Add(1)
+	return sub, nil
+}
+
+// Close ends every subscription and refuses new ones.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.drop(sub, ErrClosed)
+	}
+}
+
+// Subscribers returns the number of active subscriptions.
+func (b *Broker) Subscribers() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.subs)
+}
+
+// drop ends sub with err. b.mu must be held.
+func (b *Broker) drop(sub *Subscription, err error) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	sub.err = err
+	close(sub.c)
+
+	metrics.StreamSubscribers.Add(-1)
+	if errors.Is(err, ErrLagged) {
+		metrics.StreamLagged.Inc()
+	}
+}
+
+// Subscription receives the events of a Broker that match its filter.
+type Subscription struct {
+	// Replay holds the buffered events requested by Subscribe, to be sent
+	// before those from Events.
+	Replay []Event
+
+	b      *Broker
+	filter Filter
+	c      chan Event
+	err    error
+}
+
+// Events returns the channel of live events. It is closed when the
+// subscription ends; Err then tells why.
+func (s *Subscription) Events() <-chan Event {
+	return s.c
+}
+
+// Err returns ErrClosed or ErrLagged once the broker has ended the
+// subscription, and nil otherwise.
+func (s *Subscription) Err() error {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	return s.err
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.b.mu.Lock()
+	defer s.b.mu.Unlock()
+	s.b.drop(s, nil)
+}
@@ -0,0 +1,127 @@
+package stream
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func event(id, customerID int64, status model.Status) Event {
+	return Event{ID: id, Type: model.StatusEvent(status), OrderID: id, CustomerID: customerID, Status: status}
+}
+
+func ids(events []Event) []int64 {
+	out := make([]int64, len(events))
+	for i, e := range events {
+		out[i] = e.ID
+	}
+	return out
+}
+
+// received drains the events already sent to sub.
+func received(sub *Subscription) []Event {
+	var out []Event
+	for {
+		select {
+		case e, ok := <-sub.Events():
+			if !ok {
+				return out
+			}
+			out = append(out, e)
+		default:
+			return out
+		}
+	}
+}
+
+func TestBroker_DeliversMatchingEvents(t *testing.T) {
+	b := NewBroker(10)
+
+	all, err := b.Subscribe(Filter{}, 0)
+	require.NoError(t, err)
+	mine, err := b.Subscribe(Filter{CustomerID: 7}, 0)
+	require.NoError(t, err)
+	shipped, err := b.Subscribe(Filter{Status: model.StatusShipped}, 0)
+	require.NoError(t, err)
+
+	b.Publish(event(1, 7, model.StatusPending), event(2, 8, model.StatusShipped), event(3, 7, model.StatusShipped))
+	b.Publish(event(2, 8, model.StatusShipped)) // already published
+
+	assert.Equal(t, []int64{1, 2, 3}, ids(received(all)))
+	assert.Equal(t, []int64{1, 3}, ids(received(mine)))
+	assert.Equal(t, []int64{2, 3}, ids(received(shipped)))
+	assert.Empty(t, all.Replay)
+}
+
+func TestBroker_ReplaysBufferedEvents(t *testing.T) {
+	b := NewBroker(3)
+	for id := int64(1); id <= 5; id++ {
+		b.Publish(event(id, 1, model.StatusPending))
+	}
+
+	sub, err := b.Subscribe(Filter{}, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{4, 5}, ids(sub.Replay))
+
+	sub, err = b.Subscribe(Filter{}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4, 5}, ids(sub.Replay), "events older than the buffer are lost")
+
+	b.Publish(event(6, 1, model.StatusPending))
+	assert.Equal(t, []int64{6}, ids(received(sub)), "live events follow the replay")
+}
+
+func TestBroker_DropsLaggingSubscriber(t *testing.T) {
+	b := NewBroker(10)
+	slow, err := b.Subscribe(Filter{}, 0)
+	require.NoError(t, err)
+
+	for id := int64(1); id <= subscriptionBuffer+1; id++ {
+		b.Publish(event(id, 1, model.StatusPending))
+	}
+
+	assert.Len(t, received(slow), subscriptionBuffer)
+	_, open := <-slow.Events()
+	assert.False(t, open)
+	assert.ErrorIs(t, slow.Err(), ErrLagged)
+	assert.Zero(t, b.Subscribers())
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := NewBroker(10)
+	sub, err := b.Subscribe(Filter{}, 0)
+	require.NoError(t, err)
+	other, err := b.Subscribe(Filter{}, 0)
+	require.NoError(t, err)
+
+	other.Close()
+	other.Close()
+	assert.Equal(t, 1, b.Subscribers())
+
+	b.Close()
+	_, open := <-sub.Events()
+	assert.False(t, open)
+	assert.ErrorIs(t, sub.Err(), ErrClosed)
+	assert.NoError(t, other.Err(), "closed by its subscriber")
+
+	_, err = b.Subscribe(Filter{}, 0)
+	assert.ErrorIs(t, err, ErrClosed)
+}
+
+func TestNewEvent(t *testing.T) {
+	payload, err := json.Marshal(model.Order{OrderID: 4, CustomerID: 2, Status: model.StatusPaid})
+	require.NoError(t, err)
+
+	e, err := NewEvent(model.OutboxEvent{ID: 9, Type: "order.paid", OrderID: 4, CustomerID: 2, Payload: payload})
+	require.NoError(t, err)
+	assert.Equal(t, int64(9), e.ID)
+	assert.Equal(t, model.StatusPaid, e.Status)
+
+	var data map[string]any
+	require.NoError(t, json.Unmarshal(e.Data, &data))
+	assert.Equal(t, "order.paid", data["type"])
+	assert.Contains(t, data, "data")
+}
@@ -0,0 +1,125 @@
+package stream
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// Tailer defaults, used by NewTailer.
+const (
+	DefaultPollInterval = time.Second
+	DefaultGapTimeout   = 5 * time.Second
+	DefaultBatchSize    = 500
+)
+
+// Source reads the outbox. repository.OutboxRepo implements it.
+type Source interface {
+	Latest(ctx context.Context, limit int) ([]model.OutboxEvent, error)
+	After(ctx context.Context, id int64, limit int) ([]model.OutboxEvent, error)
+}
+
+// Tailer publishes the events of a Source to a Broker in ID order.
+//
+// Event IDs are allocated before their transactions commit, so a
+// transaction can commit after one that took a later ID. When the tailer
+// sees a gap in the IDs it waits up to GapTimeout for the missing events
+// before moving past them; gaps left by rolled-back transactions therefore
+// delay the stream by GapTimeout.
+type Tailer struct {
+	Source       Source
+	Broker       *Broker
+	PollInterval time.Duration
+	GapTimeout   time.Duration
+	BatchSize    int
+
+	started  bool
+	last     int64     // ID of the last event published
+	gapSince time.Time // when the current gap was first seen
+}
+
+// NewTailer returns a tailer with the default settings.
+func NewTailer(source Source, broker *Broker) *Tailer {
+	return &Tailer{
+		Source:       source,
+		Broker:       broker,
+		PollInterval: DefaultPollInterval,
+		GapTimeout:   DefaultGapTimeout,
+		BatchSize:    DefaultBatchSize,
+	}
+}
+
+// Run polls until ctx is cancelled.
+func (t *Tailer) Run(ctx context.Context) {
+	interval := t.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := t.Poll(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "event stream poll failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll publishes the events added since the last poll, as of now. The first
+// poll fills the broker's replay buffer with the latest events.
+func (t *Tailer) Poll(ctx context.Context, now time.Time) error {
+	if !t.started {
+		events, err := t.Source.Latest(ctx, t.Broker.size)
+		if err != nil {
+			return err
+		}
+		t.publish(ctx, events)
+		t.started = true
+		return nil
+	}
+
+	events, err := t.Source.After(ctx, t.last, t.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	for i, e := range events {
+		if t.last != 0 && e.ID != t.last+1 {
+			if t.gapSince.IsZero() {
+				t.gapSince = now
+			}
+			if now.Sub(t.gapSince) < t.GapTimeout {
+				events = events[:i]
+				break
+			}
+		}
+		t.gapSince = time.Time{}
+		t.last = e.ID
+	}
+
+	t.publish(ctx, events)
+	return nil
+}
+
+func (t *Tailer) publish(ctx context.Context, events []model.OutboxEvent) {
+	converted := make([]Event, 0, len(events))
+	for _, e := range events {
+		t.last = max(t.last, e.ID)
+
+		ev, err := NewEvent(e)
+		if err != nil {
+			slog.ErrorContext(ctx, "event stream skipped an event", "event_id", e.ID, "error", err)
+			continue
+		}
+		converted = append(converted, ev)
+	}
+	t.Broker.Publish(converted...)
+}
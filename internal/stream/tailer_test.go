@@ -0,0 +1,121 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSource serves a fixed, ID-ordered list of committed events.
+type fakeSource struct {
+	events []model.OutboxEvent
+}
+
+func (s *fakeSource) add(ids ...int64) {
+	for _, id := range ids {
+		s.events = append(s.events, model.OutboxEvent{
+			ID: id, Type: model.EventOrderUpdated, OrderID: id, CustomerID: 1, Payload: []byte(`{"status":"pending"}`),
+		})
+	}
+	// Keep ID order, as the database would.
+	for i := len(s.events) - 1; i > 0 && s.events[i].ID < s.events[i-1].ID; i-- {
+		s.events[i], s.events[i-1] = s.events[i-1], s.events[i]
+	}
+}
+
+func (s *fakeSource) Latest(_ context.Context, limit int) ([]model.OutboxEvent, error) {
+	return s.events[max(0, len(s.events)-limit):], nil
+}
+
+func (s *fakeSource) After(_ context.Context, id int64, limit int) ([]model.OutboxEvent, error) {
+	var out []model.OutboxEvent
+	for _, e := range s.events {
+		if e.ID > id && len(out) < limit {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func TestTailer_SeedsBufferThenFollows(t *testing.T) {
+	src := &fakeSource{}
+	src.add(1, 2, 3, 4)
+	b := NewBroker(2)
+	tailer := NewTailer(src, b)
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, tailer.Poll(ctx, now))
+	sub, err := b.Subscribe(Filter{}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{3, 4}, ids(sub.Replay), "the buffer starts with the latest events")
+
+	src.add(5, 6)
+	require.NoError(t, tailer.Poll(ctx, now))
+	assert.Equal(t, []int64{5, 6}, ids(received(sub)))
+}
+
+func TestTailer_WaitsForGapsToFill(t *testing.T) {
+	src := &fakeSource{}
+	src.add(1)
+	b := NewBroker(10)
+	tailer := NewTailer(src, b)
+	tailer.GapTimeout = time.Second
+	ctx := context.Background()
+	now := time.Now()
+
+	require.NoError(t, tailer.Poll(ctx, now))
+	sub, err := b.Subscribe(Filter{}, 0)
+	require.NoError(t, err)
+
+	// Event 2 is still uncommitted when 3 appears.
+	src.add(3)
+	require.NoError(t, tailer.Poll(ctx, now))
+	assert.Empty(t, received(sub))
+
+	src.add(2)
+	require.NoError(t, tailer.Poll(ctx, now.Add(100*time.Millisecond)))
+	assert.Equal(t, []int64{2, 3}, ids(received(sub)))
+
+	// Event 4 never commits.
+	src.add(5)
+	require.NoError(t, tailer.Poll(ctx, now.Add(200*time.Millisecond)))
+	assert.Empty(t, received(sub))
+	require.NoError(t, tailer.Poll(ctx, now.Add(1300*time.Millisecond)))
+	assert.Equal(t, []int64{5}, ids(received(sub)), "the gap is skipped after GapTimeout")
+}
+
+func TestTailer_Run(t *testing.T) {
+	src := &fakeSource{}
+	src.add(1)
+	b := NewBroker(10)
+	tailer := NewTailer(src, b)
+	tailer.PollInterval = 10 * time.Millisecond
+	sub, err := b.Subscribe(Filter{}, 0)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tailer.Run(ctx)
+		close(done)
+	}()
+
+	select {
+	case e := <-sub.Events():
+		assert.Equal(t, int64(1), e.ID)
+	case <-time.After(time.Second):
+		t.Fatal("no event published")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// GormPlugin is a GORM plugin that wraps every operation in a client span,
+// a child of the span in the statement's context (see gorm.DB.WithContext).
+// Spans are named after the SQL operation and table, such as
+// "SELECT orders", and carry the SQL without its parameters. A nil
+// TracerProvider means the global one.
+type GormPlugin struct {
+	TracerProvider trace.TracerProvider
+}
+
+// Name implements gorm.Plugin.
+func (p *GormPlugin) Name() string {
+	return "tracing"
+}
+
+const spanKey = "tracing:span"
+
+// callbackRegisterer is what GORM's Before and After return.
+type callbackRegisterer interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+// Initialize implements gorm.Plugin: it registers callbacks that run first
+// and last around each operation.
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+	tp := p.TracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	tracer := tp.Tracer(TracerName)
+	system := dbSystem(db.Dialector.Name())
+
+	cb := db.Callback()
+	hooks := []struct {
+		operation     string
+		before, after callbackRegisterer
+	}{
+		{"create", cb.Create().Before("*"), cb.Create().After("*")},
+		{"query", cb.Query().Before("*"), cb.Query().After("*")},
+		{"update", cb.Update().Before("*"), cb.Update().After("*")},
+		{"delete", cb.Delete().Before("*"), cb.Delete().After("*")},
+		{"row", cb.Row().Before("*"), cb.Row().After("*")},
+		{"raw", cb.Raw().Before("*"), cb.Raw().After("*")},
+	}
+
+	for _, h := range hooks {
+		start := func(db *gorm.DB) {
+			_, span := tracer.Start(db.Statement.Context, "gorm."+h.operation,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(system),
+			)
+			db.InstanceSet(spanKey, span)
+		}
+		if err := h.before.Register("tracing:before_"+h.operation, start); err != nil {
+			return err
+		}
+		if err := h.after.Register("tracing:after_"+h.operation, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// end names the span of db's operation after its SQL and ends it.
+func end(db *gorm.DB) {
+	v, ok := db.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	sql := db.Statement.SQL.String()
+	operation := sqlOperation(sql)
+	table := db.Statement.Table
+
+	if operation != "" {
+		span.SetName(strings.TrimSpace(operation + " " + table))
+		span.SetAttributes(semconv.DBOperationName(operation))
+	}
+	if table != "" {
+		span.SetAttributes(semconv.DBCollectionName(table))
+	}
+	span.SetAttributes(semconv.DBQueryText(sql))
+
+	if err := db.Error; err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// sqlOperation returns the leading keyword of a SQL statement, such as
+// SELECT, in upper case.
+func sqlOperation(sql string) string {
+	fields := strings.Fields(sql)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(fields[0])
+}
+
+// dbSystem maps a GORM dialector name to the db.system.name attribute.
+func dbSystem(dialector string) attribute.KeyValue {
+	switch dialector {
+	case "postgres":
+		return semconv.DBSystemNamePostgreSQL
+	case "sqlite":
+		return semconv.DBSystemNameSQLite
+	}
+	return semconv.DBSystemNameKey.String(dialector)
+}
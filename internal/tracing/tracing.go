@@ -0,0 +1,76 @@
+// Package tracing sets up OpenTelemetry tracing: the tracer provider and its
+// exporter, W3C trace context propagation and spans for GORM operations.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// TracerName names the tracers of this service's instrumentation.
+const TracerName = "github.com/corradoisidoro/orders-api"
+
+// serviceName is reported unless OTEL_SERVICE_NAME overrides it.
+const serviceName = "orders-api"
+
+// Span exporters selectable with TRACING_EXPORTER.
+const (
+	ExporterNone   = "none"   // spans are not recorded
+	ExporterStdout = "stdout" // spans are written to stdout as JSON
+	ExporterOTLP   = "otlp"   // spans are sent over OTLP/HTTP (see OTEL_EXPORTER_OTLP_ENDPOINT)
+)
+
+// Propagator reads and writes the W3C traceparent, tracestate and baggage
+// headers.
+var Propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Setup installs Propagator and, unless exporter is ExporterNone, a global
+// tracer provider sending spans to that exporter. The standard OTEL_*
+// environment variables configure the OTLP exporter, the sampler and the
+// resource. The returned function flushes pending spans and stops the
+// provider.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(Propagator)
+
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone, "":
+		return func(context.Context) error { return nil }, nil
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("tracing: unknown exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: create %s exporter: %w", exporter, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(serviceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: build resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,111 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/corradoisidoro/orders-api/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func newTracedDB(t *testing.T) (*gorm.DB, *sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+
+	exp := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exp))
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&model.Order{}, &model.LineItem{}, &model.OutboxEvent{}, &model.OrderHistory{}))
+	require.NoError(t, db.Use(&tracing.GormPlugin{TracerProvider: tp}))
+
+	return db, tp, exp
+}
+
+func attr(span tracetest.SpanStub, key attribute.Key) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			return kv.Value.Emit()
+		}
+	}
+	return ""
+}
+
+func TestGormPlugin_RepositoryCallsAreChildSpans(t *testing.T) {
+	db, tp, exp := newTracedDB(t)
+	repo := repository.NewOrderRepo(db)
+
+	staff := repository.WithScope(context.Background(), repository.Unrestricted)
+	ctx, parent := tp.Tracer("test").Start(staff, "request")
+	order := &model.Order{CustomerID: 1, Status: model.StatusPending}
+	require.NoError(t, repo.Insert(ctx, order))
+	_, err := repo.FindByID(ctx, order.OrderID)
+	require.NoError(t, err)
+	parent.End()
+
+	spans := exp.GetSpans()
+	byName := make(map[string]tracetest.SpanStub)
+	for _, s := range spans {
+		byName[s.Name] = s
+	}
+
+	require.Contains(t, byName, "INSERT orders")
+	require.Contains(t, byName, "SELECT orders")
+
+	for _, name := range []string{"INSERT orders", "SELECT orders"} {
+		s := byName[name]
+		assert.Equal(t, parent.SpanContext().TraceID(), s.SpanContext.TraceID(), name)
+		assert.Equal(t, parent.SpanContext().SpanID(), s.Parent.SpanID(), name)
+		assert.Equal(t, trace.SpanKindClient, s.SpanKind, name)
+		assert.Equal(t, "orders", attr(s, "db.collection.name"), name)
+		assert.Equal(t, "sqlite", attr(s, "db.system.name"), name)
+	}
+	assert.Equal(t, "SELECT", attr(byName["SELECT orders"], "db.operation.name"))
+	assert.Contains(t, attr(byName["SELECT orders"], "db.query.text"), "?", "parameters are not recorded")
+}
+
+func TestGormPlugin_RecordsErrors(t *testing.T) {
+	db, _, exp := newTracedDB(t)
+
+	err := db.Exec("SELECT * FROM missing_table").Error
+	require.Error(t, err)
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, "SELECT", spans[0].Name, "raw SQL has no statement table")
+	assert.Equal(t, codes.Error, spans[0].Status.Code)
+	assert.Len(t, spans[0].Events, 1, "the error is recorded")
+}
+
+func TestGormPlugin_NotFoundIsNotAnError(t *testing.T) {
+	db, _, exp := newTracedDB(t)
+
+	err := db.First(&model.Order{}, 404).Error
+	require.True(t, errors.Is(err, gorm.ErrRecordNotFound))
+
+	spans := exp.GetSpans()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Unset, spans[0].Status.Code)
+}
+
+func TestSetup(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), tracing.ExporterNone)
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+
+	_, err = tracing.Setup(context.Background(), "zipkin")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown exporter")
+}
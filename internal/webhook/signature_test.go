@@ -0,0 +1,41 @@
+package webhook_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"id":1}`)
+
+	header := webhook.Sign("secret", now, body)
+	assert.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+
+	require.NoError(t, webhook.Verify("secret", header, body, now.Add(time.Minute), 5*time.Minute))
+
+	for name, err := range map[string]error{
+		"wrong secret":  webhook.Verify("other", header, body, now, 5*time.Minute),
+		"tampered body": webhook.Verify("secret", header, []byte(`{"id":2}`), now, 5*time.Minute),
+		"stale":         webhook.Verify("secret", header, body, now.Add(time.Hour), 5*time.Minute),
+		"malformed":     webhook.Verify("secret", "v1=abc", body, now, 5*time.Minute),
+	} {
+		assert.ErrorIs(t, err, webhook.ErrInvalidSignature, name)
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := webhook.NewSecret()
+	require.NoError(t, err)
+	b, err := webhook.NewSecret()
+	require.NoError(t, err)
+
+	assert.True(t, strings.HasPrefix(a, "whsec_"))
+	assert.Len(t, a, len("whsec_")+64)
+	assert.NotEqual(t, a, b)
+}
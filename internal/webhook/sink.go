@@ -0,0 +1,162 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/metrics"
+	"github.com/corradoisidoro/orders-api/internal/model"
+)
+
+// Sink defaults, used by NewSink.
+const (
+	DefaultTimeout      = 10 * time.Second
+	DefaultDisableAfter = 5
+)
+
+// Store holds the webhooks and their delivery log.
+// repository.WebhookRepo implements it.
+type Store interface {
+	Subscribed(ctx context.Context, eventType string) ([]model.Webhook, error)
+	Delivered(ctx context.Context, webhookID, eventID int64) (bool, error)
+	RecordDelivery(ctx context.Context, d *model.WebhookDelivery, disableAfter int) (disabled bool, err error)
+}
+
+// Sink is an outbox.Sink that POSTs each event, as JSON, to the webhooks
+// subscribed to it. Every attempt is recorded in the delivery log.
+//
+// A delivery succeeds when the webhook answers with a 2xx status; redirects
+// are not followed. Deliver fails if any webhook failed, so that the outbox
+// relay retries the event with backoff; on retry, webhooks that already
+// received it are skipped. A webhook that fails DisableAfter times in a row
+// is disabled, and the event no longer waits for it.
+type Sink struct {
+	Store        Store
+	Client       *http.Client
+	DisableAfter int
+}
+
+// NewSink returns a sink with the default settings.
+func NewSink(store Store) *Sink {
+	return &Sink{
+		Store: store,
+		Client: &http.Client{
+			Timeout: DefaultTimeout,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		DisableAfter: DefaultDisableAfter,
+	}
+}
+
+func (s *Sink) Deliver(ctx context.Context, event model.OutboxEvent) error {
+	hooks, err := s.Store.Subscribed(ctx, event.Type)
+	if err != nil {
+		return err
+	}
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("encode event %d: %w", event.ID, err)
+	}
+
+	var errs []error
+	for _, hook := range hooks {
+		delivered, err := s.Store.Delivered(ctx, hook.ID, event.ID)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if delivered {
+			continue
+		}
+
+		if err := s.deliver(ctx, hook, event, body); err != nil {
+			errs = append(errs, fmt.Errorf("webhook %d: %w", hook.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// deliver sends event to hook and records the attempt. It returns an error
+// if the event should be retried for hook.
+func (s *Sink) deliver(ctx context.Context, hook model.Webhook, event model.OutboxEvent, body []byte) error {
+	start := time.Now()
+	status, sendErr := s.send(ctx, hook, event, body)
+	if sendErr != nil && ctx.Err() != nil {
+		// Stopping; the relay retries the event later.
+		return sendErr
+	}
+
+	d := &model.WebhookDelivery{
+		WebhookID:  hook.ID,
+		EventID:    event.ID,
+		EventType:  event.Type,
+		StatusCode: status,
+		Success:    sendErr == nil,
+		DurationMs: time.Since(start).Milliseconds(),
+	}
+	if sendErr != nil {
+		d.Error = sendErr.Error()
+	}
+
+	disabled, err := s.Store.RecordDelivery(ctx, d, s.DisableAfter)
+	if err != nil {
+		return err
+	}
+
+	if sendErr == nil {
+		metrics.WebhookDeliveries.WithLabelValues("success").Inc()
+		return nil
+	}
+
+	metrics.WebhookDeliveries.WithLabelValues("failure").Inc()
+	if disabled {
+		metrics.WebhooksDisabled.Inc()
+		slog.WarnContext(ctx, "webhook disabled after repeated failures",
+			"webhook_id", hook.ID,
+			"failures", s.DisableAfter,
+			"error", sendErr,
+		)
+		return nil
+	}
+	return sendErr
+}
+
+// send POSTs body to hook and returns the response status, or 0 if there was
+// no response.
+func (s *Sink) send(ctx context.Context, hook model.Webhook, event model.OutboxEvent, body []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "orders-api-webhooks")
+	req.Header.Set(HeaderEventID, fmt.Sprint(event.ID))
+	req.Header.Set(HeaderEventType, event.Type)
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, time.Now(), body))
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little of the body so that the connection can be reused.
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
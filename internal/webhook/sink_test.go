@@ -0,0 +1,234 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corradoisidoro/orders-api/internal/model"
+	"github.com/corradoisidoro/orders-api/internal/outbox"
+	"github.com/corradoisidoro/orders-api/internal/repository"
+	"github.com/corradoisidoro/orders-api/internal/webhook"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// staffCtx sees and changes every customer's orders.
+var staffCtx = repository.WithScope(context.Background(), repository.Unrestricted)
+
+const secret = "whsec_test"
+
+type fixture struct {
+	db       *gorm.DB
+	orders   repository.OrderRepository
+	webhooks *repository.WebhookRepo
+	relay    *outbox.Relay
+	sink     *webhook.Sink
+}
+
+func setup(t *testing.T) fixture {
+	t.Helper()
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Discard})
+	require.NoError(t, err)
+
+	// Every connection to :memory: opens a new database; keep to one.
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	require.NoError(t, db.AutoMigrate(&model.Order{}, &model.LineItem{}, &model.OutboxEvent{}, &model.OrderHistory{},
+		&model.Webhook{}, &model.WebhookDelivery{}))
+
+	webhooks := repository.NewWebhookRepo(db)
+	sink := webhook.NewSink(webhooks)
+	relay := outbox.NewRelay(repository.NewOutboxRepo(db), sink)
+	relay.Backoff = func(int) time.Duration { return 0 }
+
+	return fixture{db: db, orders: repository.NewOrderRepo(db), webhooks: webhooks, relay: relay, sink: sink}
+}
+
+// receiver is a webhook endpoint that verifies signatures and records the
+// events it accepts. It answers with status, 200 if unset.
+type receiver struct {
+	*httptest.Server
+	mu     sync.Mutex
+	status int
+	events []model.OutboxEvent
+	bad    int // requests with an invalid signature
+}
+
+func newReceiver(t *testing.T) *receiver {
+	rcv := &receiver{}
+	rcv.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rcv.mu.Lock()
+		defer rcv.mu.Unlock()
+
+		if err := webhook.Verify(secret, r.Header.Get(webhook.HeaderSignature), body, time.Now(), time.Minute); err != nil {
+			rcv.bad++
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if rcv.status != 0 && rcv.status != http.StatusOK {
+			w.WriteHeader(rcv.status)
+			return
+		}
+
+		var e model.OutboxEvent
+		if err := json.Unmarshal(body, &e); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		assert.Equal(t, e.Type, r.Header.Get(webhook.HeaderEventType))
+		rcv.events = append(rcv.events, e)
+	}))
+	t.Cleanup(rcv.Close)
+	return rcv
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) types() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	types := make([]string, len(r.events))
+	for i, e := range r.events {
+		types[i] = e.Type
+	}
+	return types
+}
+
+func (f fixture) subscribe(t *testing.T, url string, events ...string) model.Webhook {
+	t.Helper()
+	hook := model.Webhook{URL: url, Events: events, Secret: secret}
+	require.NoError(t, f.webhooks.Create(staffCtx, &hook))
+	return hook
+}
+
+// relayAll runs the relay until no event is due.
+func (f fixture) relayAll(t *testing.T) {
+	t.Helper()
+	for range 20 {
+		n, err := f.relay.RelayBatch(staffCtx)
+		require.NoError(t, err)
+		if n == 0 {
+			return
+		}
+	}
+	t.Fatal("events still due after 20 batches")
+}
+
+func TestSink_DeliversSignedStatusChanges(t *testing.T) {
+	f := setup(t)
+	ctx := staffCtx
+	rcv := newReceiver(t)
+	f.subscribe(t, rcv.URL, "order.paid", "order.cancelled")
+
+	o := &model.Order{CustomerID: 5}
+	require.NoError(t, f.orders.Insert(ctx, o))
+	o.Status = model.StatusPaid
+	require.NoError(t, f.orders.UpdateByID(ctx, o))
+	f.relayAll(t)
+
+	require.Equal(t, []string{"order.paid"}, rcv.types(), "order.created is filtered out")
+	assert.Zero(t, rcv.bad)
+
+	e := rcv.events[0]
+	assert.Equal(t, o.OrderID, e.OrderID)
+	assert.Equal(t, int64(5), e.CustomerID)
+	var data model.Order
+	require.NoError(t, json.Unmarshal(e.Payload, &data))
+	assert.Equal(t, model.StatusPaid, data.Status)
+}
+
+func TestSink_RetriesFailedWebhookOnly(t *testing.T) {
+	f := setup(t)
+	ctx := staffCtx
+	up, down := newReceiver(t), newReceiver(t)
+	f.subscribe(t, up.URL)
+	flaky := f.subscribe(t, down.URL)
+	down.setStatus(http.StatusServiceUnavailable)
+
+	require.NoError(t, f.orders.Insert(ctx, &model.Order{CustomerID: 1}))
+
+	_, err := f.relay.RelayBatch(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"order.created"}, up.types())
+	assert.Empty(t, down.types())
+
+	down.setStatus(http.StatusOK)
+	f.relayAll(t)
+	assert.Equal(t, []string{"order.created"}, up.types(), "the working webhook is not sent the event again")
+	assert.Equal(t, []string{"order.created"}, down.types())
+
+	deliveries, err := f.webhooks.ListDeliveries(ctx, flaky.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 2)
+	assert.True(t, deliveries[0].Success)
+	assert.Equal(t, http.StatusOK, deliveries[0].StatusCode)
+	assert.False(t, deliveries[1].Success)
+	assert.Equal(t, http.StatusServiceUnavailable, deliveries[1].StatusCode)
+	assert.Contains(t, deliveries[1].Error, "unexpected status 503")
+}
+
+func TestSink_DisablesWebhookAfterRepeatedFailures(t *testing.T) {
+	f := setup(t)
+	ctx := staffCtx
+	rcv := newReceiver(t)
+	rcv.setStatus(http.StatusInternalServerError)
+	hook := f.subscribe(t, rcv.URL)
+	f.sink.DisableAfter = 3
+
+	o := &model.Order{CustomerID: 1}
+	require.NoError(t, f.orders.Insert(ctx, o))
+	o.Status = model.StatusPaid
+	require.NoError(t, f.orders.UpdateByID(ctx, o))
+	f.relayAll(t)
+
+	stored, err := f.webhooks.FindByID(ctx, hook.ID)
+	require.NoError(t, err)
+	assert.True(t, stored.Disabled())
+	assert.Equal(t, 3, stored.ConsecutiveFailures)
+
+	deliveries, err := f.webhooks.ListDeliveries(ctx, hook.ID, 10)
+	require.NoError(t, err)
+	assert.Len(t, deliveries, 3, "a disabled webhook is not called again")
+
+	var pending int64
+	require.NoError(t, f.db.Model(&model.OutboxEvent{}).Where("delivered_at IS NULL").Count(&pending).Error)
+	assert.Zero(t, pending, "events do not wait for a disabled webhook")
+}
+
+func TestSink_UnreachableWebhook(t *testing.T) {
+	f := setup(t)
+	ctx := staffCtx
+	rcv := newReceiver(t)
+	url := rcv.URL
+	rcv.Close()
+	hook := f.subscribe(t, url)
+
+	require.NoError(t, f.orders.Insert(ctx, &model.Order{CustomerID: 1}))
+	_, err := f.relay.RelayBatch(ctx)
+	require.NoError(t, err)
+
+	deliveries, err := f.webhooks.ListDeliveries(ctx, hook.ID, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Zero(t, deliveries[0].StatusCode)
+	assert.NotEmpty(t, deliveries[0].Error)
+}